@@ -222,7 +222,49 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
 		}
 
+	case "history":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		history, err := client.GetRuleHistory(h.nc, id)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		en := json.NewEncoder(res)
+		err = en.Encode(history)
+		if err != nil {
+			http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+		}
+
 	case "not":
+		var sub string
+		sub, req.URL.Path = ShiftPath(req.URL.Path)
+
+		if sub == "ack" {
+			// acknowledge a notification, id is the notification ID
+			if req.Method != http.MethodPost {
+				http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+				return
+			}
+
+			err := client.AckNotification(h.nc, id, userID)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			err = en.Encode(data.StandardResponse{Success: true, ID: id})
+			if err != nil {
+				http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
 		switch req.Method {
 		case http.MethodPost:
 			var not data.Notification
@@ -240,7 +282,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 				return
 			}
 
-			err = h.nc.Publish("node."+id+".not", d)
+			err = h.nc.Publish(client.SubjectNodeNotification(id), d)
 
 			if err != nil {
 				http.Error(res, err.Error(), http.StatusBadRequest)
@@ -34,3 +34,18 @@ func AdminStoreMaint(nc *nats.Conn) error {
 
 	return nil
 }
+
+// AdminStoreBackup writes a consistent backup of the running store to the
+// store backup dir.
+func AdminStoreBackup(nc *nats.Conn) error {
+	resp, err := nc.Request("admin.storeBackup", nil, time.Minute*5)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 {
+		return errors.New(string(resp.Data))
+	}
+
+	return nil
+}
@@ -25,17 +25,11 @@ type clientState[T any] struct {
 func newClientState[T any](nc *nats.Conn, construct func(*nats.Conn, T) Client,
 	n data.NodeEdge) (*clientState[T], error) {
 
-	c, err := GetNodes(nc, n.ID, "all", "", false)
+	ncc, err := getChildrenRecursive(nc, n.ID)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting children: %v", err)
 	}
 
-	ncc := make([]data.NodeEdgeChildren, len(c))
-
-	for i, nci := range c {
-		ncc[i] = data.NodeEdgeChildren{NodeEdge: nci, Children: nil}
-	}
-
 	nec := data.NodeEdgeChildren{NodeEdge: n, Children: ncc}
 
 	var config T
@@ -58,6 +52,28 @@ func newClientState[T any](nc *nats.Conn, construct func(*nats.Conn, T) Client,
 	return ret, nil
 }
 
+// getChildrenRecursive returns the tree of nodes below a node. This allows
+// client configs to contain nested child nodes (for example, condition
+// groups in a rule).
+func getChildrenRecursive(nc *nats.Conn, id string) ([]data.NodeEdgeChildren, error) {
+	c, err := GetNodes(nc, id, "all", "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]data.NodeEdgeChildren, len(c))
+
+	for i, nci := range c {
+		children, err := getChildrenRecursive(nc, nci.ID)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = data.NodeEdgeChildren{NodeEdge: nci, Children: children}
+	}
+
+	return ret, nil
+}
+
 func (cs *clientState[T]) run() (err error) {
 
 	chClientStopped := make(chan struct{})
@@ -60,11 +60,20 @@ func DefaultClients(nc *nats.Conn) (*Group, error) {
 	ntp := NewManager(nc, NewNTPClient, nil)
 	g.Add(ntp)
 
+	gpsRx := NewManager(nc, NewGpsClient, nil)
+	g.Add(gpsRx)
+
 	nm := NewManager(nc, NewNetworkManagerClient, nil)
 	g.Add(nm)
 
 	up := NewManager(nc, NewUpdateClient, nil)
 	g.Add(up)
 
+	notify := NewNotificationClient(nc)
+	g.Add(notify)
+
+	msgSvc := NewManager(nc, NewMsgServiceClient, nil)
+	g.Add(msgSvc)
+
 	return g, nil
 }
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// conditionState tracks runtime state for a condition that is not stored
+// in the condition node.
+type conditionState struct {
+	// rawActive is the state of the condition before minActive is applied
+	rawActive bool
+	// rawActiveStart is when rawActive last went true
+	rawActiveStart time.Time
+	// lastUpdate is when a matching point was last seen (noUpdate conditions)
+	lastUpdate time.Time
+	// window holds recent points for conditions that use a statistic
+	window *data.PointWindow
+	// location of the node used for sun events (schedule conditions)
+	latitude, longitude       float64
+	hasLatitude, hasLongitude bool
+}
+
+// updatePosition updates the location of a schedule condition from
+// latitude and longitude points
+func (st *conditionState) updatePosition(p data.Point) {
+	if p.Tombstone != 0 {
+		return
+	}
+
+	switch p.Type {
+	case data.PointTypeLatitude:
+		st.latitude = p.Value
+		st.hasLatitude = true
+	case data.PointTypeLongitude:
+		st.longitude = p.Value
+		st.hasLongitude = true
+	}
+}
+
+// position returns nil until both latitude and longitude are known
+func (st *conditionState) position() *data.GpsPos {
+	if !st.hasLatitude || !st.hasLongitude {
+		return nil
+	}
+	return &data.GpsPos{Lat: st.latitude, Long: st.longitude}
+}
+
+// numberActive compares a value to the condition threshold. Deadband and
+// hysteresis are applied relative to the current state so that a value
+// hovering around the threshold does not cause the condition to chatter.
+//
+// For > and <, values within deadband of the threshold do not change the
+// state. Once active, the value must move back past the threshold by an
+// additional hysteresis amount before the condition clears.
+//
+// For = and !=, the value is considered equal if it is within deadband of
+// the threshold. Hysteresis widens the band once the condition is active.
+func (c *Condition) numberActive(v float64, active bool) bool {
+	switch c.Operator {
+	case data.PointValueGreaterThan:
+		if active {
+			return v > c.Value-c.Deadband-c.Hysteresis
+		}
+		return v > c.Value+c.Deadband
+	case data.PointValueLessThan:
+		if active {
+			return v < c.Value+c.Deadband+c.Hysteresis
+		}
+		return v < c.Value-c.Deadband
+	case data.PointValueEqual:
+		band := c.Deadband
+		if active {
+			band += c.Hysteresis
+		}
+		return math.Abs(v-c.Value) <= band
+	case data.PointValueNotEqual:
+		band := c.Deadband
+		if !active {
+			band += c.Hysteresis
+		}
+		return math.Abs(v-c.Value) > band
+	}
+
+	return false
+}
+
+// statValue adds a point to the condition window (if a statistic is used)
+// and returns the value the condition compares against the threshold.
+// ok is false if there is not enough data yet to calculate the statistic.
+func (c *Condition) statValue(st *conditionState, p data.Point) (v float64, ok bool, err error) {
+	if c.Statistic == "" {
+		return p.Value, true, nil
+	}
+
+	if c.Window <= 0 {
+		return 0, false, fmt.Errorf("window must be set for statistic: %v", c.Statistic)
+	}
+
+	if st.window == nil {
+		st.window = data.NewPointWindow(
+			time.Duration(c.Window * float64(time.Minute)))
+	}
+
+	// points without a time are placed at the current time so they are not
+	// pruned from the window as soon as a timed point arrives
+	p.Time = pointTime(p)
+	st.window.Add(p)
+
+	switch c.Statistic {
+	case data.PointValueMin:
+		return st.window.Min(), true, nil
+	case data.PointValueMax:
+		return st.window.Max(), true, nil
+	case data.PointValueAvg:
+		return st.window.Avg(), true, nil
+	case data.PointValueRate:
+		v, ok := st.window.Rate()
+		return v, ok, nil
+	default:
+		return 0, false, fmt.Errorf("unknown statistic: %v", c.Statistic)
+	}
+}
+
+// minActiveDuration returns the minActive point as a duration. MinActive
+// is specified in minutes.
+func (c *Condition) minActiveDuration() time.Duration {
+	return time.Duration(c.MinActive * float64(time.Minute))
+}
+
+// applyMinActive returns the active state of a condition after the
+// minActive time has been applied to the raw state.
+func (c *Condition) applyMinActive(st *conditionState, t time.Time) bool {
+	if !st.rawActive {
+		return false
+	}
+
+	if c.MinActive <= 0 {
+		return true
+	}
+
+	return t.Sub(st.rawActiveStart) >= c.minActiveDuration()
+}
+
+// timeoutDuration returns the timeout point as a duration. Timeout is
+// specified in minutes.
+func (c *Condition) timeoutDuration() time.Duration {
+	return time.Duration(c.Timeout * float64(time.Minute))
+}
+
+// noUpdateActive returns true if no matching point has been seen
+// within the condition timeout.
+func (c *Condition) noUpdateActive(st *conditionState, t time.Time) bool {
+	return t.Sub(st.lastUpdate) >= c.timeoutDuration()
+}
+
+// pointMatch returns true if the point matches the node ID, point type, and
+// point key qualifiers of the condition.
+func (c *Condition) pointMatch(nodeID string, p data.Point) bool {
+	if c.NodeID != "" && c.NodeID != nodeID {
+		return false
+	}
+
+	if c.PointKey != "" && c.PointKey != p.Key {
+		return false
+	}
+
+	if c.PointType != "" && c.PointType != p.Type {
+		return false
+	}
+
+	return true
+}
+
+// nextEvent returns the next time the condition needs to be evaluated
+// even if no points arrive. ok is false if there is no pending event.
+func (c *Condition) nextEvent(st *conditionState) (t time.Time, ok bool) {
+	switch c.ConditionType {
+	case data.PointValueNoUpdate:
+		if !c.Active && c.Timeout > 0 {
+			return st.lastUpdate.Add(c.timeoutDuration()), true
+		}
+	default:
+		if st.rawActive && !c.Active && c.MinActive > 0 {
+			return st.rawActiveStart.Add(c.minActiveDuration()), true
+		}
+	}
+
+	return time.Time{}, false
+}
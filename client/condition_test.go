@@ -0,0 +1,221 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestConditionNumberHysteresis(t *testing.T) {
+	c := Condition{
+		Operator:   data.PointValueGreaterThan,
+		Value:      80,
+		Hysteresis: 5,
+	}
+
+	tests := []struct {
+		v        float64
+		expected bool
+	}{
+		{70, false},
+		{80, false},
+		{81, true},
+		// stays active until value drops below 80 - 5
+		{79, true},
+		{76, true},
+		{75, false},
+		{79, false},
+		{81, true},
+	}
+
+	active := false
+	for _, test := range tests {
+		active = c.numberActive(test.v, active)
+		if active != test.expected {
+			t.Errorf("value %v: expected %v", test.v, test.expected)
+		}
+	}
+}
+
+func TestConditionNumberLessThanHysteresis(t *testing.T) {
+	c := Condition{
+		Operator:   data.PointValueLessThan,
+		Value:      10,
+		Hysteresis: 2,
+	}
+
+	tests := []struct {
+		v        float64
+		expected bool
+	}{
+		{11, false},
+		{9, true},
+		{11, true},
+		{12, false},
+	}
+
+	active := false
+	for _, test := range tests {
+		active = c.numberActive(test.v, active)
+		if active != test.expected {
+			t.Errorf("value %v: expected %v", test.v, test.expected)
+		}
+	}
+}
+
+func TestConditionNumberDeadband(t *testing.T) {
+	c := Condition{
+		Operator: data.PointValueGreaterThan,
+		Value:    50,
+		Deadband: 1,
+	}
+
+	tests := []struct {
+		v        float64
+		expected bool
+	}{
+		{50.5, false},
+		{51.5, true},
+		{49.5, true},
+		{48.5, false},
+	}
+
+	active := false
+	for _, test := range tests {
+		active = c.numberActive(test.v, active)
+		if active != test.expected {
+			t.Errorf("value %v: expected %v", test.v, test.expected)
+		}
+	}
+
+	c = Condition{
+		Operator: data.PointValueEqual,
+		Value:    50,
+		Deadband: 0.1,
+	}
+
+	if !c.numberActive(50.05, false) {
+		t.Error("expected value within deadband to be equal")
+	}
+
+	if c.numberActive(50.2, false) {
+		t.Error("expected value outside deadband to not be equal")
+	}
+}
+
+func TestConditionMinActive(t *testing.T) {
+	c := Condition{
+		MinActive: 1,
+	}
+
+	start := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	st := conditionState{rawActive: true, rawActiveStart: start}
+
+	if c.applyMinActive(&st, start.Add(30*time.Second)) {
+		t.Error("condition should not be active before minActive")
+	}
+
+	next, ok := c.nextEvent(&st)
+	if !ok || !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected next event: %v, %v", next, ok)
+	}
+
+	if !c.applyMinActive(&st, start.Add(time.Minute)) {
+		t.Error("condition should be active after minActive")
+	}
+
+	st.rawActive = false
+	if c.applyMinActive(&st, start.Add(2*time.Minute)) {
+		t.Error("condition should not be active when raw state is inactive")
+	}
+}
+
+func TestConditionNoUpdate(t *testing.T) {
+	c := Condition{
+		ConditionType: data.PointValueNoUpdate,
+		Timeout:       5,
+	}
+
+	last := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+	st := conditionState{lastUpdate: last}
+
+	if c.noUpdateActive(&st, last.Add(4*time.Minute)) {
+		t.Error("condition should not be active before timeout")
+	}
+
+	next, ok := c.nextEvent(&st)
+	if !ok || !next.Equal(last.Add(5*time.Minute)) {
+		t.Errorf("unexpected next event: %v, %v", next, ok)
+	}
+
+	if !c.noUpdateActive(&st, last.Add(5*time.Minute)) {
+		t.Error("condition should be active after timeout")
+	}
+
+	c.Active = true
+	if _, ok := c.nextEvent(&st); ok {
+		t.Error("active condition should not have a pending event")
+	}
+}
+
+func TestConditionStatistic(t *testing.T) {
+	c := Condition{
+		Operator:  data.PointValueLessThan,
+		Value:     -2.0 / 60,
+		Statistic: data.PointValueRate,
+		Window:    1,
+	}
+
+	start := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+	st := conditionState{}
+
+	// pressure dropping 1 psi every 10 seconds (6 psi/min)
+	var active bool
+	for i := 0; i < 4; i++ {
+		p := data.Point{Time: start.Add(time.Duration(i) * 10 * time.Second),
+			Value: 100 - float64(i)}
+		v, ok, err := c.statValue(&st, p)
+		if err != nil {
+			t.Fatal("statValue error: ", err)
+		}
+		if i == 0 && ok {
+			t.Error("rate should not be valid with one point")
+		}
+		if ok {
+			active = c.numberActive(v, active)
+		}
+	}
+
+	if !active {
+		t.Error("expected condition to be active for falling pressure")
+	}
+
+	// points without a time are placed at the current time
+	c = Condition{
+		Operator:  data.PointValueGreaterThan,
+		Value:     30,
+		Statistic: data.PointValueAvg,
+		Window:    1,
+	}
+
+	st = conditionState{}
+	for _, p := range []data.Point{{Time: time.Now(), Value: 20}, {Value: 40}} {
+		_, _, err := c.statValue(&st, p)
+		if err != nil {
+			t.Fatal("statValue error: ", err)
+		}
+	}
+
+	if st.window.Len() != 2 || st.window.Avg() != 30 {
+		t.Errorf("expected both points in window, got %v points, avg %v",
+			st.window.Len(), st.window.Avg())
+	}
+
+	c.Window = 0
+
+	if _, _, err := c.statValue(&conditionState{}, data.Point{Value: 40}); err == nil {
+		t.Error("expected error when window is not set")
+	}
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronExpr is a parsed cron expression with the standard 5 fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields can be *, a value, a range (1-5), a step (*/15, 0-30/10), or a
+// comma separated list of these. Months and weekdays can also be
+// specified by name (jan, mon). Sunday is 0 or 7. The @hourly, @daily,
+// @weekly, @monthly, and @yearly shortcuts are also supported.
+type cronExpr struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// day of month and day of week are or'd if both are restricted
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri",
+		"sat"}},
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(expr string) (*cronExpr, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	if s, ok := cronShortcuts[expr]; ok {
+		expr = s
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron: expected %v fields, got %v: %v",
+			len(cronFields), len(fields), expr)
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		var err error
+		bits[i], err = cronFields[i].parse(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &cronExpr{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+
+	// 7 is also Sunday
+	if ret.dow&(1<<7) != 0 {
+		ret.dow |= 1
+	}
+
+	return ret, nil
+}
+
+func (cf cronField) value(s string) (int, error) {
+	for i, n := range cf.names {
+		if s == n {
+			return i + cf.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid %v: %v", cf.name, s)
+	}
+
+	if v < cf.min || v > cf.max {
+		return 0, fmt.Errorf("cron: %v out of range: %v", cf.name, s)
+	}
+
+	return v, nil
+}
+
+func (cf cronField) parse(s string) (uint64, error) {
+	var ret uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rng, stepS, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepS)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("cron: invalid %v step: %v", cf.name, part)
+			}
+		}
+
+		var start, end int
+		switch {
+		case rng == "*":
+			start, end = cf.min, cf.max
+		case strings.Contains(rng, "-"):
+			startS, endS, _ := strings.Cut(rng, "-")
+			var err error
+			start, err = cf.value(startS)
+			if err != nil {
+				return 0, err
+			}
+			end, err = cf.value(endS)
+			if err != nil {
+				return 0, err
+			}
+			if end < start {
+				return 0, fmt.Errorf("cron: invalid %v range: %v", cf.name, part)
+			}
+		default:
+			var err error
+			start, err = cf.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			// 5/15 means starting at 5, every 15
+			if hasStep {
+				end = cf.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			ret |= 1 << uint(v)
+		}
+	}
+
+	return ret, nil
+}
+
+// match returns true if the minute containing t matches the expression.
+// Fields are matched against the wall clock of t.
+func (c *cronExpr) match(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	// standard cron behavior: if both day fields are restricted, either
+	// can match
+	if !c.domStar && !c.dowStar {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
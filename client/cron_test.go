@@ -0,0 +1,69 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronMatch(t *testing.T) {
+	tests := []struct {
+		expr     string
+		t        time.Time
+		expected bool
+	}{
+		// 2021-08-09 is a Monday
+		{"*/15 * * * mon-fri", time.Date(2021, time.August, 9, 10, 15, 0, 0, time.UTC), true},
+		{"*/15 * * * mon-fri", time.Date(2021, time.August, 9, 10, 16, 0, 0, time.UTC), false},
+		{"*/15 * * * mon-fri", time.Date(2021, time.August, 8, 10, 15, 0, 0, time.UTC), false},
+		{"30 6 * * *", time.Date(2021, time.August, 9, 6, 30, 59, 0, time.UTC), true},
+		{"30 6 * * *", time.Date(2021, time.August, 9, 6, 31, 0, 0, time.UTC), false},
+		{"0 8-17/3 * * *", time.Date(2021, time.August, 9, 14, 0, 0, 0, time.UTC), true},
+		{"0 8-17/3 * * *", time.Date(2021, time.August, 9, 15, 0, 0, 0, time.UTC), false},
+		{"0,30 * * jun-aug *", time.Date(2021, time.August, 9, 3, 30, 0, 0, time.UTC), true},
+		{"0,30 * * jun-aug *", time.Date(2021, time.September, 9, 3, 30, 0, 0, time.UTC), false},
+		{"5/20 * * * *", time.Date(2021, time.August, 9, 3, 45, 0, 0, time.UTC), true},
+		{"5/20 * * * *", time.Date(2021, time.August, 9, 3, 0, 0, 0, time.UTC), false},
+		// Sunday as 7
+		{"0 0 * * 7", time.Date(2021, time.August, 8, 0, 0, 0, 0, time.UTC), true},
+		// day of month or day of week if both are restricted
+		{"0 0 1 * mon", time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 1 * mon", time.Date(2021, time.August, 9, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 1 * mon", time.Date(2021, time.August, 10, 0, 0, 0, 0, time.UTC), false},
+		{"@daily", time.Date(2021, time.August, 10, 0, 0, 0, 0, time.UTC), true},
+		{"@hourly", time.Date(2021, time.August, 10, 5, 1, 0, 0, time.UTC), false},
+	}
+
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("error parsing %v: %v", test.expr, err)
+			continue
+		}
+
+		if c.match(test.t) != test.expected {
+			t.Errorf("%v: expected %v for time %v", test.expr, test.expected, test.t)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-2 * * * *",
+		"* * * * funday",
+	}
+
+	for _, expr := range invalid {
+		_, err := parseCron(expr)
+		if err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
 )
 
 // Dump converts displays a NATS message
@@ -22,7 +23,8 @@ func Dump(nc *nats.Conn, msg *nats.Msg) error {
 	return nil
 }
 
-// String converts a NATS message to a string
+// String converts a NATS message to a string. The text of secret points is
+// redacted.
 func String(nc *nats.Conn, msg *nats.Msg) (string, error) {
 	ret := ""
 
@@ -64,7 +66,7 @@ func String(nc *nats.Conn, msg *nats.Msg) (string, error) {
 			return "", err
 		}
 
-		for _, p := range points {
+		for _, p := range data.Points(points).Redact() {
 			ret += fmt.Sprintf("   - %v: %v\n", pointLabel, p)
 		}
 	}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Notification is the state of the last notification sent by a rule.
+// It is stored in a notification node under the rule so that it can be
+// acknowledged and escalated.
+type Notification struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	SourceNode  string `point:"sourceNode"`
+	Subject     string `point:"subject"`
+	Message     string `point:"message"`
+	Severity    string `point:"severity"`
+	// SendTime and AckTime are RFC3339 timestamps
+	SendTime string `point:"sendTime"`
+	// Level is the number of escalations that have been sent
+	Level   int    `point:"level"`
+	AckBy   string `point:"ackBy"`
+	AckTime string `point:"ackTime"`
+}
+
+// Escalation describes who is notified if a rule notification is not
+// acknowledged within Timeout minutes of when it was sent.
+type Escalation struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// NodeID is the user or group node that is notified
+	NodeID  string  `point:"nodeID"`
+	Timeout float64 `point:"timeout"`
+}
+
+func (e Escalation) String() string {
+	return fmt.Sprintf("ESCALATION: %v  N:%v  T:%v\n", e.Description, e.NodeID, e.Timeout)
+}
+
+// hasNotifyAction returns true if the rule has any notify actions
+func (rc *RuleClient) hasNotifyAction() bool {
+	for _, actions := range [][]Action{rc.config.Actions, rc.config.ActionsInactive} {
+		for _, a := range actions {
+			if a.Action == data.PointValueNotify {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// createNotification creates the notification node of the rule. The node is
+// a child of the rule, so the Manager restarts this client when it is
+// created, which loses pending actions, condition state, and escalations.
+// The node is therefore created when the rule starts, before there is any
+// state to lose, and not when the first notification is sent.
+func (rc *RuleClient) createNotification(id string, pts data.Points) error {
+	return SendNode(rc.nc, data.NodeEdge{
+		ID:     id,
+		Type:   data.NodeTypeNotification,
+		Parent: rc.config.ID,
+		Points: pts,
+	}, rc.config.ID)
+}
+
+// notificationSent records the state of a new notification in the
+// notification node of the rule.
+func (rc *RuleClient) notificationSent(n data.Notification, triggerNodeID string) error {
+	now := time.Now()
+
+	pts := data.Points{
+		{Type: data.PointTypeDescription, Text: rc.config.Description},
+		{Type: data.PointTypeSourceNode, Text: triggerNodeID},
+		{Type: data.PointTypeSubject, Text: n.Subject},
+		{Type: data.PointTypeMessage, Text: n.Message},
+		{Type: data.PointTypeSeverity, Text: n.Severity},
+		{Type: data.PointTypeSendTime, Text: now.Format(time.RFC3339Nano)},
+		{Type: data.PointTypeLevel, Value: 0},
+		{Type: data.PointTypeAckBy, Text: ""},
+		{Type: data.PointTypeAckTime, Text: ""},
+	}
+
+	for i := range pts {
+		pts[i].Time = now
+		pts[i].Origin = rc.config.ID
+	}
+
+	if len(rc.config.Notifications) < 1 {
+		// the node could not be created when the rule started, so
+		// create it now even though this restarts the rule
+		return rc.createNotification(n.ID, pts)
+	}
+
+	ns := &rc.config.Notifications[0]
+	err := data.MergePoints(ns.ID, pts, ns)
+	if err != nil {
+		return err
+	}
+
+	return SendNodePoints(rc.nc, ns.ID, pts, true)
+}
+
+// ackNotification acknowledges the notification of the rule, which stops any
+// further escalation. Acks are processed in the run loop, so a notification
+// can only be acknowledged once, and an ack can't be lost when a new
+// notification is sent at the same time.
+func (rc *RuleClient) ackNotification(userID string) error {
+	if len(rc.config.Notifications) < 1 {
+		return errors.New("rule has no notification")
+	}
+
+	ns := &rc.config.Notifications[0]
+
+	if ns.AckBy != "" {
+		return fmt.Errorf("notification already acknowledged by %v", ns.AckBy)
+	}
+
+	if userID == "" {
+		userID = "unknown"
+	}
+
+	now := time.Now()
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeAckBy, Text: userID, Origin: rc.config.ID},
+		{Time: now, Type: data.PointTypeAckTime, Text: now.Format(time.RFC3339Nano),
+			Origin: rc.config.ID},
+	}
+
+	err := data.MergePoints(ns.ID, pts, ns)
+	if err != nil {
+		return err
+	}
+
+	return SendNodePoints(rc.nc, ns.ID, pts, true)
+}
+
+// notificationID returns the ID used for notifications sent by this rule.
+// As the notification node is reused, acks always apply to the last
+// notification sent.
+func (rc *RuleClient) notificationID() string {
+	if len(rc.config.Notifications) > 0 {
+		return rc.config.Notifications[0].ID
+	}
+	return uuid.New().String()
+}
+
+// isNotification returns true if id is a notification node of this rule
+func (rc *RuleClient) isNotification(id string) bool {
+	for _, n := range rc.config.Notifications {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// escalations returns escalations ordered by timeout
+func (rc *RuleClient) escalations() []Escalation {
+	ret := make([]Escalation, len(rc.config.Escalations))
+	copy(ret, rc.config.Escalations)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Timeout < ret[j].Timeout
+	})
+	return ret
+}
+
+// nextEscalation returns the time the next escalation is due. ok is false if
+// the notification has been acknowledged or there are no more escalations.
+func (rc *RuleClient) nextEscalation() (next time.Time, ok bool) {
+	if len(rc.config.Notifications) < 1 {
+		return time.Time{}, false
+	}
+
+	ns := rc.config.Notifications[0]
+	if ns.AckBy != "" || ns.SendTime == "" {
+		return time.Time{}, false
+	}
+
+	escalations := rc.escalations()
+	if ns.Level >= len(escalations) {
+		return time.Time{}, false
+	}
+
+	sendTime, err := time.Parse(time.RFC3339Nano, ns.SendTime)
+	if err != nil {
+		log.Println("Rule notification send time is not valid:", ns.SendTime)
+		return time.Time{}, false
+	}
+
+	timeout := time.Duration(escalations[ns.Level].Timeout * float64(time.Minute))
+
+	return sendTime.Add(timeout), true
+}
+
+// escalate sends any escalations that are due
+func (rc *RuleClient) escalate() {
+	escalations := rc.escalations()
+
+	for {
+		next, ok := rc.nextEscalation()
+		if !ok || time.Now().Before(next) {
+			return
+		}
+
+		ns := &rc.config.Notifications[0]
+		e := escalations[ns.Level]
+
+		if e.NodeID == "" {
+			log.Printf("Rule %v escalation %v node ID is not set\n",
+				rc.config.Description, e.Description)
+		} else {
+			n := data.Notification{
+				ID:         ns.ID,
+				SourceNode: ns.SourceNode,
+				Subject:    ns.Subject,
+				Message:    ns.Message,
+				Severity:   ns.Severity,
+			}
+
+			d, err := n.ToPb()
+			if err != nil {
+				log.Println("Rule error encoding notification:", err)
+				return
+			}
+
+			err = rc.nc.Publish(SubjectNodeEscalation(e.NodeID), d)
+			if err != nil {
+				log.Println("Rule error publishing escalation:", err)
+				return
+			}
+		}
+
+		ns.Level++
+
+		err := rc.sendPoint(ns.ID, data.Point{
+			Type:  data.PointTypeLevel,
+			Time:  time.Now(),
+			Value: float64(ns.Level),
+		})
+		if err != nil {
+			log.Println("Rule error sending escalation level:", err)
+		}
+	}
+}
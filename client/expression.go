@@ -0,0 +1,707 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// expression is a parsed rule setpoint expression. The language is small
+// and safe to evaluate: there are no loops, assignments, or access to
+// anything other than the values provided by the environment.
+//
+// Values are numbers, strings, booleans, and objects. Supported syntax:
+//
+//	literals:    1.5, 2e3, "text", 'text', true, false
+//	arithmetic:  + - * / % and unary -  (+ also joins strings)
+//	comparison:  == != < <= > >=
+//	logic:       && || !  and  cond ? a : b
+//	access:      trigger.value, node["id"].temp, node["id"]["temp.1"]
+//	functions:   min, max, abs, round, floor, ceil, clamp(x, lo, hi)
+type expression struct {
+	src  string
+	root exprNode
+}
+
+// exprEnv provides the values an expression is evaluated over
+type exprEnv struct {
+	// vars are the top level identifiers, for instance trigger
+	vars map[string]any
+	// node returns an object with the points of a node
+	node func(id string) (map[string]any, error)
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (any, error)
+}
+
+func parseExpression(src string) (*expression, error) {
+	tokens, err := exprTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != exprTokEOF {
+		return nil, fmt.Errorf("expression: unexpected %q at %v", t.text, t.pos)
+	}
+
+	return &expression{src: src, root: root}, nil
+}
+
+// eval evaluates the expression. The result is a float64, string, or bool.
+func (e *expression) eval(env *exprEnv) (any, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("expression: result is not a number: %v", v)
+		}
+		return v, nil
+	case string, bool:
+		return v, nil
+	default:
+		return nil, errors.New("expression: result must be a number, string, or bool")
+	}
+}
+
+// tokenizer
+
+type exprTokKind int
+
+const (
+	exprTokEOF exprTokKind = iota
+	exprTokNumber
+	exprTokString
+	exprTokIdent
+	exprTokOp
+)
+
+type exprToken struct {
+	kind exprTokKind
+	text string
+	pos  int
+}
+
+var exprOps = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")", "[", "]",
+	".", ",",
+}
+
+func exprTokenize(src string) ([]exprToken, error) {
+	var ret []exprToken
+	i := 0
+
+outer:
+	for i < len(src) {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' ||
+			c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+					i++
+				}
+			}
+			ret = append(ret, exprToken{exprTokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var b strings.Builder
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("expression: unterminated string at %v", start)
+				}
+				if rune(src[i]) == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			ret = append(ret, exprToken{exprTokString, b.String(), start})
+		case exprIdentChar(src[i], false):
+			start := i
+			for i < len(src) && exprIdentChar(src[i], true) {
+				i++
+			}
+			ret = append(ret, exprToken{exprTokIdent, src[start:i], start})
+		default:
+			for _, op := range exprOps {
+				if strings.HasPrefix(src[i:], op) {
+					ret = append(ret, exprToken{exprTokOp, op, i})
+					i += len(op)
+					continue outer
+				}
+			}
+			return nil, fmt.Errorf("expression: unexpected character %q at %v", c, i)
+		}
+	}
+
+	return append(ret, exprToken{exprTokEOF, "end of expression", len(src)}), nil
+}
+
+func exprIdentChar(c byte, digit bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		digit && c >= '0' && c <= '9'
+}
+
+// parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != exprTokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != exprTokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		return fmt.Errorf("expression: expected %q at %v, got %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *exprParser) ternary() (exprNode, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+
+	a, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+
+	b, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &exprTernary{cond, a, b}, nil
+}
+
+// binary operators by increasing precedence
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) binary(level int) (exprNode, error) {
+	if level >= len(exprPrecedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept(exprPrecedence[level]...)
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &exprBinary{op, left, right}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op, x}, nil
+	}
+
+	return p.postfix()
+}
+
+func (p *exprParser) postfix() (exprNode, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch op, _ := p.accept(".", "[", "("); op {
+		case ".":
+			t := p.next()
+			if t.kind != exprTokIdent {
+				return nil, fmt.Errorf("expression: expected field name at %v", t.pos)
+			}
+			x = &exprIndex{x, &exprLiteral{t.text}}
+		case "[":
+			i, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &exprIndex{x, i}
+		case "(":
+			ident, ok := x.(*exprIdent)
+			if !ok {
+				return nil, errors.New("expression: only functions can be called")
+			}
+			var args []exprNode
+			if _, ok := p.accept(")"); !ok {
+				for {
+					a, err := p.ternary()
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, a)
+					if _, ok := p.accept(","); !ok {
+						break
+					}
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+			}
+			x = &exprCall{ident.name, args}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.next()
+
+	switch t.kind {
+	case exprTokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expression: invalid number %q at %v", t.text, t.pos)
+		}
+		return &exprLiteral{v}, nil
+	case exprTokString:
+		return &exprLiteral{t.text}, nil
+	case exprTokIdent:
+		switch t.text {
+		case "true":
+			return &exprLiteral{true}, nil
+		case "false":
+			return &exprLiteral{false}, nil
+		}
+		return &exprIdent{t.text}, nil
+	case exprTokOp:
+		if t.text == "(" {
+			x, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+
+	return nil, fmt.Errorf("expression: unexpected %q at %v", t.text, t.pos)
+}
+
+// evaluation
+
+type exprLiteral struct {
+	v any
+}
+
+func (e *exprLiteral) eval(_ *exprEnv) (any, error) {
+	return e.v, nil
+}
+
+type exprIdent struct {
+	name string
+}
+
+func (e *exprIdent) eval(env *exprEnv) (any, error) {
+	if e.name == "node" {
+		return exprNodeRef{}, nil
+	}
+
+	v, ok := env.vars[e.name]
+	if !ok {
+		return nil, fmt.Errorf("expression: unknown name: %v", e.name)
+	}
+	return v, nil
+}
+
+// exprNodeRef is the value of the node identifier, which is indexed by
+// node ID
+type exprNodeRef struct{}
+
+type exprIndex struct {
+	x     exprNode
+	index exprNode
+}
+
+func (e *exprIndex) eval(env *exprEnv) (any, error) {
+	x, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := e.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := i.(string)
+	if !ok {
+		return nil, fmt.Errorf("expression: index must be a string: %v", i)
+	}
+
+	switch x := x.(type) {
+	case exprNodeRef:
+		if env.node == nil {
+			return nil, errors.New("expression: node values are not available")
+		}
+		return env.node(key)
+	case map[string]any:
+		v, ok := x[key]
+		if !ok {
+			return nil, fmt.Errorf("expression: field not found: %v", key)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expression: cannot get field %v of %v", key, x)
+	}
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (e *exprUnary) eval(env *exprEnv) (any, error) {
+	x, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "!" {
+		b, err := exprBool(x)
+		if err != nil {
+			return nil, err
+		}
+		return !b, nil
+	}
+
+	v, err := exprNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	return -v, nil
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (e *exprBinary) eval(env *exprEnv) (any, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// logic operators short circuit
+	switch e.op {
+	case "&&", "||":
+		l, err := exprBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if (e.op == "&&" && !l) || (e.op == "||" && l) {
+			return l, nil
+		}
+		right, err := e.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return exprBool(right)
+	}
+
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	}
+
+	// strings can be joined and compared
+	if ls, ok := left.(string); ok {
+		if rs, ok := right.(string); ok {
+			switch e.op {
+			case "+":
+				return ls + rs, nil
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+
+	l, err := exprNumber(left)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := exprNumber(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, errors.New("expression: divide by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, errors.New("expression: divide by zero")
+		}
+		return math.Mod(l, r), nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+
+	return nil, fmt.Errorf("expression: unknown operator %v", e.op)
+}
+
+type exprTernary struct {
+	cond, a, b exprNode
+}
+
+func (e *exprTernary) eval(env *exprEnv) (any, error) {
+	c, err := e.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := exprBool(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if cb {
+		return e.a.eval(env)
+	}
+	return e.b.eval(env)
+}
+
+type exprCall struct {
+	name string
+	args []exprNode
+}
+
+func (e *exprCall) eval(env *exprEnv) (any, error) {
+	args := make([]float64, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i], err = exprNumber(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", e.name, err)
+		}
+	}
+
+	nargs := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("expression: %v expects %v arguments, got %v",
+				e.name, n, len(args))
+		}
+		return nil
+	}
+
+	switch e.name {
+	case "min", "max":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("expression: %v expects at least 1 argument", e.name)
+		}
+		ret := args[0]
+		for _, a := range args[1:] {
+			if (e.name == "min" && a < ret) || (e.name == "max" && a > ret) {
+				ret = a
+			}
+		}
+		return ret, nil
+	case "abs", "round", "floor", "ceil":
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		f := map[string]func(float64) float64{
+			"abs":   math.Abs,
+			"round": math.Round,
+			"floor": math.Floor,
+			"ceil":  math.Ceil,
+		}[e.name]
+		return f(args[0]), nil
+	case "clamp":
+		if err := nargs(3); err != nil {
+			return nil, err
+		}
+		return math.Max(args[1], math.Min(args[2], args[0])), nil
+	}
+
+	return nil, fmt.Errorf("expression: unknown function: %v", e.name)
+}
+
+// exprPoints returns an object with node point values indexed by point
+// type, or type.key for points with a key. Text is used for points that
+// have it.
+func exprPoints(points data.Points) map[string]any {
+	ret := make(map[string]any)
+
+	for _, p := range points {
+		if p.Tombstone != 0 || p.Type == "" {
+			continue
+		}
+
+		if p.Text != "" {
+			ret[pointMapKey(p)] = p.Text
+		} else {
+			ret[pointMapKey(p)] = p.Value
+		}
+	}
+
+	return ret
+}
+
+// conversions
+
+func exprNumber(v any) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expression: not a number: %v", v)
+}
+
+func exprBool(v any) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	}
+	return false, fmt.Errorf("expression: not a bool: %v", v)
+}
+
+func exprEqual(a, b any) bool {
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		return ok && as == bs
+	}
+
+	an, errA := exprNumber(a)
+	bn, errB := exprNumber(b)
+	return errA == nil && errB == nil && an == bn
+}
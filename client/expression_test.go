@@ -0,0 +1,132 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func testExprEnv() *exprEnv {
+	nodes := map[string]map[string]any{
+		"abc": exprPoints(data.Points{
+			{Type: data.PointTypeDescription, Text: "Tank"},
+			{Type: "temp", Value: 20},
+			{Type: "temp", Key: "1", Value: 25},
+		}),
+	}
+
+	return &exprEnv{
+		vars: map[string]any{
+			"trigger": map[string]any{
+				"nodeID": "abc",
+				"type":   "value",
+				"value":  10.0,
+				"text":   "",
+			},
+		},
+		node: func(id string) (map[string]any, error) {
+			n, ok := nodes[id]
+			if !ok {
+				return nil, errors.New("node not found")
+			}
+			return n, nil
+		},
+	}
+}
+
+func TestExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		exp  any
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"-2 * -3", 6.0},
+		{"7 % 4", 3.0},
+		{"1.5e2 / 3", 50.0},
+		{`trigger.value * 0.5 + node["abc"].temp`, 25.0},
+		{`node["abc"]["temp.1"]`, 25.0},
+		{`node[trigger.nodeID].description`, "Tank"},
+		{`"level: " + node["abc"].description`, "level: Tank"},
+		{"trigger.value > 5", true},
+		{"trigger.value > 5 && trigger.value < 8", false},
+		{"!(trigger.value == 10) || false", false},
+		{`trigger.type == "value"`, true},
+		{"trigger.value > 5 ? 100 : 0", 100.0},
+		{"trigger.value > 50 ? 100 : trigger.value < 0 ? -1 : 1", 1.0},
+		{"min(3, trigger.value, 1.5)", 1.5},
+		{"max(3, trigger.value)", 10.0},
+		{"clamp(trigger.value * 20, 0, 100)", 100.0},
+		{"round(2.5) + floor(1.9) + ceil(0.1) + abs(-1)", 6.0},
+	}
+
+	env := testExprEnv()
+
+	for _, test := range tests {
+		e, err := parseExpression(test.expr)
+		if err != nil {
+			t.Errorf("%v: parse error: %v", test.expr, err)
+			continue
+		}
+
+		v, err := e.eval(env)
+		if err != nil {
+			t.Errorf("%v: eval error: %v", test.expr, err)
+			continue
+		}
+
+		if v != test.exp {
+			t.Errorf("%v: expected %v, got %v", test.expr, test.exp, v)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	parseErrors := []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		`"unterminated`,
+		"1 ? 2",
+		"trigger.",
+		"1 2",
+		"3(4)",
+		"a $ b",
+	}
+
+	for _, expr := range parseErrors {
+		_, err := parseExpression(expr)
+		if err == nil {
+			t.Errorf("%q: expected parse error", expr)
+		}
+	}
+
+	evalErrors := []string{
+		"1 / 0",
+		"unknown + 1",
+		`node["xyz"].temp`,
+		`node["abc"].missing`,
+		`"a" * 2`,
+		"trigger",
+		"node",
+		"sqrt(4)",
+		"abs(1, 2)",
+	}
+
+	env := testExprEnv()
+
+	for _, expr := range evalErrors {
+		e, err := parseExpression(expr)
+		if err != nil {
+			t.Errorf("%q: unexpected parse error: %v", expr, err)
+			continue
+		}
+
+		_, err = e.eval(env)
+		if err == nil {
+			t.Errorf("%q: expected eval error", expr)
+		}
+	}
+}
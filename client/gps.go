@@ -0,0 +1,156 @@
+package client
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/gps"
+)
+
+// gpsUpdatePeriod is how often the position is written to the GPS node.
+// Receivers typically report once a second, which is more often than the
+// position is needed.
+const gpsUpdatePeriod = time.Minute
+
+// Gps represents the config of a GPS receiver node. The position read from
+// the receiver is written to the node as latitude and longitude points, so a
+// GPS node can be used as the location of sun schedule conditions.
+type Gps struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	Port        string  `point:"port"`
+	Baud        string  `point:"baud"`
+	Disabled    bool    `point:"disabled"`
+	Latitude    float64 `point:"latitude"`
+	Longitude   float64 `point:"longitude"`
+	Fix         string  `point:"fix"`
+	NumSat      int     `point:"numSat"`
+}
+
+// GpsClient reads a GPS receiver connected to a serial port
+type GpsClient struct {
+	nc        *nats.Conn
+	config    Gps
+	stop      chan struct{}
+	newPoints chan NewPoints
+}
+
+// NewGpsClient constructor
+func NewGpsClient(nc *nats.Conn, config Gps) Client {
+	return &GpsClient{
+		nc:        nc,
+		config:    config,
+		stop:      make(chan struct{}),
+		newPoints: make(chan NewPoints),
+	}
+}
+
+// Run the GPS client. Blocks until Stop is called.
+func (gc *GpsClient) Run() error {
+	positions := make(chan data.GpsPos)
+
+	var receiver *gps.Gps
+
+	start := func() {
+		if gc.config.Disabled || gc.config.Port == "" {
+			return
+		}
+
+		baud, err := strconv.Atoi(gc.config.Baud)
+		if err != nil || baud <= 0 {
+			// NMEA 0183 default
+			baud = 4800
+		}
+
+		receiver = gps.NewGps(gc.config.Port, uint(baud), positions)
+		receiver.Start()
+	}
+
+	stop := func() {
+		if receiver != nil {
+			receiver.Stop()
+			receiver = nil
+		}
+	}
+
+	start()
+
+	var lastSend time.Time
+	hadFix := false
+
+done:
+	for {
+		select {
+		case <-gc.stop:
+			break done
+		case pos := <-positions:
+			hasFix := pos.HasFix()
+
+			// write the position periodically, and right away when the
+			// fix is gained or lost
+			if hasFix == hadFix && time.Since(lastSend) < gpsUpdatePeriod {
+				break
+			}
+
+			hadFix = hasFix
+			lastSend = time.Now()
+
+			pts := pos.ToPoints()
+			if !hasFix {
+				// keep the last known position
+				pts = data.Points{
+					{Type: data.PointTypeFix, Time: lastSend, Text: pos.Fix},
+					{Type: data.PointTypeNumSat, Time: lastSend,
+						Value: float64(pos.NumSat)},
+				}
+			}
+
+			err := SendNodePoints(gc.nc, gc.config.ID, pts, false)
+			if err != nil {
+				log.Println("GPS error sending points:", err)
+			}
+		case pts := <-gc.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &gc.config)
+			if err != nil {
+				log.Println("error merging GPS points:", err)
+			}
+
+			restart := false
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePort, data.PointTypeBaud,
+					data.PointTypeDisabled:
+					restart = true
+				}
+			}
+
+			if restart {
+				stop()
+				start()
+			}
+		}
+	}
+
+	stop()
+
+	return nil
+}
+
+// Stop sends a signal to the Run function to exit
+func (gc *GpsClient) Stop(_ error) {
+	close(gc.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (gc *GpsClient) Points(nodeID string, points []data.Point) {
+	gc.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (gc *GpsClient) EdgePoints(_, _ string, _ []data.Point) {}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// GetHistory runs a history query. nodeID is a database node, or the
+// instance root node for history kept in the store.
+func GetHistory(nc *nats.Conn, nodeID string, query data.HistoryQuery) (data.HistoryResults, error) {
+	reqData, err := json.Marshal(query)
+	if err != nil {
+		return data.HistoryResults{}, err
+	}
+
+	resp, err := nc.Request(SubjectHistory(nodeID), reqData, time.Second*20)
+	if err != nil {
+		return data.HistoryResults{}, err
+	}
+
+	var results data.HistoryResults
+	err = json.Unmarshal(resp.Data, &results)
+	if err != nil {
+		return data.HistoryResults{}, err
+	}
+
+	if results.ErrorMessage != "" {
+		return results, errors.New(results.ErrorMessage)
+	}
+
+	return results, nil
+}
@@ -245,29 +245,21 @@ func (m *Manager[T]) scan(id string) error {
 			continue
 		}
 
-		// Need to create a new client
-		cs, err := newClientState(m.nc, m.construct, n)
-
-		if err != nil {
-			log.Printf("Error starting client %v: %v", n, err)
-		}
-
-		go func() {
-			err := cs.run()
-
-			if err != nil {
-				log.Printf("clientState error %v: %v\n", m.nodeType, err)
+		// Set up subscriptions before reading the node and its children
+		// so that changes made while the client is being created are not
+		// missed. Messages wait until the client is created.
+		var cs *clientState[T]
+		ready := make(chan struct{})
+
+		subject := fmt.Sprintf("up.%v.>", n.ID)
+
+		sub, err := m.nc.Subscribe(subject, func(msg *nats.Msg) {
+			<-ready
+			if cs == nil {
+				// client failed to start
+				return
 			}
 
-			m.chDeleteCS <- key
-		}()
-
-		m.clientStates[key] = cs
-
-		// Set up subscriptions
-		subject := fmt.Sprintf("up.%v.>", cs.node.ID)
-
-		m.clientUpSub[key], err = cs.nc.Subscribe(subject, func(msg *nats.Msg) {
 			points, err := data.PbDecodePoints(msg.Data)
 			if err != nil {
 				log.Println("Error decoding points")
@@ -373,6 +365,30 @@ func (m *Manager[T]) scan(id string) error {
 			return err
 		}
 
+		// Need to create a new client
+		newCS, err := newClientState(m.nc, m.construct, n)
+		if err != nil {
+			log.Printf("Error starting client %v: %v", n, err)
+			close(ready)
+			_ = sub.Unsubscribe()
+			continue
+		}
+
+		cs = newCS
+		close(ready)
+
+		go func() {
+			err := cs.run()
+
+			if err != nil {
+				log.Printf("clientState error %v: %v\n", m.nodeType, err)
+			}
+
+			m.chDeleteCS <- key
+		}()
+
+		m.clientStates[key] = cs
+		m.clientUpSub[key] = sub
 	}
 
 	// remove nodes that have been deleted
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/msg"
+)
+
+// MsgService represents the config of a message service node (Twilio, SMTP, etc)
+type MsgService struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	// Service: twilio, smtp, webhook
+	Service string `point:"service"`
+	// used with twilio
+	SID       string `point:"sid"`
+	AuthToken string `point:"authToken"`
+	// used with twilio (phone number) and smtp (email address)
+	From string `point:"from"`
+	// used with smtp
+	Host     string `point:"host"`
+	Port     int    `point:"port"`
+	StartTLS bool   `point:"startTLS"`
+	Username string `point:"username"`
+	Password string `point:"password"`
+	// used with webhook
+	URI      string            `point:"uri"`
+	Headers  map[string]string `point:"header"`
+	Template string            `point:"template"`
+}
+
+// CanSend returns true if the message has the contact information
+// needed for this service to deliver it.
+func (ms MsgService) CanSend(m data.Message) bool {
+	switch ms.Service {
+	case data.PointValueTwilio:
+		return m.Phone != ""
+	case data.PointValueSMTP:
+		return m.Email != ""
+	}
+
+	// services that are not built in may be implemented by an external
+	// client subscribed to the message service subject, so send them
+	// everything.
+	return true
+}
+
+// MsgServiceClient delivers messages that are routed to a message service
+// node by the [NotificationClient]. Messages are received as requests on the
+// msgService.<id> subject and the reply is blank on success, or contains the
+// error. Service types that are not built in are ignored so that they can be
+// implemented by an external client subscribed to the same subject.
+type MsgServiceClient struct {
+	nc        *nats.Conn
+	config    MsgService
+	stop      chan struct{}
+	newPoints chan NewPoints
+	newMsg    chan *nats.Msg
+}
+
+// NewMsgServiceClient constructor
+func NewMsgServiceClient(nc *nats.Conn, config MsgService) Client {
+	return &MsgServiceClient{
+		nc:        nc,
+		config:    config,
+		stop:      make(chan struct{}),
+		newPoints: make(chan NewPoints),
+		newMsg:    make(chan *nats.Msg),
+	}
+}
+
+// Run the message service client. Blocks until Stop is called.
+func (msc *MsgServiceClient) Run() error {
+	sub, err := msc.nc.Subscribe(SubjectMsgService(msc.config.ID), func(m *nats.Msg) {
+		select {
+		case msc.newMsg <- m:
+		case <-msc.stop:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Msg service subscribe error: %w", err)
+	}
+
+done:
+	for {
+		select {
+		case <-msc.stop:
+			break done
+		case m := <-msc.newMsg:
+			if !msc.builtIn() {
+				// leave the reply to an external client implementing
+				// this service
+				break
+			}
+
+			// delivery can take a while (SMTP and HTTP requests), so
+			// it is done in the background with a copy of the config
+			// so this client can still process config changes and stop
+			go msc.deliver(msc.config.copy(), m)
+		case pts := <-msc.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &msc.config)
+			if err != nil {
+				log.Println("error merging msg service points:", err)
+			}
+		}
+	}
+
+	return sub.Unsubscribe()
+}
+
+// builtIn returns true if the service is implemented by this client
+func (msc *MsgServiceClient) builtIn() bool {
+	switch msc.config.Service {
+	case data.PointValueTwilio, data.PointValueSMTP, data.PointValueWebhook:
+		return true
+	}
+	return false
+}
+
+// deliver sends a message with the service config and replies with the result
+func (msc *MsgServiceClient) deliver(config MsgService, m *nats.Msg) {
+	reply := ""
+	err := config.send(m)
+	if err != nil {
+		log.Printf("Msg service %v error: %v\n", config.Description, err)
+		reply = err.Error()
+	}
+
+	if m.Reply != "" {
+		err := msc.nc.Publish(m.Reply, []byte(reply))
+		if err != nil {
+			log.Println("Msg service error sending reply:", err)
+		}
+	}
+}
+
+// copy returns a copy of the config that does not share the headers map
+func (ms MsgService) copy() MsgService {
+	if ms.Headers != nil {
+		headers := make(map[string]string, len(ms.Headers))
+		for k, v := range ms.Headers {
+			headers[k] = v
+		}
+		ms.Headers = headers
+	}
+
+	return ms
+}
+
+// send delivers a message received on the msgService subject
+func (ms MsgService) send(m *nats.Msg) error {
+	message, err := data.PbDecodeMessage(m.Data)
+	if err != nil {
+		return fmt.Errorf("error decoding message: %w", err)
+	}
+
+	if ms.Disabled {
+		return errors.New("message service is disabled")
+	}
+
+	switch ms.Service {
+	case data.PointValueTwilio:
+		if message.Phone == "" {
+			return errors.New("user does not have a phone number")
+		}
+
+		twilio := msg.NewTwilio(ms.SID, ms.AuthToken, ms.From)
+		return twilio.SendSMS(message.Phone, message.Message)
+	case data.PointValueSMTP:
+		if message.Email == "" {
+			return errors.New("user does not have an email address")
+		}
+
+		smtp := msg.NewSMTP(msg.SMTPConfig{
+			Host:     ms.Host,
+			Port:     ms.Port,
+			StartTLS: ms.StartTLS,
+			Username: ms.Username,
+			Password: ms.Password,
+			From:     ms.From,
+			// reply before the SendMessage request times out
+			Timeout: 15 * time.Second,
+		})
+
+		subject := message.Subject
+		if subject == "" {
+			subject = "SIOT notification"
+		}
+
+		return smtp.SendEmail(message.Email, subject, message.Message)
+	case data.PointValueWebhook:
+		return sendWebhook(ms.URI, ms.Headers, ms.Template,
+			WebhookData{
+				UserID:  message.UserID,
+				Subject: message.Subject,
+				Message: message.Message,
+				Email:   message.Email,
+				Phone:   message.Phone,
+				Time:    time.Now(),
+			})
+	default:
+		return fmt.Errorf("unsupported message service: %v", ms.Service)
+	}
+}
+
+// Stop sends a signal to the Run function to exit
+func (msc *MsgServiceClient) Stop(_ error) {
+	close(msc.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (msc *MsgServiceClient) Points(nodeID string, points []data.Point) {
+	msc.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (msc *MsgServiceClient) EdgePoints(_, _ string, _ []data.Point) {}
@@ -454,11 +454,11 @@ type SiotExport struct {
 //	    - type: phone
 //	    - type: email
 //	      text: admin@admin.com
-//	    - type: pass
-//	      text: admin
 //
 // Key="0" and Tombstone points with value set to 0 are removed from the export to make
-// it easier to read.
+// it easier to read. Passwords and other secret points (see
+// data.SecretPointTypes) are never exported, so imported users must have
+// their password set again, and auth tokens must be entered again.
 func ExportNodes(nc *nats.Conn, id string) ([]byte, error) {
 	if id == "root" || id == "" {
 		root, err := GetRootNode(nc)
@@ -500,12 +500,22 @@ func exportNodesHelper(nc *nats.Conn, node *data.NodeEdgeChildren) error {
 	// reduce a little noise ...
 	// remove tombstone "0" edge points as that does not convey much information
 	// also remove and key="0" fields in points
-	for i, p := range node.Points {
+	// also remove passwords and other secrets
+	node.EdgePoints = node.EdgePoints.RemoveSecrets()
+	j := 0
+	for _, p := range node.Points {
+		if p.IsSecret() {
+			continue
+		}
 		if p.Key == "0" {
-			node.Points[i].Key = ""
+			p.Key = ""
 		}
+		node.Points[j] = p
+		j++
 	}
 
+	node.Points = node.Points[:j]
+
 	for i, p := range node.EdgePoints {
 		if p.Key == "0" {
 			node.EdgePoints[i].Key = ""
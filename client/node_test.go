@@ -49,6 +49,12 @@ func TestExportNodes(t *testing.T) {
 	if exp.Nodes[0].Children[0].Type != data.NodeTypeUser {
 		t.Fatal("child node is not user type")
 	}
+
+	for _, p := range exp.Nodes[0].Children[0].Points {
+		if p.IsSecret() {
+			t.Fatal("secret points should not be exported: ", p.Type)
+		}
+	}
 }
 
 var testImportNodesYaml = `
@@ -0,0 +1,562 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// NotificationClient processes notifications. When a notification is
+// received on node.<id>.not, the node tree is walked upstream to find user
+// nodes, and a message is generated for each user on node.<userID>.msg.
+// Escalations received on node.<id>.esc are only sent to the user, or the
+// users directly in the group.
+// Messages are then routed to the nearest message service nodes (upstream
+// of the user) that can deliver the message. User preferences (severity,
+// preferred channel, and quiet hours) are applied when messages are
+// generated.
+type NotificationClient struct {
+	nc   *nats.Conn
+	stop chan struct{}
+
+	// messages deferred until the end of a user's quiet hours, indexed by
+	// user and notification ID
+	deferredLock sync.Mutex
+	deferred     map[string]*time.Timer
+}
+
+// NewNotificationClient constructor
+func NewNotificationClient(nc *nats.Conn) *NotificationClient {
+	return &NotificationClient{
+		nc:       nc,
+		stop:     make(chan struct{}),
+		deferred: make(map[string]*time.Timer),
+	}
+}
+
+// Run the notification client. Blocks until Stop is called.
+func (n *NotificationClient) Run() error {
+	notSub, err := n.nc.Subscribe(SubjectNodeNotification("*"), n.handleNotification)
+	if err != nil {
+		return fmt.Errorf("Subscribe notification error: %w", err)
+	}
+
+	escSub, err := n.nc.Subscribe(SubjectNodeEscalation("*"), n.handleEscalation)
+	if err != nil {
+		_ = notSub.Unsubscribe()
+		return fmt.Errorf("Subscribe escalation error: %w", err)
+	}
+
+	msgSub, err := n.nc.Subscribe(SubjectNodeMessage("*"), n.handleMessage)
+	if err != nil {
+		_ = notSub.Unsubscribe()
+		_ = escSub.Unsubscribe()
+		return fmt.Errorf("Subscribe message error: %w", err)
+	}
+
+	err = n.loadDeferred()
+	if err != nil {
+		log.Println("Error loading deferred messages:", err)
+	}
+
+	<-n.stop
+
+	err = errors.Join(notSub.Unsubscribe(), escSub.Unsubscribe(), msgSub.Unsubscribe())
+
+	n.deferredLock.Lock()
+	for _, t := range n.deferred {
+		t.Stop()
+	}
+	n.deferred = make(map[string]*time.Timer)
+	n.deferredLock.Unlock()
+
+	return err
+}
+
+// Stop the notification client
+func (n *NotificationClient) Stop(_ error) {
+	close(n.stop)
+}
+
+// finding users makes a request for each node up the tree, so notifications
+// are processed in the background to not block the subscription
+func (n *NotificationClient) handleNotification(msg *nats.Msg) {
+	go n.notify(msg, true)
+}
+
+func (n *NotificationClient) handleEscalation(msg *nats.Msg) {
+	go n.notify(msg, false)
+}
+
+// notify generates messages for a notification. If upstream is false, users
+// in upstream nodes are not notified.
+func (n *NotificationClient) notify(msg *nats.Msg, upstream bool) {
+	nodeID, err := subjectNodeID(msg.Subject)
+	if err != nil {
+		log.Println("Notification:", err)
+		return
+	}
+
+	not, err := data.PbDecodeNotification(msg.Data)
+	if err != nil {
+		log.Println("Error decoding Pb notification:", err)
+		return
+	}
+
+	users, err := n.findUsers(nodeID, upstream)
+	if err != nil {
+		log.Println("Error finding users for notification:", err)
+		return
+	}
+
+	for _, user := range users {
+		if user.MinSeverity != "" &&
+			severityLevel(not.Severity) < severityLevel(user.MinSeverity) {
+			continue
+		}
+
+		m := data.Message{
+			ID:             uuid.New().String(),
+			UserID:         user.ID,
+			ParentID:       user.Parent,
+			NotificationID: not.ID,
+			Email:          user.Email,
+			Phone:          user.Phone,
+			Subject:        not.Subject,
+			Message:        not.Message,
+		}
+
+		m = user.contactMessage(m)
+
+		if m.Email == "" && m.Phone == "" && user.PreferredChannel != data.PointValueWebhook {
+			continue
+		}
+
+		if severityLevel(not.Severity) < severityLevel(data.PointValueCritical) {
+			user.QuietHours, err = GetNodesType[QuietHours](n.nc, user.ID, "all")
+			if err != nil {
+				log.Println("Error getting user quiet hours:", err)
+			}
+
+			if len(user.QuietHours) > 0 && user.Timezone == "" {
+				user.Timezone, err = findTimezone(n.nc, user.Parent)
+				if err != nil {
+					log.Println("Error finding user timezone:", err)
+				}
+			}
+
+			end, quiet, err := user.quietUntil(time.Now())
+			if err != nil {
+				log.Printf("Error in quiet hours for user %v: %v\n", user.ID, err)
+			}
+
+			if quiet {
+				if user.QuietAction != data.PointValueSkip {
+					n.deferMessage(m, end)
+				}
+				continue
+			}
+		}
+
+		n.publishMessage(m)
+	}
+}
+
+func (n *NotificationClient) publishMessage(m data.Message) {
+	d, err := m.ToPb()
+	if err != nil {
+		log.Println("Error serializing msg to protobuf:", err)
+		return
+	}
+
+	err = n.nc.Publish(SubjectNodeMessage(m.UserID), d)
+	if err != nil {
+		log.Println("Error publishing message:", err)
+	}
+}
+
+// deferMessage publishes a message at the end of a user's quiet hours. If
+// the same notification is sent again during quiet hours, only the last one
+// is delivered. Messages for notifications that are acknowledged during quiet
+// hours are dropped. Deferred messages are stored in a point on the user
+// node so they are still delivered if SIOT is restarted.
+func (n *NotificationClient) deferMessage(m data.Message, at time.Time) {
+	n.deferredLock.Lock()
+	defer n.deferredLock.Unlock()
+
+	select {
+	case <-n.stop:
+		// notifications are processed in the background, so this can
+		// run after the client is stopped
+		return
+	default:
+	}
+
+	d, err := json.Marshal(m)
+	if err != nil {
+		log.Println("Error encoding deferred message:", err)
+		return
+	}
+
+	err = SendNodePoint(n.nc, m.UserID, data.Point{
+		Type:  data.PointTypeDeferredMessage,
+		Key:   m.NotificationID,
+		Time:  time.Now(),
+		Value: float64(at.Unix()),
+		Text:  string(d),
+	}, true)
+	if err != nil {
+		log.Println("Error saving deferred message:", err)
+	}
+
+	n.scheduleMessage(m, at)
+}
+
+// scheduleMessage starts a timer to publish a deferred message. deferredLock
+// must be held.
+func (n *NotificationClient) scheduleMessage(m data.Message, at time.Time) {
+	key := m.UserID + ":" + m.NotificationID
+
+	if t, ok := n.deferred[key]; ok {
+		t.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(at), func() {
+		n.deferredLock.Lock()
+		if n.deferred[key] != t {
+			// replaced or client stopped
+			n.deferredLock.Unlock()
+			return
+		}
+		delete(n.deferred, key)
+
+		// remove the stored message before the lock is released so a
+		// message deferred again is not removed
+		err := SendNodePoint(n.nc, m.UserID, data.Point{
+			Type:      data.PointTypeDeferredMessage,
+			Key:       m.NotificationID,
+			Time:      time.Now(),
+			Tombstone: 1,
+		}, true)
+		if err != nil {
+			log.Println("Error removing deferred message:", err)
+		}
+		n.deferredLock.Unlock()
+
+		if notificationAcked(n.nc, m.NotificationID) {
+			return
+		}
+
+		n.publishMessage(m)
+	})
+
+	n.deferred[key] = t
+}
+
+// loadDeferred schedules messages that were deferred before the client was
+// started. Users are found in the root node and groups.
+func (n *NotificationClient) loadDeferred() error {
+	root, err := GetRootNode(n.nc)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+
+	var load func(id string) error
+	load = func(id string) error {
+		children, err := GetNodes(n.nc, id, "all", "", false)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range children {
+			switch c.Type {
+			case data.NodeTypeGroup:
+				err := load(c.ID)
+				if err != nil {
+					return err
+				}
+			case data.NodeTypeUser:
+				if found[c.ID] {
+					continue
+				}
+				found[c.ID] = true
+
+				for _, p := range c.Points {
+					if p.Type != data.PointTypeDeferredMessage || p.Tombstone != 0 {
+						continue
+					}
+
+					var m data.Message
+					err := json.Unmarshal([]byte(p.Text), &m)
+					if err != nil {
+						log.Println("Error decoding deferred message:", err)
+						continue
+					}
+
+					n.deferredLock.Lock()
+					n.scheduleMessage(m, time.Unix(int64(p.Value), 0))
+					n.deferredLock.Unlock()
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return load(root.ID)
+}
+
+// notificationAcked returns true if id is a rule notification that has been
+// acknowledged
+func notificationAcked(nc *nats.Conn, id string) bool {
+	nots, err := GetNodesType[Notification](nc, "all", id)
+	if err != nil {
+		log.Println("Error getting notification state:", err)
+		return false
+	}
+
+	return len(nots) > 0 && nots[0].AckBy != ""
+}
+
+// severityLevel converts a severity to a number that can be compared.
+// Blank or unknown severities are treated as warning.
+func severityLevel(severity string) int {
+	switch severity {
+	case data.PointValueInfo:
+		return 1
+	case data.PointValueCritical:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// findUsers returns users that should be notified for a notification sent
+// to nodeID. If nodeID is a user, only that user is returned, otherwise all
+// users found in the node (and its upstream nodes if upstream is set) are
+// returned.
+func (n *NotificationClient) findUsers(nodeID string, upstream bool) ([]User, error) {
+	nodes, err := GetNodes(n.nc, "all", nodeID, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 1 {
+		return nil, fmt.Errorf("node not found: %v", nodeID)
+	}
+
+	if nodes[0].Type == data.NodeTypeUser {
+		users, err := GetNodesType[User](n.nc, nodes[0].Parent, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if len(users) > 0 {
+			return users[:1], nil
+		}
+		return nil, nil
+	}
+
+	var ret []User
+	found := make(map[string]bool)
+
+	visit := func(id string) (bool, error) {
+		users, err := GetNodesType[User](n.nc, id, "all")
+		if err != nil {
+			return false, err
+		}
+
+		for _, u := range users {
+			if found[u.ID] {
+				continue
+			}
+			found[u.ID] = true
+			ret = append(ret, u)
+		}
+
+		// keep walking up the tree
+		return false, nil
+	}
+
+	_, err = visit(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !upstream {
+		return ret, nil
+	}
+
+	err = walkUp(n.nc, nodeID, visit)
+
+	return ret, err
+}
+
+func (n *NotificationClient) handleMessage(msg *nats.Msg) {
+	message, err := data.PbDecodeMessage(msg.Data)
+	if err != nil {
+		log.Println("Error decoding Pb message:", err)
+		return
+	}
+
+	// routing a message makes requests that can each wait up to the
+	// SendMessage timeout, so don't block the subscription while it runs
+	go n.routeMessage(message)
+}
+
+// routeMessage sends a message to the nearest message services that can
+// deliver it
+func (n *NotificationClient) routeMessage(message data.Message) {
+	svcs, err := n.findMsgServices(message)
+	if err != nil {
+		log.Println("Error finding message services:", err)
+		return
+	}
+
+	if len(svcs) < 1 {
+		log.Printf("No message service found for user %v\n", message.UserID)
+		return
+	}
+
+	for _, svc := range svcs {
+		err := SendMessage(n.nc, svc.ID, message)
+		if err != nil {
+			log.Printf("Error sending message to service %v (%v): %v\n",
+				svc.Description, svc.Service, err)
+		}
+	}
+}
+
+// findMsgServices returns the nearest message services that can deliver a
+// message. The search starts at the parent of the user the message is for and
+// walks up the tree, stopping at the first level where a message service is
+// found.
+func (n *NotificationClient) findMsgServices(message data.Message) ([]MsgService, error) {
+	start := message.ParentID
+	if start == "" {
+		start = message.UserID
+	}
+
+	var ret []MsgService
+
+	visit := func(id string) (bool, error) {
+		svcs, err := GetNodesType[MsgService](n.nc, id, "all")
+		if err != nil {
+			return false, err
+		}
+
+		for _, svc := range svcs {
+			if svc.Disabled || !svc.CanSend(message) {
+				continue
+			}
+			ret = append(ret, svc)
+		}
+
+		return len(ret) > 0, nil
+	}
+
+	if message.ParentID != "" {
+		// the user's parent is the first level we check
+		done, err := visit(start)
+		if err != nil || done {
+			return ret, err
+		}
+	}
+
+	err := walkUp(n.nc, start, visit)
+
+	return ret, err
+}
+
+// walkUp calls visit for each node upstream of id, level by level, until
+// visit returns true or the root is reached. id itself is not visited.
+func walkUp(nc *nats.Conn, id string, visit func(id string) (bool, error)) error {
+	visited := map[string]bool{id: true}
+	level := []string{id}
+
+	for len(level) > 0 {
+		var next []string
+		for _, id := range level {
+			nodes, err := GetNodes(nc, "all", id, "", false)
+			if err != nil {
+				return err
+			}
+			for _, n := range nodes {
+				if n.Parent == "" || n.Parent == "root" || n.Parent == "none" {
+					continue
+				}
+				if visited[n.Parent] {
+					continue
+				}
+				visited[n.Parent] = true
+				next = append(next, n.Parent)
+			}
+		}
+
+		done := false
+		for _, id := range next {
+			d, err := visit(id)
+			if err != nil {
+				return err
+			}
+			done = done || d
+		}
+
+		if done {
+			return nil
+		}
+
+		level = next
+	}
+
+	return nil
+}
+
+// SendMessage sends a message to a message service node for delivery and
+// waits for the result.
+func SendMessage(nc *nats.Conn, svcID string, message data.Message) error {
+	d, err := message.ToPb()
+	if err != nil {
+		return err
+	}
+
+	resp, err := nc.Request(SubjectMsgService(svcID), d, time.Second*20)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 {
+		return errors.New(string(resp.Data))
+	}
+
+	return nil
+}
+
+// AckNotification acknowledges a notification sent by a rule, which stops
+// any further escalation. id is the notification ID. The ack is processed by
+// the rule client, so only the first ack of a notification succeeds.
+func AckNotification(nc *nats.Conn, id, userID string) error {
+	resp, err := nc.Request(SubjectNotificationAck(id), []byte(userID), time.Second*20)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return fmt.Errorf("notification not found: %v", id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 {
+		return errors.New(string(resp.Data))
+	}
+
+	return nil
+}
@@ -0,0 +1,613 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// TestNotification sends a notification to a group node and verifies a
+// message is routed to a fake message service higher in the tree.
+func TestNotification(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	group := data.NodeEdge{
+		ID:     "ID-group",
+		Type:   data.NodeTypeGroup,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "plant A"},
+		},
+	}
+
+	err = client.SendNode(nc, group, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	user := client.User{
+		ID:        "ID-user",
+		Parent:    group.ID,
+		FirstName: "Joe",
+		Phone:     "+15555555555",
+	}
+
+	err = client.SendNodeType(nc, user, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// the fake message service is implemented by this test, so use a
+	// service type that is not built in
+	svc := client.MsgService{
+		ID:          "ID-msg-svc",
+		Parent:      root.ID,
+		Description: "fake msg service",
+		Service:     "fake",
+	}
+
+	err = client.SendNodeType(nc, svc, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	messages := make(chan data.Message, 10)
+
+	sub, err := nc.Subscribe(client.SubjectMsgService(svc.ID), func(msg *nats.Msg) {
+		m, err := data.PbDecodeMessage(msg.Data)
+		if err != nil {
+			t.Error("Error decoding message: ", err)
+		}
+		// the admin user in the root node is also sent a message, and
+		// messages are routed concurrently, so only keep the test user's
+		if m.UserID == user.ID {
+			messages <- m
+		}
+		_ = nc.Publish(msg.Reply, nil)
+	})
+
+	if err != nil {
+		t.Fatal("Error subscribing to msg service: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	not := data.Notification{
+		ID:      "ID-not",
+		Subject: "test",
+		Message: "motor overload",
+	}
+
+	d, err := not.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding notification: ", err)
+	}
+
+	err = nc.Publish(client.SubjectNodeNotification(group.ID), d)
+	if err != nil {
+		t.Fatal("Error publishing notification: ", err)
+	}
+
+	select {
+	case m := <-messages:
+		if m.Phone != user.Phone {
+			t.Error("Message phone is not correct: ", m.Phone)
+		}
+		if m.Message != not.Message {
+			t.Error("Message text is not correct: ", m.Message)
+		}
+		if m.NotificationID != not.ID {
+			t.Error("Message notification ID is not correct: ", m.NotificationID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+}
+
+// TestNotificationEscalationUsers verifies an escalation sent to a group is
+// only delivered to users directly in the group.
+func TestNotificationEscalationUsers(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	group := data.NodeEdge{
+		ID:     "ID-group",
+		Type:   data.NodeTypeGroup,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "managers"},
+		},
+	}
+
+	err = client.SendNode(nc, group, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	user := client.User{
+		ID:     "ID-user",
+		Parent: group.ID,
+		Phone:  "+15555555555",
+	}
+
+	err = client.SendNodeType(nc, user, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	svc := client.MsgService{
+		ID:          "ID-msg-svc",
+		Parent:      root.ID,
+		Description: "fake msg service",
+		Service:     "fake",
+	}
+
+	err = client.SendNodeType(nc, svc, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	messages := make(chan data.Message, 10)
+
+	sub, err := nc.Subscribe(client.SubjectMsgService(svc.ID), func(msg *nats.Msg) {
+		m, err := data.PbDecodeMessage(msg.Data)
+		if err != nil {
+			t.Error("Error decoding message: ", err)
+		}
+		messages <- m
+		_ = nc.Publish(msg.Reply, nil)
+	})
+
+	if err != nil {
+		t.Fatal("Error subscribing to msg service: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	not := data.Notification{
+		ID:      "ID-not",
+		Subject: "test",
+		Message: "motor overload",
+	}
+
+	d, err := not.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding notification: ", err)
+	}
+
+	err = nc.Publish(client.SubjectNodeEscalation(group.ID), d)
+	if err != nil {
+		t.Fatal("Error publishing escalation: ", err)
+	}
+
+	select {
+	case m := <-messages:
+		if m.UserID != user.ID {
+			t.Fatal("Escalation sent to wrong user: ", m.UserID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	// the admin user in the root node is not notified
+	select {
+	case m := <-messages:
+		t.Fatal("Escalation sent to upstream user: ", m.UserID)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// TestNotificationEscalation verifies an unacknowledged rule notification
+// is escalated, and escalation stops once the notification is acknowledged.
+func TestNotificationEscalation(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	vin := client.Variable{
+		ID:          "ID-varin",
+		Parent:      root.ID,
+		Description: "var in",
+	}
+
+	err = client.SendNodeType(nc, vin, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "test rule",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	c := client.Condition{
+		ID:            "ID-condition",
+		Parent:        r.ID,
+		Description:   "cond vin high",
+		ConditionType: data.PointValuePointValue,
+		PointType:     data.PointTypeValue,
+		ValueType:     data.PointValueOnOff,
+		NodeID:        vin.ID,
+		Operator:      data.PointValueEqual,
+		Value:         1,
+	}
+
+	err = client.SendNodeType(nc, c, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	a := client.Action{
+		ID:          "ID-action",
+		Parent:      r.ID,
+		Description: "notify",
+		Action:      data.PointValueNotify,
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// timeouts are in minutes
+	escalations := []client.Escalation{
+		{ID: "ID-esc-1", Parent: r.ID, NodeID: "ID-managers", Timeout: 0.01},
+		{ID: "ID-esc-2", Parent: r.ID, NodeID: "ID-directors", Timeout: 0.04},
+	}
+
+	for _, e := range escalations {
+		err = client.SendNodeType(nc, e, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	escalated := make(chan string, 10)
+
+	for _, e := range escalations {
+		nodeID := e.NodeID
+		sub, err := nc.Subscribe(client.SubjectNodeEscalation(nodeID), func(msg *nats.Msg) {
+			not, err := data.PbDecodeNotification(msg.Data)
+			if err != nil {
+				t.Error("Error decoding notification: ", err)
+			}
+			escalated <- nodeID + ":" + not.ID
+		})
+		if err != nil {
+			t.Fatal("Error subscribing: ", err)
+		}
+		defer func() {
+			_ = sub.Unsubscribe()
+		}()
+	}
+
+	// the notification node is created when the rule starts, so sending
+	// the first notification does not restart the rule
+	start := time.Now()
+	for {
+		nots, err := client.GetNodesType[client.Notification](nc, r.ID, "all")
+		if err != nil {
+			t.Fatal("Error getting notification: ", err)
+		}
+		if len(nots) > 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for notification node")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	// wait for rule to get restarted
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	var notID string
+
+	select {
+	case e := <-escalated:
+		nots, err := client.GetNodesType[client.Notification](nc, r.ID, "all")
+		if err != nil {
+			t.Fatal("Error getting notification: ", err)
+		}
+		if len(nots) != 1 {
+			t.Fatal("Expected 1 notification node, got: ", len(nots))
+		}
+		notID = nots[0].ID
+		if e != "ID-managers:"+notID {
+			t.Fatal("Escalation is not correct: ", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for escalation")
+	}
+
+	err = client.AckNotification(nc, notID, "ID-user")
+	if err != nil {
+		t.Fatal("Error acking notification: ", err)
+	}
+
+	err = client.AckNotification(nc, notID, "ID-user2")
+	if err == nil {
+		t.Error("Acking a notification twice should return an error")
+	}
+
+	select {
+	case e := <-escalated:
+		t.Fatal("Notification escalated after ack: ", e)
+	case <-time.After(3 * time.Second):
+	}
+
+	nots, err := client.GetNodesType[client.Notification](nc, r.ID, notID)
+	if err != nil || len(nots) < 1 {
+		t.Fatal("Error getting notification: ", err)
+	}
+
+	if nots[0].AckBy != "ID-user" || nots[0].AckTime == "" {
+		t.Error("Ack state is not correct: ", nots[0])
+	}
+
+	if nots[0].Level != 1 {
+		t.Error("Escalation level is not correct: ", nots[0].Level)
+	}
+}
+
+// TestNotificationMinSeverity verifies notifications below a user's minimum
+// severity are not delivered.
+func TestNotificationMinSeverity(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	user := client.User{
+		ID:          "ID-user",
+		Parent:      root.ID,
+		FirstName:   "Joe",
+		Email:       "joe@example.com",
+		MinSeverity: data.PointValueWarning,
+	}
+
+	err = client.SendNodeType(nc, user, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	messages := make(chan data.Message, 10)
+
+	sub, err := nc.Subscribe(client.SubjectNodeMessage(user.ID), func(msg *nats.Msg) {
+		m, err := data.PbDecodeMessage(msg.Data)
+		if err != nil {
+			t.Error("Error decoding message: ", err)
+		}
+		messages <- m
+	})
+
+	if err != nil {
+		t.Fatal("Error subscribing to messages: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	send := func(severity string) {
+		not := data.Notification{
+			ID:       severity,
+			Message:  severity + " message",
+			Severity: severity,
+		}
+
+		d, err := not.ToPb()
+		if err != nil {
+			t.Fatal("Error encoding notification: ", err)
+		}
+
+		err = nc.Publish(client.SubjectNodeNotification(root.ID), d)
+		if err != nil {
+			t.Fatal("Error publishing notification: ", err)
+		}
+	}
+
+	send(data.PointValueInfo)
+	send(data.PointValueCritical)
+
+	select {
+	case m := <-messages:
+		if m.NotificationID != data.PointValueCritical {
+			t.Error("Wrong notification delivered: ", m.NotificationID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	select {
+	case m := <-messages:
+		t.Error("Unexpected message: ", m.NotificationID)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// TestNotificationDeferred verifies messages deferred during quiet hours are
+// stored in the user node, and are delivered by a notification client that
+// is started later.
+func TestNotificationDeferred(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	user := client.User{
+		ID:     "ID-user",
+		Parent: root.ID,
+		Phone:  "+15555555555",
+	}
+
+	err = client.SendNodeType(nc, user, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// quiet all day
+	quiet := client.QuietHours{
+		ID:     "ID-quiet",
+		Parent: user.ID,
+		Start:  "0:00",
+		End:    "0:00",
+	}
+
+	err = client.SendNodeType(nc, quiet, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	svc := client.MsgService{
+		ID:          "ID-msg-svc",
+		Parent:      root.ID,
+		Description: "fake msg service",
+		Service:     "fake",
+	}
+
+	err = client.SendNodeType(nc, svc, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	messages := make(chan data.Message, 10)
+
+	sub, err := nc.Subscribe(client.SubjectMsgService(svc.ID), func(msg *nats.Msg) {
+		m, err := data.PbDecodeMessage(msg.Data)
+		if err != nil {
+			t.Error("Error decoding message: ", err)
+		}
+		if m.UserID == user.ID {
+			messages <- m
+		}
+		_ = nc.Publish(msg.Reply, nil)
+	})
+
+	if err != nil {
+		t.Fatal("Error subscribing to msg service: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	not := data.Notification{
+		ID:      "ID-not",
+		Subject: "test",
+		Message: "motor overload",
+	}
+
+	d, err := not.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding notification: ", err)
+	}
+
+	err = nc.Publish(client.SubjectNodeNotification(user.ID), d)
+	if err != nil {
+		t.Fatal("Error publishing notification: ", err)
+	}
+
+	deferred := func() (data.Point, bool) {
+		nodes, err := client.GetNodes(nc, "all", user.ID, "", false)
+		if err != nil || len(nodes) < 1 {
+			t.Fatal("Error getting user: ", err)
+		}
+		p, ok := nodes[0].Points.Find(data.PointTypeDeferredMessage, not.ID)
+		return p, ok && p.Tombstone == 0
+	}
+
+	start := time.Now()
+	for {
+		if _, ok := deferred(); ok {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for deferred message point")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	select {
+	case m := <-messages:
+		t.Fatal("Message delivered during quiet hours: ", m)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	// quiet hours ended while the client was not running
+	p, _ := deferred()
+	p.Time = time.Now()
+	p.Value = float64(time.Now().Add(-time.Minute).Unix())
+
+	err = client.SendNodePoint(nc, user.ID, p, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	n := client.NewNotificationClient(nc)
+	go func() {
+		_ = n.Run()
+	}()
+	defer n.Stop(nil)
+
+	select {
+	case m := <-messages:
+		if m.Message != not.Message {
+			t.Error("Message text is not correct: ", m.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for deferred message")
+	}
+
+	start = time.Now()
+	for {
+		if _, ok := deferred(); !ok {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Deferred message point not removed")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// notifyTemplateData is the data available in notify action message templates
+type notifyTemplateData struct {
+	// ID and Description of the node that triggered the rule
+	ID          string
+	Description string
+	// Units of the trigger node, if it has a units point
+	Units string
+	// Parent is the description of the trigger node's parent
+	Parent string
+	// Rule is the rule description
+	Rule string
+	// Time the notification was generated
+	Time time.Time
+	// Point values, text, and timestamps of the trigger node, indexed by
+	// point type, or type.key for points with a key
+	Values map[string]float64
+	Text   map[string]string
+	Times  map[string]time.Time
+	// Ios is point values indexed by type only. Use Values in new templates.
+	Ios map[string]float64
+}
+
+func newNotifyTemplateData(node data.NodeEdge) notifyTemplateData {
+	ret := notifyTemplateData{
+		ID:          node.ID,
+		Description: node.Desc(),
+		Time:        time.Now(),
+		Times:       make(map[string]time.Time),
+		Ios:         make(map[string]float64),
+	}
+
+	ret.Values, ret.Text = pointMaps(node.Points)
+
+	for _, p := range node.Points {
+		if p.Tombstone != 0 || p.Type == "" {
+			continue
+		}
+		ret.Times[pointMapKey(p)] = p.Time
+		ret.Ios[p.Type] = p.Value
+		if p.Type == data.PointTypeUnits {
+			ret.Units = p.Text
+		}
+	}
+
+	return ret
+}
+
+func renderNotifyTemplate(dtd notifyTemplateData, msgTemplate string) (string, error) {
+	buf := new(bytes.Buffer)
+
+	tmpl, err := template.New("msg").Parse(msgTemplate)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = tmpl.Execute(buf, dtd)
+
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// pointMapKey returns the point type, or type.key for points with a key
+func pointMapKey(p data.Point) string {
+	if p.Key != "" && p.Key != "0" {
+		return p.Type + "." + p.Key
+	}
+	return p.Type
+}
+
+// pointMaps returns maps of point values and text indexed by pointMapKey,
+// which are convenient to reference in templates
+func pointMaps(points data.Points) (map[string]float64, map[string]string) {
+	values := make(map[string]float64)
+	text := make(map[string]string)
+
+	for _, p := range points {
+		if p.Tombstone != 0 || p.Type == "" {
+			continue
+		}
+
+		k := pointMapKey(p)
+		values[k] = p.Value
+		if p.Text != "" {
+			text[k] = p.Text
+		}
+	}
+
+	return values, text
+}
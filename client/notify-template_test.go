@@ -0,0 +1,76 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestNotifyTemplate(t *testing.T) {
+	device := data.NodeEdge{
+		ID: "1234",
+		Points: []data.Point{
+			{
+				Type: data.PointTypeDescription,
+				Text: "My Node",
+				Key:  "0",
+			},
+			{
+				Type:  "tankLevel",
+				Key:   "0",
+				Value: 12.523423423,
+			},
+			{
+				Type:  "current",
+				Key:   "c0",
+				Value: 1.52323,
+				Time:  time.Date(2024, time.June, 1, 14, 30, 0, 0, time.UTC),
+			},
+			{
+				Type: data.PointTypeUnits,
+				Text: "gal",
+			},
+		},
+	}
+
+	td := newNotifyTemplateData(device)
+
+	res, err := renderNotifyTemplate(td, `Alarm from {{.Description}}, tank level is {{printf "%.2f" (index .Ios "tankLevel")}}.`)
+
+	if err != nil {
+		t.Error("render failed: ", err)
+	}
+
+	if res != "Alarm from My Node, tank level is 12.52." {
+		t.Error("rendered text is not correct: ", res)
+	}
+
+	td.Rule = "High current"
+	td.Parent = "Line #1"
+
+	res, err = renderNotifyTemplate(td, `{{.Rule}}: {{.Parent}}/{{.Description}} `+
+		`{{printf "%.1f" (index .Values "tankLevel")}} {{.Units}}, `+
+		`current {{index .Values "current.c0"}} at {{(index .Times "current.c0").Format "15:04"}}`)
+
+	if err != nil {
+		t.Error("render failed: ", err)
+	}
+
+	exp := "High current: Line #1/My Node 12.5 gal, current 1.52323 at 14:30"
+	if res != exp {
+		t.Errorf("rendered text is not correct, exp %v, got %v", exp, res)
+	}
+}
+
+func TestNotifyTemplateError(t *testing.T) {
+	_, err := renderNotifyTemplate(notifyTemplateData{}, `{{.Missing}}`)
+	if err == nil {
+		t.Error("expected error for missing field")
+	}
+
+	_, err = renderNotifyTemplate(notifyTemplateData{}, `{{.Description`)
+	if err == nil {
+		t.Error("expected error for bad template")
+	}
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// pendingAction is an action waiting for its delay or repeat period
+type pendingAction struct {
+	at time.Time
+	id string
+	// inactive is true for actions in ActionsInactive
+	inactive      bool
+	triggerNodeID string
+	trigger       data.Point
+}
+
+// ruleRunActions runs rule actions in sequence order. Each action's delay
+// is measured from when the previous action in the sequence runs, so
+// delays accumulate. Actions that are delayed or repeat are run later from
+// the rule run loop. trigger is the point that caused the rule to run, and
+// inactive is true when running ActionsInactive.
+func (rc *RuleClient) ruleRunActions(actions []Action, inactive bool,
+	triggerNodeID string, trigger data.Point) error {
+	// the rule is re-run when config changes, so start the sequence over
+	rc.cancelPendingActions(inactive)
+
+	now := rc.now()
+
+	var delay time.Duration
+	for _, i := range actionOrder(actions) {
+		a := actions[i]
+		delay += secondsDuration(a.Delay)
+
+		if delay > 0 {
+			rc.pendingActions = append(rc.pendingActions, pendingAction{
+				at:            now.Add(delay),
+				id:            a.ID,
+				inactive:      inactive,
+				triggerNodeID: triggerNodeID,
+				trigger:       trigger,
+			})
+			continue
+		}
+
+		err := rc.runAction(actions, i, triggerNodeID, trigger)
+		if err != nil {
+			return err
+		}
+
+		rc.scheduleRepeat(a, inactive, triggerNodeID, trigger)
+	}
+
+	return nil
+}
+
+// runPendingActions runs actions whose delay or repeat period has expired
+func (rc *RuleClient) runPendingActions() {
+	now := rc.now()
+
+	var due []pendingAction
+	var waiting []pendingAction
+	for _, pa := range rc.pendingActions {
+		if !now.Before(pa.at) {
+			due = append(due, pa)
+		} else {
+			waiting = append(waiting, pa)
+		}
+	}
+
+	rc.pendingActions = waiting
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+
+	for _, pa := range due {
+		actions := rc.config.Actions
+		if pa.inactive {
+			actions = rc.config.ActionsInactive
+		}
+
+		i := actionIndex(actions, pa.id)
+		if i < 0 {
+			// action was deleted
+			continue
+		}
+
+		err := rc.runAction(actions, i, pa.triggerNodeID, pa.trigger)
+		if err != nil {
+			log.Println("Error running rule action:", err)
+		}
+
+		rc.scheduleRepeat(actions[i], pa.inactive, pa.triggerNodeID, pa.trigger)
+	}
+}
+
+// scheduleRepeat schedules the next run of an action that has a repeat
+// period
+func (rc *RuleClient) scheduleRepeat(a Action, inactive bool,
+	triggerNodeID string, trigger data.Point) {
+	period := secondsDuration(a.RepeatPeriod)
+	if period <= 0 {
+		return
+	}
+
+	rc.pendingActions = append(rc.pendingActions, pendingAction{
+		at:            rc.now().Add(period),
+		id:            a.ID,
+		inactive:      inactive,
+		triggerNodeID: triggerNodeID,
+		trigger:       trigger,
+	})
+}
+
+// cancelPendingActions cancels delayed and repeating actions in Actions, or
+// ActionsInactive if inactive is true. This is called when the rule changes
+// state.
+func (rc *RuleClient) cancelPendingActions(inactive bool) {
+	var pending []pendingAction
+	for _, pa := range rc.pendingActions {
+		if pa.inactive != inactive {
+			pending = append(pending, pa)
+		}
+	}
+
+	rc.pendingActions = pending
+}
+
+// nextPendingAction returns when the next pending action is due
+func (rc *RuleClient) nextPendingAction() (next time.Time, ok bool) {
+	for _, pa := range rc.pendingActions {
+		if !ok || pa.at.Before(next) {
+			next = pa.at
+			ok = true
+		}
+	}
+
+	return next, ok
+}
+
+// actionOrder returns action indexes sorted by sequence. Actions with the
+// same sequence keep their order.
+func actionOrder(actions []Action) []int {
+	ret := make([]int, len(actions))
+	for i := range ret {
+		ret[i] = i
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return actions[ret[i]].Sequence < actions[ret[j]].Sequence
+	})
+
+	return ret
+}
+
+func actionIndex(actions []Action, id string) int {
+	for i, a := range actions {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// updateNodeSubs subscribes to the points of every node a condition refers
+// to. The rule up subscription only sees nodes below the rule parent, so
+// this is what allows conditions to watch other rules and variables
+// anywhere in the tree.
+func (rc *RuleClient) updateNodeSubs() {
+	ids := make(map[string]bool)
+	rc.walkConditions(func(c *Condition) {
+		if c.NodeID != "" && c.NodeID != rc.config.ID {
+			ids[c.NodeID] = true
+		}
+	})
+
+	for id, sub := range rc.nodeSubs {
+		if ids[id] {
+			continue
+		}
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Println("Rule error unsubscribing from node points:", err)
+		}
+		delete(rc.nodeSubs, id)
+	}
+
+	for id := range ids {
+		if _, ok := rc.nodeSubs[id]; ok {
+			continue
+		}
+
+		id := id
+		sub, err := rc.nc.Subscribe(SubjectNodePoints(id), func(msg *nats.Msg) {
+			points, err := data.PbDecodePoints(msg.Data)
+			if err != nil {
+				log.Println("Error decoding points in rule node sub:", err)
+				return
+			}
+
+			select {
+			case rc.newNodePoints <- NewPoints{id, "", points}:
+			case <-rc.stop:
+			}
+		})
+		if err != nil {
+			log.Println("Rule error subscribing to node points:", err)
+			continue
+		}
+
+		rc.nodeSubs[id] = sub
+	}
+}
+
+// unsubscribeNodes removes all node subscriptions
+func (rc *RuleClient) unsubscribeNodes() {
+	for id, sub := range rc.nodeSubs {
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Println("Rule error unsubscribing from node points:", err)
+		}
+		delete(rc.nodeSubs, id)
+	}
+}
+
+func (rc *RuleClient) hasRuleState() bool {
+	found := false
+	rc.walkConditions(func(c *Condition) {
+		if c.ConditionType == data.PointValueRuleState {
+			found = true
+		}
+	})
+	return found
+}
+
+// ruleStateConditions returns the rule state conditions in a list of
+// conditions and condition groups
+func ruleStateConditions(conds []Condition, groups []ConditionGroup) []Condition {
+	var ret []Condition
+	for _, c := range conds {
+		if c.ConditionType == data.PointValueRuleState && c.NodeID != "" {
+			ret = append(ret, c)
+		}
+	}
+	for _, g := range groups {
+		ret = append(ret, ruleStateConditions(g.Conditions, g.ConditionGroups)...)
+	}
+	return ret
+}
+
+// ruleDependencies returns the IDs of the rules a rule in the store depends
+// on through rule state conditions
+func ruleDependencies(nc *nats.Conn, id string) ([]string, error) {
+	var walk func(parent string) ([]string, error)
+	walk = func(parent string) ([]string, error) {
+		conds, err := GetNodesType[Condition](nc, parent, "all")
+		if err != nil {
+			return nil, err
+		}
+
+		var ret []string
+		for _, c := range ruleStateConditions(conds, nil) {
+			ret = append(ret, c.NodeID)
+		}
+
+		groups, err := GetNodesType[ConditionGroup](nc, parent, "all")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range groups {
+			deps, err := walk(g.ID)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, deps...)
+		}
+
+		return ret, nil
+	}
+
+	return walk(id)
+}
+
+// checkCycles looks for rule state conditions that lead back to this rule.
+// A rule that depends on its own state would toggle forever, so the
+// conditions that start a cycle are put in an error state and are never
+// active.
+func (rc *RuleClient) checkCycles() {
+	rc.cycleErrors = make(map[string]string)
+
+	// descriptions of rules we have visited, used in error messages
+	desc := map[string]string{rc.config.ID: rc.config.Description}
+
+	deps := func(id string) []string {
+		if rc.sim != nil {
+			// other rules are not available when simulating
+			return nil
+		}
+
+		ids, err := ruleDependencies(rc.nc, id)
+		if err != nil {
+			log.Println("Rule error getting dependencies:", err)
+			return nil
+		}
+		return ids
+	}
+
+	describe := func(id string) string {
+		if d, ok := desc[id]; ok {
+			return d
+		}
+
+		d := id
+		if rc.sim == nil {
+			rules, err := GetNodesType[Rule](rc.nc, "all", id)
+			if err == nil && len(rules) > 0 && rules[0].Description != "" {
+				d = rules[0].Description
+			}
+		}
+		desc[id] = d
+		return d
+	}
+
+	// find returns the path from id back to this rule, if there is one
+	var find func(id string, visited map[string]bool) []string
+	find = func(id string, visited map[string]bool) []string {
+		if id == rc.config.ID {
+			return []string{id}
+		}
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
+
+		for _, dep := range deps(id) {
+			if path := find(dep, visited); path != nil {
+				return append([]string{id}, path...)
+			}
+		}
+		return nil
+	}
+
+	for _, c := range ruleStateConditions(rc.config.Conditions, rc.config.ConditionGroups) {
+		path := find(c.NodeID, make(map[string]bool))
+		if path == nil {
+			continue
+		}
+
+		names := []string{describe(rc.config.ID)}
+		for _, id := range path {
+			names = append(names, describe(id))
+		}
+
+		rc.cycleErrors[c.ID] = fmt.Sprintf("rule dependency cycle: %v",
+			strings.Join(names, " -> "))
+	}
+}
+
+// loadRuleState initializes a rule state condition from the current state
+// of the rule it refers to
+func (rc *RuleClient) loadRuleState(c *Condition, st *conditionState) {
+	points, err := rc.nodePoints(c.NodeID)
+	if err != nil {
+		return
+	}
+
+	// a rule that has never run is inactive
+	active := false
+	start := rc.now()
+	for _, p := range points {
+		if p.Type == data.PointTypeActive {
+			active = p.Value != 0
+			start = pointTime(p)
+		}
+	}
+
+	st.rawActive = active == (c.Value != 0)
+	st.rawActiveStart = start
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestRuleStateCondition(t *testing.T) {
+	rule := Rule{
+		ID:          "rule1",
+		Description: "valve interlock",
+		Conditions: []Condition{{
+			ID:            "cond1",
+			Description:   "pump running",
+			ConditionType: data.PointValueRuleState,
+			NodeID:        "pumpRule",
+			Value:         1,
+		}},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	points := []NewPoints{
+		// other points from the rule are ignored
+		{ID: "pumpRule", Points: data.Points{{Time: start, Type: data.PointTypeError,
+			Text: "some error"}}},
+		{ID: "pumpRule", Points: data.Points{{Time: start.Add(time.Minute),
+			Type: data.PointTypeActive, Value: 1}}},
+		{ID: "pumpRule", Points: data.Points{{Time: start.Add(2 * time.Minute),
+			Type: data.PointTypeActive, Value: 0}}},
+	}
+
+	events, err := SimulateRule(rule, points, RuleSimOptions{})
+	if err != nil {
+		t.Fatal("Error simulating rule:", err)
+	}
+
+	var timeline []string
+	for _, e := range events {
+		timeline = append(timeline, e.String())
+	}
+
+	exp := []string{
+		`2024-01-01T00:01:00Z condition "pump running" active`,
+		`2024-01-01T00:01:00Z rule "valve interlock" active`,
+		`2024-01-01T00:02:00Z condition "pump running" inactive`,
+		`2024-01-01T00:02:00Z rule "valve interlock" inactive`,
+	}
+
+	if strings.Join(timeline, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Timeline is not correct, got:\n%v\nexpected:\n%v",
+			strings.Join(timeline, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func TestRuleStateCycle(t *testing.T) {
+	rc := &RuleClient{
+		config: Rule{
+			ID:          "rule1",
+			Description: "toggle",
+			ConditionGroups: []ConditionGroup{{
+				ID: "group1",
+				Conditions: []Condition{{
+					ID:            "cond1",
+					ConditionType: data.PointValueRuleState,
+					NodeID:        "rule1",
+				}},
+			}},
+		},
+		sim: &ruleSim{},
+	}
+
+	rc.checkCycles()
+
+	exp := "rule dependency cycle: toggle -> toggle"
+	if rc.cycleErrors["cond1"] != exp {
+		t.Errorf("Expected cycle error %q, got %q", exp, rc.cycleErrors["cond1"])
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// exec actions that don't set a timeout are killed after this
+const execDefaultTimeout = 30 * time.Second
+
+// output longer than this is truncated before it is stored in a point
+const execMaxOutput = 4096
+
+// ruleExec is set if exec actions are allowed to run commands
+var ruleExec atomic.Bool
+
+// errRuleExecDisabled is stored in the error point of exec actions that run
+// when exec actions are disabled
+var errRuleExecDisabled = errors.New("exec actions are disabled, start SIOT with -ruleExec to enable")
+
+// EnableRuleExec enables or disables exec rule actions. They are disabled
+// by default, as anyone who can edit rules can then run commands on the
+// SIOT host.
+func EnableRuleExec(enable bool) {
+	ruleExec.Store(enable)
+}
+
+// execEnv returns environment variables that describe the rule and the point
+// that triggered it. These are added to the action's own variables.
+func execEnv(ruleID, rule string, active bool, triggerNodeID string,
+	trigger data.Point) []string {
+	return []string{
+		"SIOT_RULE_ID=" + ruleID,
+		"SIOT_RULE=" + rule,
+		"SIOT_ACTIVE=" + strconv.FormatBool(active),
+		"SIOT_NODE_ID=" + triggerNodeID,
+		"SIOT_POINT_TYPE=" + trigger.Type,
+		"SIOT_POINT_KEY=" + trigger.Key,
+		"SIOT_POINT_VALUE=" + strconv.FormatFloat(trigger.Value, 'f', -1, 64),
+		"SIOT_POINT_TEXT=" + trigger.Text,
+	}
+}
+
+// execBaseEnv returns the environment commands start with. The environment of
+// the siot process is not inherited, as it can contain secrets such as
+// SIOT_AUTH_TOKEN, so only PATH is passed through.
+func execBaseEnv() []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/bin:/usr/bin:/bin"
+	}
+
+	return []string{"PATH=" + path}
+}
+
+// runCommand runs a command and returns its output. The command is killed
+// if it does not complete within timeout.
+func runCommand(command string, args []string, env []string,
+	timeout time.Duration) (stdout, stderr string, err error) {
+	if timeout <= 0 {
+		timeout = execDefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = append(execBaseEnv(), env...)
+	// don't wait forever on child processes that keep the output open
+	cmd.WaitDelay = time.Second
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err = cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("command timed out after %v", timeout)
+	}
+
+	return execOutput(outBuf.String()), execOutput(errBuf.String()), err
+}
+
+// execError returns the error stored in an exec action's error point.
+// Anything written to stderr is treated as an error.
+func execError(stderr string, err error) error {
+	switch {
+	case err != nil && stderr != "":
+		return fmt.Errorf("%w: %v", err, stderr)
+	case err != nil:
+		return err
+	case stderr != "":
+		return errors.New(stderr)
+	}
+
+	return nil
+}
+
+func execOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > execMaxOutput {
+		s = s[:execMaxOutput] + "..."
+	}
+	return s
+}
+
+// sortedEnv converts action environment variables to the form used by
+// exec.Cmd
+func sortedEnv(env map[string]string) []string {
+	ret := make([]string, 0, len(env))
+	for k, v := range env {
+		ret = append(ret, k+"="+v)
+	}
+	sort.Strings(ret)
+	return ret
+}
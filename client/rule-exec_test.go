@@ -0,0 +1,80 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestRunCommand(t *testing.T) {
+	env := append(sortedEnv(map[string]string{"LEVEL": "high"}),
+		execEnv("rule1", "tank rule", true, "node1",
+			data.Point{Type: "value", Value: 10.5})...)
+
+	stdout, stderr, err := runCommand("sh", []string{"-c",
+		`echo "$SIOT_RULE_ID $SIOT_NODE_ID $SIOT_POINT_TYPE $SIOT_POINT_VALUE $LEVEL $1"`,
+		"sh", "arg1"}, env, time.Second)
+
+	if err != nil {
+		t.Fatal("Error running command:", err)
+	}
+
+	if stderr != "" {
+		t.Error("Unexpected stderr:", stderr)
+	}
+
+	exp := "rule1 node1 value 10.5 high arg1"
+	if stdout != exp {
+		t.Errorf("Expected stdout %q, got %q", exp, stdout)
+	}
+
+	if execError(stderr, err) != nil {
+		t.Error("Expected no error")
+	}
+}
+
+func TestRunCommandEnv(t *testing.T) {
+	t.Setenv("SIOT_AUTH_TOKEN", "secret")
+
+	stdout, _, err := runCommand("sh", []string{"-c",
+		`echo "$SIOT_AUTH_TOKEN:$LEVEL"`}, []string{"LEVEL=high"}, time.Second)
+
+	if err != nil {
+		t.Fatal("Error running command:", err)
+	}
+
+	if stdout != ":high" {
+		t.Errorf("Expected only PATH and action variables, got %q", stdout)
+	}
+}
+
+func TestRunCommandErrors(t *testing.T) {
+	stdout, stderr, err := runCommand("sh", []string{"-c",
+		"echo out; echo failed >&2; exit 3"}, nil, time.Second)
+
+	if stdout != "out" {
+		t.Errorf("Expected stdout out, got %q", stdout)
+	}
+
+	errExec := execError(stderr, err)
+	if errExec == nil || !strings.Contains(errExec.Error(), "failed") {
+		t.Error("Expected stderr in error, got:", errExec)
+	}
+
+	start := time.Now()
+	_, _, err = runCommand("sleep", []string{"10"}, nil, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error("Expected timeout error, got:", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("Command was not killed after timeout")
+	}
+
+	_, _, err = runCommand("siot-command-does-not-exist", nil, nil, time.Second)
+	if err == nil {
+		t.Error("Expected error for missing command")
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ruleHistorySize is the number of history entries kept for each rule.
+// Entries are stored in keyed history points on the rule node, and the
+// oldest entry is overwritten when the ring is full.
+const ruleHistorySize = 100
+
+// recordHistory stores a history entry in the next slot of the ring
+func (rc *RuleClient) recordHistory(h data.RuleHistory) {
+	if h.Time.IsZero() {
+		h.Time = time.Now()
+	}
+
+	key := strconv.Itoa(rc.historyIndex)
+
+	p, err := h.ToPoint(key)
+	if err != nil {
+		log.Println("Rule error encoding history:", err)
+		return
+	}
+
+	err = rc.sendPoint(rc.config.ID, p)
+	if err != nil {
+		log.Println("Rule error sending history point:", err)
+		return
+	}
+
+	if rc.config.History == nil {
+		rc.config.History = make(map[string]string)
+	}
+	rc.config.History[key] = p.Text
+
+	rc.historyIndex = (rc.historyIndex + 1) % ruleHistorySize
+}
+
+// recordStateChange records the rule going active or inactive, and the
+// point that caused it
+func (rc *RuleClient) recordStateChange(active bool, nodeID string, trigger data.Point) {
+	event := data.RuleHistoryInactive
+	if active {
+		event = data.RuleHistoryActive
+	}
+
+	rc.recordHistory(data.RuleHistory{
+		Event:     event,
+		NodeID:    nodeID,
+		PointType: trigger.Type,
+		PointKey:  trigger.Key,
+		Value:     trigger.Value,
+		Text:      trigger.Text,
+	})
+}
+
+// recordActionResult records the result of running an action
+func (rc *RuleClient) recordActionResult(a Action, err error) {
+	h := data.RuleHistory{
+		Event:       data.RuleHistoryAction,
+		ActionID:    a.ID,
+		Action:      a.Action,
+		Description: a.Description,
+	}
+
+	if err != nil {
+		h.Error = err.Error()
+	}
+
+	rc.recordHistory(h)
+}
+
+// findAction returns the action with the given ID in Actions or
+// ActionsInactive
+func (rc *RuleClient) findAction(id string) (Action, bool) {
+	for _, actions := range [][]Action{rc.config.Actions, rc.config.ActionsInactive} {
+		if i := actionIndex(actions, id); i >= 0 {
+			return actions[i], true
+		}
+	}
+
+	return Action{}, false
+}
+
+// nextHistoryIndex returns the slot after the newest entry in the ring
+func nextHistoryIndex(history map[string]string) int {
+	next := 0
+	var newest time.Time
+
+	for key, text := range history {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= ruleHistorySize {
+			continue
+		}
+
+		h, err := data.ParseRuleHistory(text)
+		if err != nil {
+			continue
+		}
+
+		if h.Time.After(newest) {
+			newest = h.Time
+			next = (i + 1) % ruleHistorySize
+		}
+	}
+
+	return next
+}
+
+// GetRuleHistory returns the history of a rule, oldest first. The history
+// includes when the rule went active or inactive, the point that caused it,
+// and the result of each action.
+func GetRuleHistory(nc *nats.Conn, ruleID string) ([]data.RuleHistory, error) {
+	resp, err := nc.Request(SubjectRuleHistory(ruleID), nil, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	var results data.RuleHistoryResults
+	err = json.Unmarshal(resp.Data, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	if results.ErrorMessage != "" {
+		return nil, errors.New(results.ErrorMessage)
+	}
+
+	return results.History, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestNextHistoryIndex(t *testing.T) {
+	start := time.Now()
+
+	history := make(map[string]string)
+
+	if i := nextHistoryIndex(history); i != 0 {
+		t.Errorf("Expected 0 for empty history, got %v", i)
+	}
+
+	add := func(key string, offset time.Duration) {
+		p, err := data.RuleHistory{Time: start.Add(offset)}.ToPoint(key)
+		if err != nil {
+			t.Fatal("Error encoding history:", err)
+		}
+		history[key] = p.Text
+	}
+
+	add("0", 0)
+	add("1", time.Second)
+	add("2", 2*time.Second)
+
+	if i := nextHistoryIndex(history); i != 3 {
+		t.Errorf("Expected 3, got %v", i)
+	}
+
+	// ring wrapped, so slot 0 was overwritten
+	add("99", -time.Second)
+	add("0", 3*time.Second)
+
+	if i := nextHistoryIndex(history); i != 1 {
+		t.Errorf("Expected 1 after wrap, got %v", i)
+	}
+
+	// last slot is newest
+	add("99", 4*time.Second)
+
+	if i := nextHistoryIndex(history); i != 0 {
+		t.Errorf("Expected 0 after last slot, got %v", i)
+	}
+}
@@ -0,0 +1,415 @@
+package client
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// RuleEvent is a rule, condition, condition group, or action state change
+// returned by SimulateRule
+type RuleEvent struct {
+	Time time.Time
+	// Type: rule, condition, conditionGroup, action, actionInactive
+	Type        string
+	ID          string
+	Description string
+	Active      bool
+	Error       string
+	// the following are set for actions
+	Action string
+	// NodeID and Point are set for setValue actions
+	NodeID string
+	Point  data.Point
+}
+
+func (e RuleEvent) String() string {
+	ret := fmt.Sprintf("%v %v %q", e.Time.Format(time.RFC3339), e.Type,
+		e.Description)
+
+	switch {
+	case e.Error != "":
+		ret += " error: " + e.Error
+	case e.Action == data.PointValueSetValue:
+		ret += fmt.Sprintf(" %v %v %v", e.Action, e.NodeID, e.Point.Type)
+		if e.Point.Key != "" && e.Point.Key != "0" {
+			ret += "." + e.Point.Key
+		}
+		if e.Point.Text != "" {
+			ret += fmt.Sprintf("=%q", e.Point.Text)
+		} else {
+			ret += "=" + strconv.FormatFloat(e.Point.Value, 'f', -1, 64)
+		}
+	case e.Action != "":
+		ret += " " + e.Action
+	case e.Active:
+		ret += " active"
+	default:
+		ret += " inactive"
+	}
+
+	return ret
+}
+
+// RuleSimOptions are used to configure SimulateRule
+type RuleSimOptions struct {
+	// Timezone is used for schedule conditions that don't set a timezone.
+	// This is normally inherited from an ancestor of the rule.
+	Timezone string
+	// End is the time to stop the simulation. Timers (minActive, no
+	// update, delayed actions, and schedules) run until this time. If not
+	// set, the simulation stops at the last point.
+	End time.Time
+}
+
+// ruleSim holds the state of a rule simulation. When a RuleClient is
+// simulating, nothing is published, and state changes and actions are
+// recorded in the timeline instead.
+type ruleSim struct {
+	now    time.Time
+	events []RuleEvent
+	// points received so far for each node, used by action expressions
+	nodes map[string]data.Points
+}
+
+// SimulateRule feeds points through a rule configuration and returns the
+// timeline of rule, condition, and action state changes. Points must have
+// a time and are processed in time order. Nothing is published -- actions
+// are recorded in the timeline instead of run. This can be used to
+// validate rules before deploying them.
+func SimulateRule(rule Rule, points []NewPoints, opts RuleSimOptions) ([]RuleEvent, error) {
+	type nodePoint struct {
+		id string
+		p  data.Point
+	}
+
+	var pts []nodePoint
+	for _, np := range points {
+		for _, p := range np.Points {
+			if p.Time.IsZero() {
+				return nil, fmt.Errorf("point %v for node %v does not have a time",
+					p.Type, np.ID)
+			}
+			pts = append(pts, nodePoint{np.ID, p})
+		}
+	}
+
+	sort.SliceStable(pts, func(i, j int) bool {
+		return pts[i].p.Time.Before(pts[j].p.Time)
+	})
+
+	var start time.Time
+	switch {
+	case len(pts) > 0:
+		start = pts[0].p.Time
+	case !opts.End.IsZero():
+		start = opts.End
+	default:
+		return nil, errors.New("no points to simulate")
+	}
+
+	if _, err := loadLocation(opts.Timezone); err != nil {
+		return nil, err
+	}
+
+	rc := &RuleClient{
+		config:     rule,
+		condStates: make(map[string]*conditionState),
+		timezone:   opts.Timezone,
+		sim: &ruleSim{
+			now:   start,
+			nodes: make(map[string]data.Points),
+		},
+	}
+
+	rc.walkConditions(func(c *Condition) {
+		rc.conditionState(c)
+	})
+
+	// the rule client checks schedules every 10s, but schedules have a
+	// resolution of a minute, so once a minute is enough here
+	hasSchedule := rc.hasSchedule()
+	nextTick := start.Truncate(time.Minute).Add(time.Minute)
+
+	trigger := func() data.Points {
+		return data.Points{{Time: rc.sim.now, Type: data.PointTypeTrigger}}
+	}
+
+	// advance runs timers that expire up to t
+	advance := func(t time.Time) {
+		var lastCondEvent time.Time
+		for {
+			var next time.Time
+			var run func()
+
+			// pick the earliest timer that expires by t
+			consider := func(at time.Time, f func()) {
+				if !at.After(t) && (run == nil || at.Before(next)) {
+					next, run = at, f
+				}
+			}
+
+			if at, ok := rc.nextPendingAction(); ok {
+				consider(at, rc.runPendingActions)
+			}
+
+			// don't process the same condition event more than once
+			if at, ok := rc.nextConditionEvent(); ok && at.After(lastCondEvent) {
+				consider(at, func() {
+					lastCondEvent = at
+					rc.process(rc.config.ID, trigger())
+				})
+			}
+
+			if hasSchedule {
+				consider(nextTick, func() {
+					nextTick = nextTick.Add(time.Minute)
+					rc.process(rc.config.ID, trigger())
+				})
+			}
+
+			if run == nil {
+				return
+			}
+
+			if next.After(rc.sim.now) {
+				rc.sim.now = next
+			}
+			run()
+		}
+	}
+
+	// evaluate schedules at the start time, the rule client does this
+	// shortly after it starts
+	if hasSchedule {
+		rc.process(rc.config.ID, trigger())
+	}
+
+	for _, np := range pts {
+		advance(np.p.Time)
+		rc.sim.now = np.p.Time
+
+		nodePts := rc.sim.nodes[np.id]
+		nodePts.Add(np.p)
+		rc.sim.nodes[np.id] = nodePts
+
+		rc.process(np.id, data.Points{np.p})
+	}
+
+	if !opts.End.IsZero() {
+		advance(opts.End)
+	}
+
+	return rc.sim.events, nil
+}
+
+// point records a point the rule would have sent
+func (sim *ruleSim) point(rc *RuleClient, id string, p data.Point) {
+	if p.Type != data.PointTypeActive &&
+		!(p.Type == data.PointTypeError && p.Text != "") {
+		return
+	}
+
+	ev := RuleEvent{
+		Time:   sim.now,
+		ID:     id,
+		Active: p.Value != 0,
+		Error:  p.Text,
+	}
+
+	switch {
+	case id == rc.config.ID:
+		ev.Type = data.NodeTypeRule
+		ev.Description = rc.config.Description
+	default:
+		rc.walkConditions(func(c *Condition) {
+			if c.ID == id {
+				ev.Type = data.NodeTypeCondition
+				ev.Description = c.Description
+			}
+		})
+
+		rc.walkConditionGroups(func(g *ConditionGroup) {
+			if g.ID == id {
+				ev.Type = data.NodeTypeConditionGroup
+				ev.Description = g.Description
+			}
+		})
+
+		if ev.Type == "" && p.Type == data.PointTypeError {
+			// action errors are recorded with the action
+			if a, ok := rc.findAction(id); ok {
+				ev.Type = data.NodeTypeAction
+				ev.Description = a.Description
+			}
+		}
+	}
+
+	if ev.Type == "" {
+		// action active points are recorded when the action runs
+		return
+	}
+
+	sim.events = append(sim.events, ev)
+}
+
+// action records an action the rule would have run
+func (sim *ruleSim) action(rc *RuleClient, a Action, triggerNodeID string,
+	trigger data.Point) {
+	ev := RuleEvent{
+		Time:        sim.now,
+		Type:        data.NodeTypeAction,
+		ID:          a.ID,
+		Description: a.Description,
+		Active:      true,
+		Action:      a.Action,
+	}
+
+	if actionIndex(rc.config.ActionsInactive, a.ID) >= 0 {
+		ev.Type = data.NodeTypeActionInactive
+	}
+
+	if a.Action == data.PointValueSetValue {
+		p, err := rc.setValuePoint(a, triggerNodeID, trigger)
+		if err != nil {
+			ev.Error = err.Error()
+		} else {
+			ev.NodeID = a.NodeID
+			ev.Point = p
+		}
+	}
+
+	sim.events = append(sim.events, ev)
+}
+
+// RuleFromYAML decodes the first rule found in YAML data in the format used
+// by ExportNodes. The export can be of the rule, or a node that contains
+// it. timezone is set if the rule or one of its ancestors in the export has
+// a timezone.
+func RuleFromYAML(yamlData []byte) (rule Rule, timezone string, err error) {
+	var exp SiotExport
+
+	err = yaml.Unmarshal(yamlData, &exp)
+	if err != nil {
+		return Rule{}, "", fmt.Errorf("Error parsing YAML data: %w", err)
+	}
+
+	var find func(nodes []data.NodeEdgeChildren, tz string) (*data.NodeEdgeChildren, string)
+	find = func(nodes []data.NodeEdgeChildren, tz string) (*data.NodeEdgeChildren, string) {
+		for i, n := range nodes {
+			nodeTz := tz
+			for _, p := range n.Points {
+				// exports leave out the key, so don't use Points.Text
+				if p.Type == data.PointTypeTimezone && p.Text != "" {
+					nodeTz = p.Text
+				}
+			}
+
+			if n.Type == data.NodeTypeRule {
+				return &nodes[i], nodeTz
+			}
+
+			if r, rTz := find(n.Children, nodeTz); r != nil {
+				return r, rTz
+			}
+		}
+		return nil, ""
+	}
+
+	ruleNode, timezone := find(exp.Nodes, "")
+	if ruleNode == nil {
+		return Rule{}, "", errors.New("no rule found in YAML data")
+	}
+
+	err = data.Decode(*ruleNode, &rule)
+	if err != nil {
+		return Rule{}, "", fmt.Errorf("Error decoding rule: %w", err)
+	}
+
+	return rule, timezone, nil
+}
+
+// PointsFromCSV reads points for SimulateRule from CSV data. The first row
+// is a header that names the columns: time, nodeID, type, and optionally
+// key, value, and text. Time is in RFC3339 format.
+func PointsFromCSV(r io.Reader) ([]NewPoints, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CSV header: %w", err)
+	}
+
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.TrimSpace(h)] = i
+	}
+
+	for _, c := range []string{"time", "nodeID", "type"} {
+		if _, ok := cols[c]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %v column", c)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var ret []NewPoints
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CSV: %w", err)
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		t, err := time.Parse(time.RFC3339, field(row, "time"))
+		if err != nil {
+			return nil, fmt.Errorf("CSV line %v: invalid time: %w", line, err)
+		}
+
+		p := data.Point{
+			Time: t,
+			Type: field(row, "type"),
+			Key:  field(row, "key"),
+			Text: field(row, "text"),
+		}
+
+		if p.Key == "" {
+			p.Key = "0"
+		}
+
+		if v := field(row, "value"); v != "" {
+			p.Value, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("CSV line %v: invalid value: %w", line, err)
+			}
+		}
+
+		ret = append(ret, NewPoints{
+			ID:     field(row, "nodeID"),
+			Points: data.Points{p},
+		})
+	}
+
+	return ret, nil
+}
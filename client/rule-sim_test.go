@@ -0,0 +1,219 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+const testSimRule = `
+nodes:
+- id: inst1
+  type: device
+  parent: root
+  points:
+  - type: description
+    text: site
+  children:
+  - id: rule1
+    type: rule
+    parent: inst1
+    points:
+    - type: description
+      text: tank high
+    children:
+    - id: cond1
+      type: condition
+      parent: rule1
+      points:
+      - type: description
+        text: level high
+      - type: conditionType
+        text: pointValue
+      - type: nodeID
+        text: tank
+      - type: pointType
+        text: value
+      - type: valueType
+        text: number
+      - type: operator
+        text: ">"
+      - type: value
+        value: 50
+      - type: minActive
+        value: 1
+    - id: action1
+      type: action
+      parent: rule1
+      points:
+      - type: description
+        text: pump off
+      - type: action
+        text: setValue
+      - type: nodeID
+        text: pump
+      - type: pointType
+        text: value
+      - type: expression
+        text: 'node["tank"].value > 90 ? 2 : 1'
+    - id: action2
+      type: actionInactive
+      parent: rule1
+      points:
+      - type: description
+        text: pump on
+      - type: action
+        text: setValue
+      - type: nodeID
+        text: pump
+      - type: pointType
+        text: value
+      - type: delay
+        value: 30
+`
+
+const testSimPoints = `time,nodeID,type,value
+# level goes high, but not for long enough
+2024-01-01T00:00:00Z,tank,value,40
+2024-01-01T00:00:10Z,tank,value,60
+2024-01-01T00:00:40Z,tank,value,45
+# level stays high
+2024-01-01T00:01:00Z,tank,value,95
+2024-01-01T00:03:00Z,tank,value,30
+`
+
+func TestSimulateRule(t *testing.T) {
+	rule, tz, err := RuleFromYAML([]byte(testSimRule))
+	if err != nil {
+		t.Fatal("Error parsing rule:", err)
+	}
+
+	if rule.ID != "rule1" || len(rule.Conditions) != 1 ||
+		len(rule.Actions) != 1 || len(rule.ActionsInactive) != 1 {
+		t.Fatal("Rule was not decoded correctly:", rule)
+	}
+
+	if tz != "" {
+		t.Error("Expected no timezone, got:", tz)
+	}
+
+	points, err := PointsFromCSV(strings.NewReader(testSimPoints))
+	if err != nil {
+		t.Fatal("Error parsing points:", err)
+	}
+
+	if len(points) != 5 {
+		t.Fatal("Expected 5 points, got:", len(points))
+	}
+
+	events, err := SimulateRule(rule, points, RuleSimOptions{
+		End: time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal("Error simulating rule:", err)
+	}
+
+	var timeline []string
+	for _, e := range events {
+		timeline = append(timeline, e.String())
+	}
+
+	exp := []string{
+		`2024-01-01T00:02:00Z condition "level high" active`,
+		`2024-01-01T00:02:00Z rule "tank high" active`,
+		`2024-01-01T00:02:00Z action "pump off" setValue pump value=2`,
+		`2024-01-01T00:03:00Z condition "level high" inactive`,
+		`2024-01-01T00:03:00Z rule "tank high" inactive`,
+		`2024-01-01T00:03:30Z actionInactive "pump on" setValue pump value=0`,
+	}
+
+	if strings.Join(timeline, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Timeline is not correct, got:\n%v\nexpected:\n%v",
+			strings.Join(timeline, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func TestPointsFromCSVErrors(t *testing.T) {
+	tests := []string{
+		"time,type,value\n2024-01-01T00:00:00Z,value,1\n",
+		"time,nodeID,type,value\nyesterday,tank,value,1\n",
+		"time,nodeID,type,value\n2024-01-01T00:00:00Z,tank,value,high\n",
+	}
+
+	for _, test := range tests {
+		_, err := PointsFromCSV(strings.NewReader(test))
+		if err == nil {
+			t.Errorf("Expected error for CSV:\n%v", test)
+		}
+	}
+}
+
+func TestSimulateRuleGpsLocation(t *testing.T) {
+	rule := Rule{
+		ID:          "rule1",
+		Description: "lights",
+		Conditions: []Condition{{
+			ID:            "cond1",
+			Description:   "night",
+			ConditionType: data.PointValueSchedule,
+			Start:         "sunset",
+			End:           "sunrise",
+			NodeID:        "gps1",
+		}},
+	}
+
+	start := time.Date(2021, time.June, 21, 4, 0, 0, 0, time.UTC)
+
+	// New York, as written by the GPS client
+	pos := data.GpsPos{Lat: 40.7128, Long: -74.0060, Fix: "1", NumSat: 8}
+	gpsPoints := pos.ToPoints()
+	for i := range gpsPoints {
+		gpsPoints[i].Time = start
+	}
+
+	events, err := SimulateRule(rule, []NewPoints{{ID: "gps1", Points: gpsPoints}},
+		RuleSimOptions{
+			Timezone: "America/New_York",
+			End:      start.Add(24 * time.Hour),
+		})
+	if err != nil {
+		t.Fatal("Error simulating rule:", err)
+	}
+
+	// New York sunrise is 5:25 and sunset is 20:31 EDT on 2021-06-21
+	exp := []struct {
+		t      time.Time
+		active bool
+	}{
+		{time.Date(2021, time.June, 21, 9, 25, 0, 0, time.UTC), false},
+		{time.Date(2021, time.June, 22, 0, 31, 0, 0, time.UTC), true},
+	}
+
+	var ruleEvents []RuleEvent
+	for _, e := range events {
+		// the schedule is evaluated at the start of the simulation
+		// before the GPS points are processed
+		if e.Error != "" && e.Time.After(start) {
+			t.Fatal("Unexpected error:", e)
+		}
+		if e.Type == data.NodeTypeRule && e.Error == "" {
+			ruleEvents = append(ruleEvents, e)
+		}
+	}
+
+	// the rule is active once the location is known until sunrise
+	if len(ruleEvents) != 3 || !ruleEvents[0].Active ||
+		ruleEvents[0].Time.Sub(start) > 2*time.Minute {
+		t.Fatal("Rule events are not correct:", ruleEvents)
+	}
+
+	for i, e := range ruleEvents[1:] {
+		diff := e.Time.Sub(exp[i].t)
+		if e.Active != exp[i].active || diff < -2*time.Minute || diff > 2*time.Minute {
+			t.Errorf("Expected rule active=%v at %v, got %v", exp[i].active,
+				exp[i].t, e)
+		}
+	}
+}
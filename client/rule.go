@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,22 +11,27 @@ import (
 	"time"
 
 	"github.com/go-audio/wav"
-	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/data"
 )
 
 // Rule represent a rule node config
 type Rule struct {
-	ID              string      `node:"id"`
-	Parent          string      `node:"parent"`
-	Description     string      `point:"description"`
-	Disabled        bool        `point:"disabled"`
-	Active          bool        `point:"active"`
-	Error           string      `point:"error"`
-	Conditions      []Condition `child:"condition"`
-	Actions         []Action    `child:"action"`
-	ActionsInactive []Action    `child:"actionInactive"`
+	ID              string           `node:"id"`
+	Parent          string           `node:"parent"`
+	Description     string           `point:"description"`
+	Disabled        bool             `point:"disabled"`
+	Active          bool             `point:"active"`
+	Error           string           `point:"error"`
+	Conditions      []Condition      `child:"condition"`
+	ConditionGroups []ConditionGroup `child:"conditionGroup"`
+	Actions         []Action         `child:"action"`
+	ActionsInactive []Action         `child:"actionInactive"`
+	Escalations     []Escalation     `child:"escalation"`
+	// Notifications contains the state of the last notification sent
+	Notifications []Notification `child:"notification"`
+	// History is a ring of data.RuleHistory entries encoded as JSON
+	History map[string]string `point:"history"`
 }
 
 func (r Rule) String() string {
@@ -34,6 +40,9 @@ func (r Rule) String() string {
 	for _, c := range r.Conditions {
 		ret += fmt.Sprintf("%v", c)
 	}
+	for _, g := range r.ConditionGroups {
+		ret += g.indentString("  ")
+	}
 	for _, a := range r.Actions {
 		ret += fmt.Sprintf("  ACTION: %v", a)
 	}
@@ -42,6 +51,10 @@ func (r Rule) String() string {
 		ret += fmt.Sprintf("  ACTION Inactive: %v", a)
 	}
 
+	for _, e := range r.Escalations {
+		ret += fmt.Sprintf("  %v", e)
+	}
+
 	return ret
 }
 
@@ -56,7 +69,9 @@ type Condition struct {
 	Active        bool    `point:"active"`
 	Error         string  `point:"error"`
 
-	// used with point value rules
+	// used with point value rules. For rule state conditions, NodeID is
+	// the rule to watch, and the condition is active when the rule active
+	// state matches Value (1 for active, 0 for inactive).
 	NodeID     string  `point:"nodeID"`
 	PointType  string  `point:"pointType"`
 	PointKey   string  `point:"pointKey"`
@@ -65,12 +80,32 @@ type Condition struct {
 	Operator   string  `point:"operator"`
 	Value      float64 `point:"value"`
 	ValueText  string  `point:"valueText"`
-
-	// used with shedule rules
+	Hysteresis float64 `point:"hysteresis"`
+	Deadband   float64 `point:"deadband"`
+	// Statistic: min, max, avg, rate (units/sec). If blank, the
+	// instantaneous point value is used.
+	Statistic string `point:"statistic"`
+	// Window is the statistic time window in minutes
+	Window float64 `point:"window"`
+
+	// used with no update rules (also uses NodeID, PointType, PointKey)
+	Timeout float64 `point:"timeout"`
+
+	// used with shedule rules. Start and End can be a time of day (15:04),
+	// or sunrise/sunset with an optional offset in minutes (sunset-30). If
+	// Cron is set, it is used instead of Start, End, Weekdays, and Dates.
 	Start    string   `point:"start"`
 	End      string   `point:"end"`
 	Weekdays []bool   `point:"weekday"`
 	Dates    []string `point:"date"`
+	Cron     string   `point:"cron"`
+	// location for sun events. If not set, the latitude and longitude
+	// points of NodeID (for instance a GPS node) are used.
+	Latitude  float64 `point:"latitude"`
+	Longitude float64 `point:"longitude"`
+	// Timezone is an IANA timezone name. If blank, the timezone is
+	// inherited from the closest ancestor with a timezone point, or UTC.
+	Timezone string `point:"timezone"`
 }
 
 func (c Condition) String() string {
@@ -100,6 +135,15 @@ func (c Condition) String() string {
 		if c.MinActive > 0 {
 			ret += fmt.Sprintf("  MINACT:%v", c.MinActive)
 		}
+		if c.Hysteresis > 0 {
+			ret += fmt.Sprintf("  HYST:%v", c.Hysteresis)
+		}
+		if c.Deadband > 0 {
+			ret += fmt.Sprintf("  DB:%v", c.Deadband)
+		}
+		if c.Statistic != "" {
+			ret += fmt.Sprintf("  STAT:%v/%vm", c.Statistic, c.Window)
+		}
 		ret += fmt.Sprintf("  A:%v", c.Active)
 		ret += "\n"
 	case data.PointValueSchedule:
@@ -108,6 +152,22 @@ func (c Condition) String() string {
 		ret += fmt.Sprintf("  W:%v", c.Weekdays)
 		ret += fmt.Sprintf("  D:%v", c.Dates)
 		ret += "\n"
+	case data.PointValueRuleState:
+		ret = fmt.Sprintf("  COND: %v  CTYPE:%v  RULE:%v  V:%v",
+			c.Description, c.ConditionType, c.NodeID, c.Value != 0)
+		if c.MinActive > 0 {
+			ret += fmt.Sprintf("  MINACT:%v", c.MinActive)
+		}
+		ret += fmt.Sprintf("  A:%v", c.Active)
+		ret += "\n"
+	case data.PointValueNoUpdate:
+		ret = fmt.Sprintf("  COND: %v  CTYPE:%v  TIMEOUT:%v",
+			c.Description, c.ConditionType, c.Timeout)
+		if c.NodeID != "" {
+			ret += fmt.Sprintf("  NODEID:%v", c.NodeID)
+		}
+		ret += fmt.Sprintf("  A:%v", c.Active)
+		ret += "\n"
 
 	default:
 		ret = "Missing String case for condition"
@@ -115,6 +175,38 @@ func (c Condition) String() string {
 	return ret
 }
 
+// ConditionGroup combines child conditions and condition groups using a
+// boolean operator. Groups can be nested to build up expressions like
+// (A or B) and not C.
+type ConditionGroup struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// Operator: and, or, not. Defaults to and if blank.
+	// not is active when none of the children are active.
+	Operator        string           `point:"operator"`
+	Active          bool             `point:"active"`
+	Error           string           `point:"error"`
+	Conditions      []Condition      `child:"condition"`
+	ConditionGroups []ConditionGroup `child:"conditionGroup"`
+}
+
+func (g ConditionGroup) String() string {
+	return g.indentString("  ")
+}
+
+func (g ConditionGroup) indentString(indent string) string {
+	ret := fmt.Sprintf("%vGROUP: %v  OP:%v  A:%v\n", indent, g.Description,
+		g.Operator, g.Active)
+	for _, c := range g.Conditions {
+		ret += indent + fmt.Sprintf("%v", c)
+	}
+	for _, cg := range g.ConditionGroups {
+		ret += cg.indentString(indent + "  ")
+	}
+	return ret
+}
+
 // Action defines actions that can be taken if a rule is active.
 type Action struct {
 	ID          string `node:"id"`
@@ -122,7 +214,7 @@ type Action struct {
 	Description string `point:"description"`
 	Active      bool   `point:"active"`
 	Error       string `point:"error"`
-	// Action: notify, setValue, playAudio
+	// Action: notify, setValue, playAudio, webhook, exec
 	Action    string `point:"action"`
 	NodeID    string `point:"nodeID"`
 	PointType string `point:"pointType"`
@@ -130,10 +222,34 @@ type Action struct {
 	ValueType string  `point:"valueType"`
 	Value     float64 `point:"value"`
 	ValueText string  `point:"valueText"`
+	// Expression is evaluated to get the setValue value. If it is blank,
+	// Value or ValueText is used.
+	Expression string `point:"expression"`
+	// Sequence orders actions, lower numbers run first
+	Sequence int `point:"sequence"`
+	// Delay (seconds) from when the previous action in the sequence ran
+	Delay float64 `point:"delay"`
+	// RepeatPeriod (seconds) re-runs the action while the rule stays in the
+	// same state
+	RepeatPeriod float64 `point:"repeatPeriod"`
 	// the following are used for audio playback
 	PointChannel  int    `point:"pointChannel"`
 	PointDevice   string `point:"pointDevice"`
 	PointFilePath string `point:"pointFilePath"`
+	// Template is used to render the notify message, or the webhook body
+	Template string `point:"template"`
+	// Severity of notifications: info, warning, critical
+	Severity string `point:"severity"`
+	// the following are used for webhooks
+	URI     string            `point:"uri"`
+	Headers map[string]string `point:"header"`
+	// the following are used to run commands. Timeout is in seconds.
+	// Stdout of the last run is stored in Log and stderr in Error.
+	Command string            `point:"command"`
+	Args    []string          `point:"arg"`
+	Env     map[string]string `point:"env"`
+	Timeout float64           `point:"timeout"`
+	Log     string            `point:"log"`
 }
 
 func (a Action) String() string {
@@ -175,6 +291,10 @@ type ActionInactive struct {
 	ValueType string  `point:"valueType"`
 	Value     float64 `point:"value"`
 	ValueText string  `point:"valueText"`
+	// Sequence, Delay, and RepeatPeriod are described in Action
+	Sequence     int     `point:"sequence"`
+	Delay        float64 `point:"delay"`
+	RepeatPeriod float64 `point:"repeatPeriod"`
 	// the following are used for audio playback
 	PointChannel  int    `point:"pointChannel"`
 	PointDevice   string `point:"pointDevice"`
@@ -190,6 +310,31 @@ type RuleClient struct {
 	newEdgePoints chan NewPoints
 	newRulePoints chan NewPoints
 	upSub         *nats.Subscription
+	// points from nodes conditions refer to by ID
+	newNodePoints chan NewPoints
+	nodeSubs      map[string]*nats.Subscription
+	// errors for rule state conditions that form a dependency cycle,
+	// indexed by condition ID
+	cycleErrors map[string]string
+	condStates  map[string]*conditionState
+	// results of actions that run in the background (webhooks, exec)
+	actionResults chan actionResult
+	// requests to acknowledge the notification of the rule
+	ackSub *nats.Subscription
+	acks   chan *nats.Msg
+	// timezone inherited from ancestors for schedule conditions
+	timezone string
+	// actions waiting for a delay or repeat period
+	pendingActions []pendingAction
+	// next slot in the history ring
+	historyIndex int
+	// set when the rule is run by SimulateRule
+	sim *ruleSim
+}
+
+type actionResult struct {
+	id  string
+	err error
 }
 
 // NewRuleClient constructor ...
@@ -201,11 +346,30 @@ func NewRuleClient(nc *nats.Conn, config Rule) Client {
 		newPoints:     make(chan NewPoints),
 		newEdgePoints: make(chan NewPoints),
 		newRulePoints: make(chan NewPoints),
+		newNodePoints: make(chan NewPoints),
+		nodeSubs:      make(map[string]*nats.Subscription),
+		condStates:    make(map[string]*conditionState),
+		actionResults: make(chan actionResult),
+		acks:          make(chan *nats.Msg),
+		historyIndex:  nextHistoryIndex(config.History),
 	}
 }
 
 // Run runs the main logic for this client and blocks until stopped
 func (rc *RuleClient) Run() error {
+	// see createNotification
+	if len(rc.config.Notifications) < 1 && rc.hasNotifyAction() {
+		err := rc.createNotification(rc.notificationID(), data.Points{{
+			Time:   time.Now(),
+			Type:   data.PointTypeDescription,
+			Text:   rc.config.Description,
+			Origin: rc.config.ID,
+		}})
+		if err != nil {
+			log.Println("Rule error creating notification node:", err)
+		}
+	}
+
 	// watch all points that flow through parent node
 	// TODO: we should optimize this so we only watch the nodes
 	// that are in the conditions
@@ -233,6 +397,21 @@ func (rc *RuleClient) Run() error {
 		return fmt.Errorf("Rule error subscribing to upsub: %v", err)
 	}
 
+	if len(rc.config.Notifications) > 0 {
+		rc.ackSub, err = rc.nc.Subscribe(SubjectNotificationAck(rc.config.Notifications[0].ID),
+			func(msg *nats.Msg) {
+				select {
+				case rc.acks <- msg:
+				case <-rc.stop:
+				}
+			})
+
+		if err != nil {
+			_ = rc.upSub.Unsubscribe()
+			return fmt.Errorf("Rule error subscribing to notification acks: %v", err)
+		}
+	}
+
 	// TODO schedule ticker is a brute force way to do this
 	// we could optimize at some point by creating a timer to expire
 	// on the next schedule change
@@ -240,62 +419,86 @@ func (rc *RuleClient) Run() error {
 	scheduleTicker := time.NewTicker(scheduleTickTime)
 	if !rc.hasSchedule() {
 		scheduleTicker.Stop()
+	} else {
+		rc.updateTimezone()
 	}
 
-	run := func(id string, pts data.Points) {
-		var active, changed bool
-		var err error
-
-		if len(pts) > 0 {
-			active, changed, err = rc.ruleProcessPoints(id, pts)
-			if err != nil {
-				log.Println("Error processing rule point:", err)
-			}
+	// conditionTimer fires when a condition needs to be evaluated even if
+	// no points arrive (for instance, when minActive expires)
+	conditionTimer := time.NewTimer(time.Hour)
+	conditionTimer.Stop()
 
-			if !changed {
-				return
-			}
-		} else {
-			// send a schedule trigger through just in case someone changed a
-			// schedule condition
-			active, _, err = rc.ruleProcessPoints(rc.config.ID, data.Points{{
-				Time: time.Now(),
-				Type: data.PointTypeTrigger,
-			}})
-			if err != nil {
-				log.Println("Error processing rule point:", err)
-			}
+	resetConditionTimer := func() {
+		conditionTimer.Stop()
+		if next, ok := rc.nextConditionEvent(); ok {
+			conditionTimer.Reset(time.Until(next))
 		}
+	}
 
-		if active {
-			err := rc.ruleRunActions(rc.config.Actions, id)
-			if err != nil {
-				log.Println("Error running rule actions:", err)
-			}
+	// escalationTimer fires when an unacknowledged notification needs to
+	// be escalated
+	escalationTimer := time.NewTimer(time.Hour)
+	escalationTimer.Stop()
 
-			err = rc.ruleInactiveActions(rc.config.ActionsInactive)
-			if err != nil {
-				log.Println("Error running rule inactive actions:", err)
-			}
-		} else {
-			err := rc.ruleRunActions(rc.config.ActionsInactive, id)
-			if err != nil {
-				log.Println("Error running rule actions:", err)
-			}
+	resetEscalationTimer := func() {
+		escalationTimer.Stop()
+		if next, ok := rc.nextEscalation(); ok {
+			escalationTimer.Reset(time.Until(next))
+		}
+	}
 
-			err = rc.ruleInactiveActions(rc.config.Actions)
-			if err != nil {
-				log.Println("Error running rule inactive actions:", err)
-			}
+	// actionTimer fires when a delayed or repeating action needs to run
+	actionTimer := time.NewTimer(time.Hour)
+	actionTimer.Stop()
+
+	resetActionTimer := func() {
+		actionTimer.Stop()
+		if next, ok := rc.nextPendingAction(); ok {
+			actionTimer.Reset(time.Until(next))
 		}
 	}
 
+	// a notification may be pending escalation if the rule was restarted
+	resetEscalationTimer()
+
+	rc.updateNodeSubs()
+	rc.checkCycles()
+
+	// initialize condition state so that timers are started for conditions
+	// that must fire if no points arrive (for instance, no update conditions)
+	rc.walkConditions(func(c *Condition) {
+		rc.conditionState(c)
+	})
+	resetConditionTimer()
+
+	run := func(id string, pts data.Points) {
+		defer resetConditionTimer()
+		defer resetEscalationTimer()
+		defer resetActionTimer()
+
+		rc.process(id, pts)
+	}
+
+	// rule state conditions are initialized from the current state of the
+	// rules they watch, so evaluate the rule now
+	if rc.hasRuleState() {
+		run("", nil)
+	}
+
 done:
 	for {
 		select {
 		case <-rc.stop:
 			break done
 		case pts := <-rc.newRulePoints:
+			if _, ok := rc.nodeSubs[pts.ID]; ok {
+				// these points are also received by the node
+				// subscription
+				break
+			}
+			run(pts.ID, pts.Points)
+
+		case pts := <-rc.newNodePoints:
 			run(pts.ID, pts.Points)
 
 		case <-scheduleTicker.C:
@@ -304,17 +507,65 @@ done:
 				Type: data.PointTypeTrigger,
 			}})
 
+		case <-conditionTimer.C:
+			run(rc.config.ID, data.Points{{
+				Time: time.Now(),
+				Type: data.PointTypeTrigger,
+			}})
+
+		case r := <-rc.actionResults:
+			rc.actionSetError(r.id, r.err)
+			if a, ok := rc.findAction(r.id); ok {
+				rc.recordActionResult(a, r.err)
+			}
+
+		case <-actionTimer.C:
+			rc.runPendingActions()
+			resetActionTimer()
+
+		case <-escalationTimer.C:
+			rc.escalate()
+			resetEscalationTimer()
+
+		case msg := <-rc.acks:
+			reply := ""
+			err := rc.ackNotification(string(msg.Data))
+			if err != nil {
+				reply = err.Error()
+			}
+			resetEscalationTimer()
+
+			if msg.Reply != "" {
+				err := rc.nc.Publish(msg.Reply, []byte(reply))
+				if err != nil {
+					log.Println("Rule error sending ack reply:", err)
+				}
+			}
+
 		case pts := <-rc.newPoints:
 			err := data.MergePoints(pts.ID, pts.Points, &rc.config)
 			if err != nil {
 				log.Println("error merging rule points:", err)
 			}
+
+			if rc.isNotification(pts.ID) {
+				// notification state (acks) does not affect conditions
+				resetEscalationTimer()
+				break
+			}
+
+			// condition config changed, so reset runtime state
+			delete(rc.condStates, pts.ID)
 			if rc.hasSchedule() {
 				scheduleTicker = time.NewTicker(scheduleTickTime)
+				rc.updateTimezone()
 			} else {
 				scheduleTicker.Stop()
 			}
 
+			rc.updateNodeSubs()
+			rc.checkCycles()
+
 			run("", nil)
 		case pts := <-rc.newEdgePoints:
 			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &rc.config)
@@ -325,9 +576,76 @@ done:
 		}
 	}
 
+	rc.unsubscribeNodes()
+
+	if rc.ackSub != nil {
+		err := rc.ackSub.Unsubscribe()
+		if err != nil {
+			log.Println("Rule error unsubscribing from notification acks:", err)
+		}
+	}
+
 	return rc.upSub.Unsubscribe()
 }
 
+// process runs points through the rule conditions, and runs actions if the
+// rule state changed. If pts is empty, the rule is re-evaluated (for
+// instance, after a config change).
+func (rc *RuleClient) process(id string, pts data.Points) {
+	var active, changed bool
+	var err error
+
+	// the point that triggered the rule, used in action expressions
+	var trigger data.Point
+
+	if len(pts) > 0 {
+		trigger = pts[len(pts)-1]
+		active, changed, err = rc.ruleProcessPoints(id, pts)
+		if err != nil {
+			log.Println("Error processing rule point:", err)
+		}
+
+		if !changed {
+			return
+		}
+	} else {
+		// send a schedule trigger through just in case someone changed a
+		// schedule condition
+		trigger = data.Point{
+			Time: rc.now(),
+			Type: data.PointTypeTrigger,
+		}
+		active, _, err = rc.ruleProcessPoints(rc.config.ID, data.Points{trigger})
+		if err != nil {
+			log.Println("Error processing rule point:", err)
+		}
+	}
+
+	if active {
+		err := rc.ruleRunActions(rc.config.Actions, false, id, trigger)
+		if err != nil {
+			log.Println("Error running rule actions:", err)
+		}
+
+		rc.cancelPendingActions(true)
+		err = rc.ruleInactiveActions(rc.config.ActionsInactive)
+		if err != nil {
+			log.Println("Error running rule inactive actions:", err)
+		}
+	} else {
+		err := rc.ruleRunActions(rc.config.ActionsInactive, true, id, trigger)
+		if err != nil {
+			log.Println("Error running rule actions:", err)
+		}
+
+		rc.cancelPendingActions(false)
+		err = rc.ruleInactiveActions(rc.config.Actions)
+		if err != nil {
+			log.Println("Error running rule inactive actions:", err)
+		}
+	}
+}
+
 // Stop sends a signal to the Run function to exit
 func (rc *RuleClient) Stop(_ error) {
 	close(rc.stop)
@@ -355,16 +673,97 @@ func (rc *RuleClient) sendPoint(id string, point data.Point) error {
 		// setting Origin
 		point.Origin = rc.config.ID
 	}
+
+	if rc.sim != nil {
+		rc.sim.point(rc, id, point)
+		return nil
+	}
+
 	return SendNodePoint(rc.nc, id, point, false)
 }
 
+// nodePoints returns the points of a node in the store, or the points
+// received so far when simulating
+func (rc *RuleClient) nodePoints(id string) (data.Points, error) {
+	if rc.sim != nil {
+		pts, ok := rc.sim.nodes[id]
+		if !ok {
+			return nil, fmt.Errorf("node not found: %v", id)
+		}
+		return pts, nil
+	}
+
+	nodes, err := GetNodes(rc.nc, "all", id, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 1 {
+		return nil, fmt.Errorf("node not found: %v", id)
+	}
+
+	return nodes[0].Points, nil
+}
+
+// now returns the current time, or the simulation time when simulating
+func (rc *RuleClient) now() time.Time {
+	if rc.sim != nil {
+		return rc.sim.now
+	}
+	return time.Now()
+}
+
+// updateTimezone looks up the timezone schedule conditions inherit
+// from the rule or its ancestors
+func (rc *RuleClient) updateTimezone() {
+	if rc.sim != nil {
+		// the timezone is passed in when simulating
+		return
+	}
+
+	tz, err := findTimezone(rc.nc, rc.config.ID)
+	if err != nil {
+		log.Println("Rule error finding timezone:", err)
+		return
+	}
+	rc.timezone = tz
+}
+
 func (rc *RuleClient) hasSchedule() bool {
-	for _, c := range rc.config.Conditions {
+	found := false
+	rc.walkConditions(func(c *Condition) {
 		if c.ConditionType == data.PointValueSchedule {
-			return true
+			found = true
+		}
+	})
+	return found
+}
+
+// walkConditions calls f for every condition in the rule, including
+// conditions nested in condition groups.
+func (rc *RuleClient) walkConditions(f func(*Condition)) {
+	var walk func([]Condition, []ConditionGroup)
+	walk = func(conds []Condition, groups []ConditionGroup) {
+		for i := range conds {
+			f(&conds[i])
+		}
+		for i := range groups {
+			walk(groups[i].Conditions, groups[i].ConditionGroups)
+		}
+	}
+	walk(rc.config.Conditions, rc.config.ConditionGroups)
+}
+
+// walkConditionGroups calls f for every condition group in the rule.
+func (rc *RuleClient) walkConditionGroups(f func(*ConditionGroup)) {
+	var walk func([]ConditionGroup)
+	walk = func(groups []ConditionGroup) {
+		for i := range groups {
+			f(&groups[i])
+			walk(groups[i].ConditionGroups)
 		}
 	}
-	return false
+	walk(rc.config.ConditionGroups)
 }
 
 func (rc *RuleClient) processError(errS string) {
@@ -388,12 +787,17 @@ func (rc *RuleClient) processError(errS string) {
 		// check if any other errors still exist
 		found := ""
 
-		for _, c := range rc.config.Conditions {
-			if c.Error != "" {
+		rc.walkConditions(func(c *Condition) {
+			if found == "" && c.Error != "" {
 				found = c.Error
-				break
 			}
-		}
+		})
+
+		rc.walkConditionGroups(func(g *ConditionGroup) {
+			if found == "" && g.Error != "" {
+				found = g.Error
+			}
+		})
 
 		for _, a := range rc.config.Actions {
 			if a.Error != "" {
@@ -432,300 +836,798 @@ func (rc *RuleClient) processError(errS string) {
 // handle all current uses.
 func (rc *RuleClient) ruleProcessPoints(nodeID string, points data.Points) (bool, bool, error) {
 	for _, p := range points {
-		for i, c := range rc.config.Conditions {
-			var active bool
-			var errorActive bool
-
-			processError := func(err error) {
-				errorActive = true
-				errS := err.Error()
-				if c.Error != errS {
-					p := data.Point{
-						Type: data.PointTypeError,
-						Time: time.Now(),
-						Text: errS,
-					}
-
-					log.Printf("Rule cond error %v:%v:%v\n", rc.config.Description, c.Description, err)
-					err := rc.sendPoint(c.ID, p)
-					if err != nil {
-						log.Println("Rule error sending point:", err)
-					} else {
-						rc.config.Conditions[i].Error = errS
-					}
-				}
-				rc.processError(errS)
+		rc.walkConditions(func(c *Condition) {
+			rc.conditionProcessPoint(c, nodeID, p)
+		})
+	}
+
+	// the rule is active if all top level conditions and condition groups
+	// are active
+	allActive, err := rc.conditionsActive(data.PointValueAnd,
+		rc.config.Conditions, rc.config.ConditionGroups)
+	if err != nil {
+		return false, false, err
+	}
+
+	changed := false
+
+	if allActive != rc.config.Active {
+		p := data.Point{
+			Type:  data.PointTypeActive,
+			Time:  time.Now(),
+			Value: data.BoolToFloat(allActive),
+		}
+
+		err := rc.sendPoint(rc.config.ID, p)
+		if err != nil {
+			log.Println("Rule error sending point:", err)
+		}
+		changed = true
+
+		rc.config.Active = allActive
+
+		if len(points) > 0 {
+			rc.recordStateChange(allActive, nodeID, points[len(points)-1])
+		}
+	}
+
+	return allActive, changed, nil
+}
+
+// conditionProcessPoint runs a point through a condition and updates the
+// condition active and error state.
+func (rc *RuleClient) conditionProcessPoint(c *Condition, nodeID string, p data.Point) {
+	var active bool
+	var errorActive bool
+
+	processError := func(err error) {
+		errorActive = true
+		errS := err.Error()
+		if c.Error != errS {
+			p := data.Point{
+				Type: data.PointTypeError,
+				Time: time.Now(),
+				Text: errS,
 			}
 
-			switch c.ConditionType {
-			case data.PointValuePointValue:
-				if c.NodeID != "" && c.NodeID != nodeID {
-					continue
-				}
+			log.Printf("Rule cond error %v:%v:%v\n", rc.config.Description, c.Description, err)
+			err := rc.sendPoint(c.ID, p)
+			if err != nil {
+				log.Println("Rule error sending point:", err)
+			} else {
+				c.Error = errS
+			}
+		}
+		rc.processError(errS)
+	}
 
-				if c.PointKey != "" && c.PointKey != p.Key {
-					continue
-				}
+	switch c.ConditionType {
+	case data.PointValuePointValue:
+		st := rc.conditionState(c)
 
-				if c.PointType != "" && c.PointType != p.Type {
-					continue
-				}
+		// trigger points are used to re-evaluate timing (minActive), so
+		// they do not update the raw condition state
+		if p.Type != data.PointTypeTrigger {
+			if !c.pointMatch(nodeID, p) {
+				return
+			}
 
-				// conditions match, so check value
-				switch c.ValueType {
-				case data.PointValueNumber:
-					switch c.Operator {
-					case data.PointValueGreaterThan:
-						active = p.Value > c.Value
-					case data.PointValueLessThan:
-						active = p.Value < c.Value
-					case data.PointValueEqual:
-						active = p.Value == c.Value
-					case data.PointValueNotEqual:
-						active = p.Value != c.Value
-					}
-				case data.PointValueText:
-					switch c.Operator {
-					case data.PointValueEqual:
-					case data.PointValueNotEqual:
-					case data.PointValueContains:
-					}
-				case data.PointValueOnOff:
-					condValue := c.Value != 0
-					pointValue := p.Value != 0
-					active = condValue == pointValue
-				default:
-					processError(fmt.Errorf("unknown value type: %v", c.ValueType))
+			// conditions match, so check value
+			var rawActive bool
+			switch c.ValueType {
+			case data.PointValueNumber:
+				v, ok, err := c.statValue(st, p)
+				if err != nil {
+					processError(err)
+					break
 				}
-			case data.PointValueSchedule:
-				if p.Type != data.PointTypeTrigger {
-					continue
+				if !ok {
+					// not enough data for statistic yet, so keep state
+					rawActive = st.rawActive
+					break
 				}
-
-				weekdays := []time.Weekday{}
-				for i, v := range c.Weekdays {
-					if v {
-						weekdays = append(weekdays, time.Weekday(i))
-					}
+				rawActive = c.numberActive(v, st.rawActive)
+			case data.PointValueText:
+				switch c.Operator {
+				case data.PointValueEqual:
+				case data.PointValueNotEqual:
+				case data.PointValueContains:
 				}
-				sched := newSchedule(c.Start, c.End, weekdays, c.Dates)
+			case data.PointValueOnOff:
+				condValue := c.Value != 0
+				pointValue := p.Value != 0
+				rawActive = condValue == pointValue
+			default:
+				processError(fmt.Errorf("unknown value type: %v", c.ValueType))
+			}
 
-				var err error
-				active, err = sched.activeForTime(p.Time)
-				if err != nil {
-					processError(fmt.Errorf("Error parsing schedule: %w", err))
-					continue
-				}
+			if rawActive && !st.rawActive {
+				st.rawActiveStart = pointTime(p)
 			}
+			st.rawActive = rawActive
+		}
 
-			if active != c.Active {
-				// update condition
-				p := data.Point{
-					Type:  data.PointTypeActive,
-					Time:  time.Now(),
-					Value: data.BoolToFloat(active),
-				}
+		active = c.applyMinActive(st, pointTime(p))
+	case data.PointValueNoUpdate:
+		if c.Timeout <= 0 {
+			processError(fmt.Errorf("no update timeout must be set"))
+			return
+		}
 
-				err := rc.sendPoint(c.ID, p)
-				if err != nil {
-					log.Println("Rule error sending point:", err)
-				}
+		st := rc.conditionState(c)
 
-				rc.config.Conditions[i].Active = active
+		if p.Type != data.PointTypeTrigger {
+			if !c.pointMatch(nodeID, p) {
+				return
 			}
 
-			if !errorActive && c.Error != "" {
-				p := data.Point{
-					Type: data.PointTypeError,
-					Time: time.Now(),
-					Text: "",
-				}
+			if t := pointTime(p); t.After(st.lastUpdate) {
+				st.lastUpdate = t
+			}
+		}
 
-				err := rc.sendPoint(c.ID, p)
-				if err != nil {
-					log.Println("Rule error sending point:", err)
-				} else {
-					rc.config.Conditions[i].Error = ""
+		active = c.noUpdateActive(st, pointTime(p))
+	case data.PointValueRuleState:
+		if c.NodeID == "" {
+			processError(fmt.Errorf("rule state condition must have a rule node ID"))
+			return
+		}
+
+		if errS := rc.cycleErrors[c.ID]; errS != "" {
+			// a rule in a cycle would toggle forever
+			processError(errors.New(errS))
+			break
+		}
+
+		st := rc.conditionState(c)
+
+		if p.Type != data.PointTypeTrigger {
+			if nodeID != c.NodeID || p.Type != data.PointTypeActive {
+				return
+			}
+
+			rawActive := (p.Value != 0) == (c.Value != 0)
+			if rawActive && !st.rawActive {
+				st.rawActiveStart = pointTime(p)
+			}
+			st.rawActive = rawActive
+		}
+
+		active = c.applyMinActive(st, pointTime(p))
+	case data.PointValueSchedule:
+		st := rc.conditionState(c)
+
+		if p.Type != data.PointTypeTrigger {
+			if c.NodeID != "" && nodeID == c.NodeID {
+				st.updatePosition(p)
+			}
+			return
+		}
+
+		var sched *schedule
+		if c.Cron != "" {
+			sched = newCronSchedule(c.Cron)
+		} else {
+			weekdays := []time.Weekday{}
+			for i, v := range c.Weekdays {
+				if v {
+					weekdays = append(weekdays, time.Weekday(i))
 				}
-				rc.processError("")
 			}
+			sched = newSchedule(c.Start, c.End, weekdays, c.Dates)
+		}
+
+		if c.Latitude != 0 || c.Longitude != 0 {
+			sched.position = &data.GpsPos{Lat: c.Latitude, Long: c.Longitude}
+		} else {
+			sched.position = st.position()
+		}
+
+		tz := c.Timezone
+		if tz == "" {
+			tz = rc.timezone
+		}
+
+		var err error
+		sched.location, err = loadLocation(tz)
+		if err != nil {
+			processError(err)
+			return
+		}
+
+		active, err = sched.activeForTime(p.Time)
+		if err != nil {
+			processError(fmt.Errorf("Error parsing schedule: %w", err))
+			return
 		}
 	}
 
-	allActive := true
+	if active != c.Active {
+		// update condition
+		p := data.Point{
+			Type:  data.PointTypeActive,
+			Time:  time.Now(),
+			Value: data.BoolToFloat(active),
+		}
 
-	for _, c := range rc.config.Conditions {
-		if !c.Active {
-			allActive = false
-			break
+		err := rc.sendPoint(c.ID, p)
+		if err != nil {
+			log.Println("Rule error sending point:", err)
 		}
+
+		c.Active = active
 	}
 
-	changed := false
+	if !errorActive && c.Error != "" {
+		p := data.Point{
+			Type: data.PointTypeError,
+			Time: time.Now(),
+			Text: "",
+		}
 
-	if allActive != rc.config.Active {
+		err := rc.sendPoint(c.ID, p)
+		if err != nil {
+			log.Println("Rule error sending point:", err)
+		} else {
+			c.Error = ""
+		}
+		rc.processError("")
+	}
+}
+
+// conditionState returns the runtime state for a condition. The state is
+// initialized from the condition active point if it does not exist yet.
+func (rc *RuleClient) conditionState(c *Condition) *conditionState {
+	st, ok := rc.condStates[c.ID]
+	if !ok {
+		st = &conditionState{rawActive: c.Active, lastUpdate: rc.now()}
+		if c.ConditionType == data.PointValueNoUpdate {
+			if t, ok := rc.lastPointTime(c); ok {
+				st.lastUpdate = t
+			}
+		}
+		if c.ConditionType == data.PointValueSchedule && c.NodeID != "" {
+			rc.loadPosition(c, st)
+		}
+		if c.ConditionType == data.PointValueRuleState && c.NodeID != "" {
+			rc.loadRuleState(c, st)
+		}
+		rc.condStates[c.ID] = st
+	}
+	return st
+}
+
+// lastPointTime looks up the time of the newest point in the store that
+// matches a condition. This is used to initialize no update conditions so
+// that a sensor that is already offline is detected when the rule starts.
+func (rc *RuleClient) lastPointTime(c *Condition) (time.Time, bool) {
+	if c.NodeID == "" {
+		return time.Time{}, false
+	}
+
+	points, err := rc.nodePoints(c.NodeID)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var ret time.Time
+	found := false
+	for _, p := range points {
+		if !c.pointMatch(c.NodeID, p) {
+			continue
+		}
+		if p.Time.After(ret) {
+			ret = p.Time
+			found = true
+		}
+	}
+
+	return ret, found
+}
+
+// loadPosition initializes the location of a schedule condition from the
+// latitude and longitude points of the condition node (for instance a GPS
+// node). The location is updated as new points arrive.
+func (rc *RuleClient) loadPosition(c *Condition, st *conditionState) {
+	points, err := rc.nodePoints(c.NodeID)
+	if err != nil {
+		return
+	}
+
+	for _, p := range points {
+		st.updatePosition(p)
+	}
+}
+
+// evalExpression evaluates a setValue action expression. The expression can
+// reference the point that triggered the rule (trigger.value, trigger.text,
+// trigger.type, trigger.key, trigger.nodeID) and points of other nodes
+// (node["id"].temp).
+func (rc *RuleClient) evalExpression(src, triggerNodeID string, trigger data.Point) (any, error) {
+	expr, err := parseExpression(src)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]map[string]any)
+
+	env := &exprEnv{
+		vars: map[string]any{
+			"trigger": map[string]any{
+				"nodeID": triggerNodeID,
+				"type":   trigger.Type,
+				"key":    trigger.Key,
+				"value":  trigger.Value,
+				"text":   trigger.Text,
+			},
+		},
+		node: func(id string) (map[string]any, error) {
+			if n, ok := nodes[id]; ok {
+				return n, nil
+			}
+
+			points, err := rc.nodePoints(id)
+			if err != nil {
+				return nil, fmt.Errorf("expression: %w", err)
+			}
+
+			n := exprPoints(points)
+			nodes[id] = n
+			return n, nil
+		},
+	}
+
+	return expr.eval(env)
+}
+
+// nextConditionEvent returns the time when conditions need to be
+// re-evaluated even if no points arrive. ok is false if nothing is pending.
+func (rc *RuleClient) nextConditionEvent() (next time.Time, ok bool) {
+	rc.walkConditions(func(c *Condition) {
+		st, found := rc.condStates[c.ID]
+		if !found {
+			return
+		}
+		t, pending := c.nextEvent(st)
+		if pending && (!ok || t.Before(next)) {
+			next = t
+			ok = true
+		}
+	})
+	return
+}
+
+// pointTime returns the point time, or the current time if not set.
+func pointTime(p data.Point) time.Time {
+	if p.Time.IsZero() {
+		return time.Now()
+	}
+	return p.Time
+}
+
+// conditionsActive combines the active state of conditions and condition
+// groups using operator. Condition groups are evaluated recursively and their
+// active and error points are updated as needed.
+func (rc *RuleClient) conditionsActive(operator string, conds []Condition,
+	groups []ConditionGroup) (bool, error) {
+	var states []bool
+
+	for _, c := range conds {
+		states = append(states, c.Active)
+	}
+
+	for i := range groups {
+		states = append(states, rc.conditionGroupProcess(&groups[i]))
+	}
+
+	return conditionGroupActive(operator, states)
+}
+
+// conditionGroupProcess evaluates a condition group and sends active and
+// error points for the group if they changed.
+func (rc *RuleClient) conditionGroupProcess(g *ConditionGroup) bool {
+	active, err := rc.conditionsActive(g.Operator, g.Conditions, g.ConditionGroups)
+
+	errS := ""
+	if err != nil {
+		errS = err.Error()
+	}
+
+	if errS != g.Error {
+		if errS != "" {
+			log.Printf("Rule cond group error %v:%v:%v\n", rc.config.Description, g.Description, err)
+		}
+
+		p := data.Point{
+			Type: data.PointTypeError,
+			Time: time.Now(),
+			Text: errS,
+		}
+
+		err := rc.sendPoint(g.ID, p)
+		if err != nil {
+			log.Println("Rule error sending point:", err)
+		} else {
+			g.Error = errS
+		}
+		rc.processError(errS)
+	}
+
+	if active != g.Active {
 		p := data.Point{
 			Type:  data.PointTypeActive,
 			Time:  time.Now(),
-			Value: data.BoolToFloat(allActive),
+			Value: data.BoolToFloat(active),
 		}
 
-		err := rc.sendPoint(rc.config.ID, p)
+		err := rc.sendPoint(g.ID, p)
 		if err != nil {
 			log.Println("Rule error sending point:", err)
 		}
-		changed = true
 
-		rc.config.Active = allActive
+		g.Active = active
 	}
 
-	return allActive, changed, nil
+	return active
 }
 
-// ruleRunActions runs rule actions
-func (rc *RuleClient) ruleRunActions(actions []Action, triggerNodeID string) error {
-	for i, a := range actions {
-		errorActive := false
-
-		processError := func(err error) {
-			errorActive = true
-			errS := err.Error()
-			if a.Error != errS {
-				p := data.Point{
-					Type: data.PointTypeError,
-					Time: time.Now(),
-					Text: errS,
-				}
-
-				log.Printf("Rule action error %v:%v:%v\n", rc.config.Description, a.Description, err)
-				err := rc.sendPoint(a.ID, p)
-				if err != nil {
-					log.Println("Rule error sending point:", err)
-				} else {
-					actions[i].Error = errS
-				}
+// conditionGroupActive applies a group operator to a list of child active
+// states. An empty operator is treated as and.
+func conditionGroupActive(operator string, states []bool) (bool, error) {
+	switch operator {
+	case data.PointValueAnd, "":
+		for _, s := range states {
+			if !s {
+				return false, nil
 			}
-			rc.processError(errS)
 		}
+		return true, nil
+	case data.PointValueOr:
+		for _, s := range states {
+			if s {
+				return true, nil
+			}
+		}
+		return false, nil
+	case data.PointValueNot:
+		for _, s := range states {
+			if s {
+				return false, nil
+			}
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown condition group operator: %v", operator)
+	}
+}
 
-		switch a.Action {
-		case data.PointValueSetValue:
-			if a.NodeID == "" {
-				processError(fmt.Errorf("Error, node action nodeID must be set"))
-				break
+// runAction runs actions[i]. trigger is the point that caused the rule to
+// run.
+func (rc *RuleClient) runAction(actions []Action, i int, triggerNodeID string,
+	trigger data.Point) error {
+	a := actions[i]
+
+	if rc.sim != nil {
+		rc.sim.action(rc, a, triggerNodeID, trigger)
+		return nil
+	}
+
+	errorActive := false
+	var actionErr error
+	// actions that run in the background record their result when they
+	// complete
+	background := false
+
+	processError := func(err error) {
+		errorActive = true
+		actionErr = err
+		errS := err.Error()
+		if a.Error != errS {
+			p := data.Point{
+				Type: data.PointTypeError,
+				Time: time.Now(),
+				Text: errS,
 			}
 
-			if a.PointType == "" {
-				processError(fmt.Errorf("Error, node action point type must be set"))
-				break
+			log.Printf("Rule action error %v:%v:%v\n", rc.config.Description, a.Description, err)
+			err := rc.sendPoint(a.ID, p)
+			if err != nil {
+				log.Println("Rule error sending point:", err)
+			} else {
+				actions[i].Error = errS
 			}
+		}
+		rc.processError(errS)
+	}
 
-			p := data.Point{
-				Time:   time.Now(),
-				Type:   a.PointType,
-				Value:  a.Value,
-				Text:   a.ValueText,
-				Origin: a.ID,
+	switch a.Action {
+	case data.PointValueSetValue:
+		p, err := rc.setValuePoint(a, triggerNodeID, trigger)
+		if err != nil {
+			processError(err)
+			break
+		}
+
+		err = rc.sendPoint(a.NodeID, p)
+		if err != nil {
+			log.Println("Error sending rule action point:", err)
+		}
+	case data.PointValueNotify:
+		// get node that fired the rule
+		nodes, err := GetNodes(rc.nc, "all", triggerNodeID, "", false)
+		if err != nil {
+			processError(err)
+			break
+		}
+
+		if len(nodes) < 1 {
+			processError(fmt.Errorf("trigger node not found"))
+			break
+		}
+
+		triggerNode := nodes[0]
+
+		triggerNodeDesc := triggerNode.Desc()
+
+		message := rc.config.Description + " fired at " + triggerNodeDesc
+
+		if a.Template != "" {
+			td := newNotifyTemplateData(triggerNode)
+			td.Rule = rc.config.Description
+
+			if triggerNode.Parent != "" && triggerNode.Parent != "root" {
+				// the parent is only used for context in the message,
+				// so leave it blank if it can't be found
+				parents, err := GetNodes(rc.nc, "all", triggerNode.Parent, "", false)
+				if err != nil {
+					log.Println("Rule error getting trigger node parent:", err)
+				} else if len(parents) > 0 {
+					td.Parent = parents[0].Desc()
+				}
 			}
-			err := rc.sendPoint(a.NodeID, p)
+
+			message, err = renderNotifyTemplate(td, a.Template)
 			if err != nil {
-				log.Println("Error sending rule action point:", err)
+				processError(fmt.Errorf("notify template error: %w", err))
+				break
 			}
-		case data.PointValueNotify:
-			// get node that fired the rule
-			nodes, err := GetNodes(rc.nc, "none", triggerNodeID, "", false)
+		}
+
+		n := data.Notification{
+			ID:         rc.notificationID(),
+			SourceNode: a.NodeID,
+			Message:    message,
+			Severity:   a.Severity,
+		}
+
+		// TODO this notify code needs to be reworked
+		d, err := n.ToPb()
+
+		if err != nil {
+			return err
+		}
+
+		err = rc.nc.Publish(SubjectNodeNotification(rc.config.ID), d)
+
+		if err != nil {
+			return err
+		}
+
+		err = rc.notificationSent(n, triggerNodeID)
+		if err != nil {
+			log.Println("Rule error saving notification state:", err)
+		}
+	case data.PointValueWebhook:
+		if a.URI == "" {
+			processError(fmt.Errorf("Error, webhook action URI must be set"))
+			break
+		}
+
+		wd := WebhookData{Time: time.Now()}
+
+		if triggerNodeID != "" {
+			nodes, err := GetNodes(rc.nc, "all", triggerNodeID, "", false)
 			if err != nil {
 				processError(err)
 				break
 			}
 
-			if len(nodes) < 1 {
-				processError(fmt.Errorf("trigger node not found"))
-				break
+			if len(nodes) > 0 {
+				wd = newWebhookData(nodes[0])
 			}
+		}
 
-			triggerNode := nodes[0]
+		wd.RuleID = rc.config.ID
+		wd.Rule = rc.config.Description
+		wd.Active = rc.config.Active
+
+		// webhooks may take a while to complete if retried, so run in
+		// the background and report the result back to the run loop
+		background = true
+		go func(a Action) {
+			err := sendWebhook(a.URI, a.Headers, a.Template, wd)
+			select {
+			case rc.actionResults <- actionResult{a.ID, err}:
+			case <-rc.stop:
+			}
+		}(a)
+	case data.PointValueExec:
+		if !ruleExec.Load() {
+			processError(errRuleExecDisabled)
+			break
+		}
 
-			triggerNodeDesc := triggerNode.Desc()
+		if a.Command == "" {
+			processError(fmt.Errorf("Error, exec action command must be set"))
+			break
+		}
 
-			n := data.Notification{
-				ID:         uuid.New().String(),
-				SourceNode: a.NodeID,
-				Message:    rc.config.Description + " fired at " + triggerNodeDesc,
-			}
+		env := append(sortedEnv(a.Env), execEnv(rc.config.ID,
+			rc.config.Description, rc.config.Active, triggerNodeID, trigger)...)
 
-			// TODO this notify code needs to be reworked
-			d, err := n.ToPb()
+		// commands may run for a while, so run in the background and
+		// report the result back to the run loop
+		background = true
+		go func(a Action) {
+			stdout, stderr, err := runCommand(a.Command, a.Args, env,
+				secondsDuration(a.Timeout))
 
-			if err != nil {
-				return err
+			p := data.Point{
+				Type: data.PointTypeLog,
+				Time: time.Now(),
+				Text: stdout,
 			}
 
-			err = rc.nc.Publish("node."+rc.config.ID+".not", d)
-
-			if err != nil {
-				return err
+			errSend := rc.sendPoint(a.ID, p)
+			if errSend != nil {
+				log.Println("Rule error sending point:", errSend)
 			}
-		case data.PointValuePlayAudio:
-			f, err := os.Open(a.PointFilePath)
-			if err != nil {
-				log.Fatal(err)
+
+			select {
+			case rc.actionResults <- actionResult{a.ID, execError(stderr, err)}:
+			case <-rc.stop:
 			}
-			defer f.Close()
+		}(a)
+	case data.PointValuePlayAudio:
+		f, err := os.Open(a.PointFilePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
 
-			d := wav.NewDecoder(f)
-			d.ReadInfo()
+		d := wav.NewDecoder(f)
+		d.ReadInfo()
 
-			format := d.Format()
+		format := d.Format()
 
-			if format.SampleRate < 8000 {
-				log.Println("Rule action: invalid wave file sample rate:", format.SampleRate)
-				continue
+		if format.SampleRate < 8000 {
+			log.Println("Rule action: invalid wave file sample rate:", format.SampleRate)
+			return nil
+		}
+
+		channelNum := strconv.Itoa(a.PointChannel)
+		sampleRate := strconv.Itoa(format.SampleRate)
+
+		go func() {
+			stderr, err := exec.Command("speaker-test", "-D"+a.PointDevice, "-twav", "-w"+a.PointFilePath, "-c5", "-s"+channelNum, "-r"+sampleRate).CombinedOutput()
+			if err != nil {
+				log.Println("Play audio error:", err)
+				log.Printf("Audio stderr: %s\n", stderr)
 			}
+		}()
+	default:
+		processError(fmt.Errorf("Uknown rule action: %v", a.Action))
+	}
 
-			channelNum := strconv.Itoa(a.PointChannel)
-			sampleRate := strconv.Itoa(format.SampleRate)
+	p := data.Point{
+		Type:  data.PointTypeActive,
+		Value: 1,
+	}
+	err := rc.sendPoint(a.ID, p)
+	if err != nil {
+		log.Println("Error sending rule action point:", err)
+	}
 
-			go func() {
-				stderr, err := exec.Command("speaker-test", "-D"+a.PointDevice, "-twav", "-w"+a.PointFilePath, "-c5", "-s"+channelNum, "-r"+sampleRate).CombinedOutput()
-				if err != nil {
-					log.Println("Play audio error:", err)
-					log.Printf("Audio stderr: %s\n", stderr)
-				}
-			}()
-		default:
-			processError(fmt.Errorf("Uknown rule action: %v", a.Action))
-		}
+	actions[i].Active = true
 
+	if !background {
+		rc.recordActionResult(a, actionErr)
+	}
+
+	if !errorActive && a.Error != "" {
 		p := data.Point{
-			Type:  data.PointTypeActive,
-			Value: 1,
+			Type: data.PointTypeError,
+			Time: time.Now(),
+			Text: "",
 		}
+
 		err := rc.sendPoint(a.ID, p)
 		if err != nil {
-			log.Println("Error sending rule action point:", err)
+			log.Println("Rule error sending point:", err)
+		} else {
+			actions[i].Error = ""
+		}
+		rc.processError("")
+	}
+
+	return nil
+}
+
+// setValuePoint returns the point a setValue action sends to a.NodeID
+func (rc *RuleClient) setValuePoint(a Action, triggerNodeID string,
+	trigger data.Point) (data.Point, error) {
+	if a.NodeID == "" {
+		return data.Point{}, fmt.Errorf("Error, node action nodeID must be set")
+	}
+
+	if a.PointType == "" {
+		return data.Point{}, fmt.Errorf("Error, node action point type must be set")
+	}
+
+	p := data.Point{
+		Time:   rc.now(),
+		Type:   a.PointType,
+		Value:  a.Value,
+		Text:   a.ValueText,
+		Origin: a.ID,
+	}
+
+	if a.Expression != "" {
+		v, err := rc.evalExpression(a.Expression, triggerNodeID, trigger)
+		if err != nil {
+			return data.Point{}, err
 		}
 
-		actions[i].Active = true
+		p.Value, p.Text = 0, ""
+		switch v := v.(type) {
+		case float64:
+			p.Value = v
+		case bool:
+			p.Value = data.BoolToFloat(v)
+		case string:
+			p.Text = v
+		}
+	}
+
+	return p, nil
+}
+
+// actionSetError updates the error point of an action after it completes
+// in the background.
+func (rc *RuleClient) actionSetError(id string, err error) {
+	errS := ""
+	if err != nil {
+		errS = err.Error()
+	}
+
+	update := func(actions []Action) {
+		for i, a := range actions {
+			if a.ID != id || a.Error == errS {
+				continue
+			}
+
+			if err != nil {
+				log.Printf("Rule action error %v:%v:%v\n", rc.config.Description, a.Description, err)
+			}
 
-		if !errorActive && a.Error != "" {
 			p := data.Point{
 				Type: data.PointTypeError,
 				Time: time.Now(),
-				Text: "",
+				Text: errS,
 			}
 
 			err := rc.sendPoint(a.ID, p)
 			if err != nil {
 				log.Println("Rule error sending point:", err)
 			} else {
-				actions[i].Error = ""
+				actions[i].Error = errS
 			}
-			rc.processError("")
+			rc.processError(errS)
 		}
-
 	}
-	return nil
+
+	update(rc.config.Actions)
+	update(rc.config.ActionsInactive)
 }
 
 func (rc *RuleClient) ruleInactiveActions(actions []Action) error {
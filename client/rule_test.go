@@ -1,9 +1,15 @@
 package client_test
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
 	"github.com/simpleiot/simpleiot/server"
@@ -138,6 +144,33 @@ func TestRules(t *testing.T) {
 		<-time.After(time.Millisecond * 10)
 	}
 
+	// the rule going active and the action should be in the history
+	var history []data.RuleHistory
+	start = time.Now()
+	for {
+		history, err = client.GetRuleHistory(nc, r.ID)
+		if err != nil {
+			t.Fatal("Error getting rule history: ", err)
+		}
+		if len(history) >= 2 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for rule history, got: ", history)
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if history[0].Event != data.RuleHistoryActive || history[0].NodeID != vin.ID ||
+		history[0].Value != 1 {
+		t.Error("Rule active history is not correct: ", history[0])
+	}
+
+	if history[1].Event != data.RuleHistoryAction || history[1].ActionID != a.ID ||
+		history[1].Error != "" {
+		t.Error("Rule action history is not correct: ", history[1])
+	}
+
 	// clear vin and look for vout to change
 	// FIXME: the following fails due to bug in the client manager, disabling for
 	// now until we get that fixed.
@@ -161,3 +194,689 @@ func TestRules(t *testing.T) {
 		<-time.After(time.Millisecond * 10)
 	}
 }
+
+// TestRuleConditionGroup tests a rule with an "or" condition group
+// containing two conditions.
+func TestRuleConditionGroup(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	vin1 := client.Variable{ID: "ID-varin1", Parent: root.ID, Description: "var in 1"}
+	vin2 := client.Variable{ID: "ID-varin2", Parent: root.ID, Description: "var in 2"}
+	vout := client.Variable{ID: "ID-varout", Parent: root.ID, Description: "var out"}
+
+	for _, v := range []client.Variable{vin1, vin2, vout} {
+		err = client.SendNodeType(nc, v, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "test rule",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	g := client.ConditionGroup{
+		ID:          "ID-group",
+		Parent:      r.ID,
+		Description: "vin1 or vin2",
+		Operator:    data.PointValueOr,
+	}
+
+	err = client.SendNodeType(nc, g, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	for _, v := range []client.Variable{vin1, vin2} {
+		c := client.Condition{
+			ID:            "ID-cond-" + v.ID,
+			Parent:        g.ID,
+			Description:   v.Description + " high",
+			ConditionType: data.PointValuePointValue,
+			PointType:     data.PointTypeValue,
+			ValueType:     data.PointValueOnOff,
+			NodeID:        v.ID,
+			Operator:      data.PointValueEqual,
+			Value:         1,
+		}
+
+		err = client.SendNodeType(nc, c, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	a := client.Action{
+		ID:          "ID-action-active",
+		Parent:      r.ID,
+		Description: "action active",
+		Action:      data.PointValueSetValue,
+		PointType:   data.PointTypeValue,
+		NodeID:      vout.ID,
+		Value:       1,
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	voutGet, voutStop, err := client.NodeWatcher[client.Variable](nc, vout.ID, vout.Parent)
+	if err != nil {
+		t.Fatal("Error setting up watcher")
+	}
+
+	defer voutStop()
+
+	groupGet, groupStop, err := client.NodeWatcher[client.ConditionGroup](nc, g.ID, g.Parent)
+	if err != nil {
+		t.Fatal("Error setting up watcher")
+	}
+
+	defer groupStop()
+
+	// wait for rule to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	// setting only the second input should activate the rule
+	err = client.SendNodePoint(nc, vin2.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+
+	if err != nil {
+		t.Errorf("Error sending point: %v", err)
+	}
+
+	start := time.Now()
+	for {
+		if voutGet().Value == 1 && groupGet().Active {
+			// all is well
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for vout to be set")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+}
+
+// TestRuleActionSequence tests that delayed actions run in sequence order
+// after the delay.
+func TestRuleActionSequence(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	vin := client.Variable{ID: "ID-varin", Parent: root.ID, Description: "var in"}
+	valve := client.Variable{ID: "ID-valve", Parent: root.ID, Description: "valve"}
+	pump := client.Variable{ID: "ID-pump", Parent: root.ID, Description: "pump"}
+
+	for _, v := range []client.Variable{vin, valve, pump} {
+		err = client.SendNodeType(nc, v, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "test rule",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	c := client.Condition{
+		ID:            "ID-condition",
+		Parent:        r.ID,
+		Description:   "cond vin high",
+		ConditionType: data.PointValuePointValue,
+		PointType:     data.PointTypeValue,
+		ValueType:     data.PointValueOnOff,
+		NodeID:        vin.ID,
+		Operator:      data.PointValueEqual,
+		Value:         1,
+	}
+
+	err = client.SendNodeType(nc, c, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// the pump action is listed first, but runs second
+	actions := []client.Action{
+		{
+			ID:          "ID-action-pump",
+			Parent:      r.ID,
+			Description: "stop pump",
+			Action:      data.PointValueSetValue,
+			PointType:   data.PointTypeValue,
+			NodeID:      pump.ID,
+			Value:       1,
+			Sequence:    2,
+			Delay:       0.5,
+		},
+		{
+			ID:          "ID-action-valve",
+			Parent:      r.ID,
+			Description: "close valve",
+			Action:      data.PointValueSetValue,
+			PointType:   data.PointTypeValue,
+			NodeID:      valve.ID,
+			Value:       1,
+			Sequence:    1,
+		},
+	}
+
+	for _, a := range actions {
+		err = client.SendNodeType(nc, a, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	valveGet, valveStop, err := client.NodeWatcher[client.Variable](nc, valve.ID, valve.Parent)
+	if err != nil {
+		t.Fatal("Error setting up watcher")
+	}
+
+	defer valveStop()
+
+	pumpGet, pumpStop, err := client.NodeWatcher[client.Variable](nc, pump.ID, pump.Parent)
+	if err != nil {
+		t.Fatal("Error setting up watcher")
+	}
+
+	defer pumpStop()
+
+	// wait for rule to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+
+	if err != nil {
+		t.Errorf("Error sending point: %v", err)
+	}
+
+	start := time.Now()
+	for {
+		if valveGet().Value == 1 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for valve to be set")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if pumpGet().Value != 0 {
+		t.Fatal("pump was set before the delay expired")
+	}
+
+	for {
+		if pumpGet().Value == 1 {
+			break
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("Timeout waiting for pump to be set")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if time.Since(start) < 400*time.Millisecond {
+		t.Error("pump was set before the delay expired")
+	}
+}
+
+// TestRuleChain tests a rule that depends on the state of another rule, where
+// the variables are in devices.
+func TestRuleChain(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	devs := []client.Device{
+		{ID: "ID-dev1", Parent: root.ID, Description: "dev 1"},
+		{ID: "ID-dev2", Parent: root.ID, Description: "dev 2"},
+	}
+
+	for _, d := range devs {
+		err = client.SendNodeType(nc, d, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	vin := client.Variable{ID: "ID-varin", Parent: devs[0].ID, Description: "var in"}
+	vout := client.Variable{ID: "ID-varout", Parent: devs[1].ID, Description: "var out"}
+
+	for _, v := range []client.Variable{vin, vout} {
+		err = client.SendNodeType(nc, v, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	r1 := client.Rule{ID: "ID-rule1", Parent: root.ID, Description: "vin high"}
+	r2 := client.Rule{ID: "ID-rule2", Parent: root.ID, Description: "rule 1 active"}
+
+	for _, r := range []client.Rule{r1, r2} {
+		err = client.SendNodeType(nc, r, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	conds := []client.Condition{
+		{
+			ID:            "ID-cond1",
+			Parent:        r1.ID,
+			Description:   "vin high",
+			ConditionType: data.PointValuePointValue,
+			PointType:     data.PointTypeValue,
+			ValueType:     data.PointValueOnOff,
+			NodeID:        vin.ID,
+			Operator:      data.PointValueEqual,
+			Value:         1,
+		},
+		{
+			ID:            "ID-cond2",
+			Parent:        r2.ID,
+			Description:   "rule 1 active",
+			ConditionType: data.PointValueRuleState,
+			NodeID:        r1.ID,
+			Value:         1,
+		},
+	}
+
+	for _, c := range conds {
+		err = client.SendNodeType(nc, c, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	a := client.Action{
+		ID:          "ID-action",
+		Parent:      r2.ID,
+		Description: "set vout",
+		Action:      data.PointValueSetValue,
+		PointType:   data.PointTypeValue,
+		NodeID:      vout.ID,
+		Value:       1,
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	voutGet, voutStop, err := client.NodeWatcher[client.Variable](nc, vout.ID, vout.Parent)
+	if err != nil {
+		t.Fatal("Error setting up watcher")
+	}
+
+	defer voutStop()
+
+	// wait for rules to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+
+	if err != nil {
+		t.Errorf("Error sending point: %v", err)
+	}
+
+	start := time.Now()
+	for {
+		if voutGet().Value == 1 {
+			// all is well
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Timeout waiting for vout to be set")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+}
+
+// TestRuleWebhook tests a rule that sends the node that triggered it to a
+// webhook.
+func TestRuleWebhook(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	received := make(chan client.WebhookData, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wd client.WebhookData
+		err := json.NewDecoder(r.Body).Decode(&wd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- wd
+	}))
+	defer srv.Close()
+
+	vin := client.Variable{
+		ID:          "ID-varin",
+		Parent:      root.ID,
+		Description: "var in",
+	}
+
+	err = client.SendNodeType(nc, vin, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "test rule",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	c := client.Condition{
+		ID:            "ID-condition",
+		Parent:        r.ID,
+		Description:   "cond vin high",
+		ConditionType: data.PointValuePointValue,
+		PointType:     data.PointTypeValue,
+		ValueType:     data.PointValueOnOff,
+		NodeID:        vin.ID,
+		Operator:      data.PointValueEqual,
+		Value:         1,
+	}
+
+	err = client.SendNodeType(nc, c, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	a := client.Action{
+		ID:          "ID-action-webhook",
+		Parent:      r.ID,
+		Description: "action webhook",
+		Action:      data.PointValueWebhook,
+		URI:         srv.URL,
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// wait for rule to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	select {
+	case wd := <-received:
+		if wd.RuleID != r.ID || wd.Rule != r.Description || !wd.Active {
+			t.Error("Webhook rule data is not correct: ", wd)
+		}
+
+		if wd.NodeID != vin.ID || wd.Description != vin.Description {
+			t.Error("Webhook node data is not correct: ", wd)
+		}
+
+		if wd.Values[data.PointTypeValue] != 1 {
+			t.Error("Webhook values are not correct: ", wd.Values)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for webhook")
+	}
+}
+
+// TestRuleExecDisabled verifies exec actions don't run commands unless they
+// are enabled, and report the error in the action.
+func TestRuleExecDisabled(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	out := t.TempDir() + "/ran"
+
+	vin := client.Variable{
+		ID:          "ID-varin",
+		Parent:      root.ID,
+		Description: "var in",
+	}
+
+	err = client.SendNodeType(nc, vin, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "test rule",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	c := client.Condition{
+		ID:            "ID-condition",
+		Parent:        r.ID,
+		Description:   "cond vin high",
+		ConditionType: data.PointValuePointValue,
+		PointType:     data.PointTypeValue,
+		ValueType:     data.PointValueOnOff,
+		NodeID:        vin.ID,
+		Operator:      data.PointValueEqual,
+		Value:         1,
+	}
+
+	err = client.SendNodeType(nc, c, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	a := client.Action{
+		ID:          "ID-action-exec",
+		Parent:      r.ID,
+		Description: "action exec",
+		Action:      data.PointValueExec,
+		Command:     "touch",
+		Args:        []string{out},
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// wait for rule to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 1, Origin: "test"}, true)
+
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	start := time.Now()
+	for {
+		actions, err := client.GetNodesType[client.Action](nc, r.ID, a.ID)
+		if err != nil {
+			t.Fatal("Error getting action: ", err)
+		}
+		if len(actions) > 0 && strings.Contains(actions[0].Error, "disabled") {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for exec disabled error")
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if _, err := os.Stat(out); err == nil {
+		t.Fatal("Disabled exec action ran the command")
+	}
+}
+
+// TestRuleNotifyTemplate tests a rule that renders a notification message
+// from a template with the node that triggered the rule and its parent.
+func TestRuleNotifyTemplate(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	group := data.NodeEdge{
+		ID:     "ID-group",
+		Type:   data.NodeTypeGroup,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "tank farm"},
+		},
+	}
+
+	err = client.SendNode(nc, group, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	vin := client.Variable{
+		ID:          "ID-varin",
+		Parent:      group.ID,
+		Description: "tank level",
+	}
+
+	err = client.SendNodeType(nc, vin, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	r := client.Rule{
+		ID:          "ID-rule",
+		Parent:      root.ID,
+		Description: "low level",
+	}
+
+	err = client.SendNodeType(nc, r, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	c := client.Condition{
+		ID:            "ID-condition",
+		Parent:        r.ID,
+		Description:   "level low",
+		ConditionType: data.PointValuePointValue,
+		PointType:     data.PointTypeValue,
+		ValueType:     data.PointValueNumber,
+		NodeID:        vin.ID,
+		Operator:      data.PointValueLessThan,
+		Value:         10,
+	}
+
+	err = client.SendNodeType(nc, c, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	a := client.Action{
+		ID:          "ID-action-notify",
+		Parent:      r.ID,
+		Description: "action notify",
+		Action:      data.PointValueNotify,
+		Template:    `{{.Rule}}: {{.Parent}} {{.Description}} is {{index .Values "value"}}`,
+	}
+
+	err = client.SendNodeType(nc, a, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	nots := make(chan data.Notification, 10)
+
+	sub, err := nc.Subscribe(client.SubjectNodeNotification(r.ID), func(msg *nats.Msg) {
+		n, err := data.PbDecodeNotification(msg.Data)
+		if err != nil {
+			t.Error("Error decoding notification: ", err)
+		}
+		nots <- n
+	})
+
+	if err != nil {
+		t.Fatal("Error subscribing to notifications: ", err)
+	}
+
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	// wait for rule to get set up
+	time.Sleep(250 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, vin.ID, data.Point{Type: data.PointTypeValue,
+		Value: 5, Origin: "test"}, true)
+
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	select {
+	case n := <-nots:
+		exp := "low level: tank farm tank level is 5"
+		if n.Message != exp {
+			t.Errorf("Expected message %q, got %q", exp, n.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for notification")
+	}
+}
@@ -6,14 +6,27 @@ import (
 	"regexp"
 	"strconv"
 	"time"
+
+	"github.com/simpleiot/simpleiot/data"
 )
 
 type schedule struct {
+	// startTime and endTime are a time of day (15:04), or a sun event
+	// (sunrise, sunset) with an optional offset in minutes (sunset+30)
 	startTime string
 	endTime   string
 	// A Weekday specifies a day of the week (Sunday = 0, ...).
 	weekdays []time.Weekday
 	dates    []string
+	// location start, end, weekdays, and dates are evaluated in. Defaults
+	// to UTC.
+	location *time.Location
+	// cron expression. If set, the schedule is active during minutes that
+	// match the expression, and start, end, weekdays, and dates are not
+	// used.
+	cron string
+	// position is required for sun events
+	position *data.GpsPos
 }
 
 func newSchedule(start, end string, weekdays []time.Weekday, dates []string) *schedule {
@@ -22,76 +35,294 @@ func newSchedule(start, end string, weekdays []time.Weekday, dates []string) *sc
 		endTime:   end,
 		weekdays:  weekdays,
 		dates:     dates,
+		location:  time.UTC,
+	}
+}
+
+func newCronSchedule(cron string) *schedule {
+	return &schedule{
+		cron:     cron,
+		location: time.UTC,
 	}
 }
 
 func (s *schedule) activeForTime(t time.Time) (bool, error) {
-	tUTC := t.UTC()
+	if s.cron != "" {
+		c, err := parseCron(s.cron)
+		if err != nil {
+			return false, err
+		}
+		return c.match(t.In(s.loc())), nil
+	}
 
-	// parse out hour/minute
-	matches := reHourMin.FindStringSubmatch(s.startTime)
-	if len(matches) < 3 {
-		return false, fmt.Errorf("TimeRange: invalid start: %v ", s.startTime)
+	timeRanges, err := s.timeRanges(t)
+	if err != nil {
+		return false, err
+	}
+
+	return timeRanges.in(t), nil
+}
+
+func (s *schedule) loc() *time.Location {
+	if s.location == nil {
+		return time.UTC
 	}
+	return s.location
+}
+
+// timeRanges returns the time ranges of the schedule that can contain t. These
+// are the range that starts on the date of t, and if the schedule wraps
+// past midnight, the range that starts the day before.
+func (s *schedule) timeRanges(t time.Time) (timeRanges, error) {
+	loc := s.loc()
+	tLocal := t.In(loc)
 
-	startHour, err := strconv.Atoi(matches[1])
+	start, err := parseScheduleTime(s.startTime)
 	if err != nil {
-		return false, fmt.Errorf("TimeRange: error parsing start hour: %v", matches[1])
+		return nil, fmt.Errorf("TimeRange: invalid start: %v ", s.startTime)
 	}
 
-	startMin, err := strconv.Atoi(matches[2])
+	end, err := parseScheduleTime(s.endTime)
 	if err != nil {
-		return false, fmt.Errorf("TimeRange: error parsing start hour: %v", matches[1])
+		return nil, fmt.Errorf("TimeRange: invalid end: %v ", s.endTime)
 	}
 
-	matches = reHourMin.FindStringSubmatch(s.endTime)
-	if len(matches) < 3 {
-		return false, fmt.Errorf("TimeRange: invalid end: %v ", s.endTime)
+	if (start.sunEvent != "" || end.sunEvent != "") && s.position == nil {
+		return nil, fmt.Errorf("TimeRange: location is required for %v/%v",
+			s.startTime, s.endTime)
+	}
+
+	y := tLocal.Year()
+	m := tLocal.Month()
+	d := tLocal.Day()
+
+	var timeRanges timeRanges
+
+	// addRange adds a time range that starts startDay days and ends endDay
+	// days from the date of t. Ranges are skipped on days the sun does not
+	// rise or set.
+	addRange := func(startDay, endDay int) {
+		st, ok := start.on(y, m, d+startDay, loc, s.position)
+		if !ok {
+			return
+		}
+		en, ok := end.on(y, m, d+endDay, loc, s.position)
+		if !ok {
+			return
+		}
+		timeRanges = append(timeRanges, timeRange{st, en})
+	}
+
+	// check if the end time is before the start time. Times of day are
+	// checked on the wall clock as the start and end instants can be
+	// shifted by a DST change.
+	var wrap bool
+	if start.sunEvent == "" && end.sunEvent == "" {
+		wrap = end.minutes() <= start.minutes()
+	} else {
+		st, okStart := start.on(y, m, d, loc, s.position)
+		en, okEnd := end.on(y, m, d, loc, s.position)
+		wrap = okStart && okEnd && !en.After(st)
 	}
 
-	endHour, err := strconv.Atoi(matches[1])
+	if wrap {
+		addRange(0, 1)
+		addRange(-1, 0)
+	} else {
+		addRange(0, 0)
+	}
 
+	timeRanges.filterWeekdays(s.weekdays)
+	err = timeRanges.filterDates(s.dates)
 	if err != nil {
-		return false, fmt.Errorf("TimeRange: error parsing end hour: %v", matches[1])
+		return nil, err
+	}
+
+	return timeRanges, nil
+}
+
+// scheduleTime is a parsed schedule start or end time
+type scheduleTime struct {
+	hour   int
+	minute int
+	// sunEvent is sunrise or sunset, and offset is applied to it
+	sunEvent string
+	offset   time.Duration
+}
+
+var reSunEvent = regexp.MustCompile(`^\s*(sunrise|sunset)\s*(([+-])\s*(\d+))?\s*$`)
+
+func parseScheduleTime(s string) (scheduleTime, error) {
+	if matches := reSunEvent.FindStringSubmatch(s); matches != nil {
+		ret := scheduleTime{sunEvent: matches[1]}
+		if matches[2] != "" {
+			offset, err := strconv.Atoi(matches[4])
+			if err != nil {
+				return ret, err
+			}
+			ret.offset = time.Duration(offset) * time.Minute
+			if matches[3] == "-" {
+				ret.offset = -ret.offset
+			}
+		}
+		return ret, nil
 	}
 
-	endMin, err := strconv.Atoi(matches[2])
+	// parse out hour/minute
+	matches := reHourMin.FindStringSubmatch(s)
+	if len(matches) < 3 {
+		return scheduleTime{}, fmt.Errorf("invalid time: %v", s)
+	}
+
+	hour, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return scheduleTime{}, fmt.Errorf("error parsing hour: %v", matches[1])
+	}
 
+	minute, err := strconv.Atoi(matches[2])
 	if err != nil {
-		return false, fmt.Errorf("TimeRange: error parsing end hour: %v", matches[1])
+		return scheduleTime{}, fmt.Errorf("error parsing minute: %v", matches[2])
 	}
 
-	y := tUTC.Year()
-	m := tUTC.Month()
-	d := tUTC.Day()
+	return scheduleTime{hour: hour, minute: minute}, nil
+}
 
-	start := time.Date(y, m, d, startHour, startMin, 0, 0, time.UTC)
-	end := time.Date(y, m, d, endHour, endMin, 0, 0, time.UTC)
+func (st scheduleTime) minutes() int {
+	return st.hour*60 + st.minute
+}
+
+// on returns the time on a date in loc. ok is false if a sun event does not
+// occur on that date.
+func (st scheduleTime) on(y int, m time.Month, d int, loc *time.Location,
+	pos *data.GpsPos) (time.Time, bool) {
+	switch st.sunEvent {
+	case data.PointValueSunrise, data.PointValueSunset:
+		// normalize the date
+		date := time.Date(y, m, d, 12, 0, 0, 0, loc)
+		sunrise, sunset, ok := sunTimes(date.Year(), date.Month(), date.Day(),
+			pos.Lat, pos.Long)
+		if !ok {
+			return time.Time{}, false
+		}
+		t := sunrise
+		if st.sunEvent == data.PointValueSunset {
+			t = sunset
+		}
+		return t.Add(st.offset).In(loc), true
+	default:
+		return localTime(y, m, d, st.hour, st.minute, loc), true
+	}
+}
 
-	timeRanges := timeRanges{
-		{start, end},
+// localTime returns the time for a wall clock time in loc. Times that are
+// skipped by a DST change (gap) return the instant the clock jumps forward,
+// so a schedule starting or ending in the gap does so at the end of the gap.
+// Times that occur twice when the clock is set back (overlap) return the
+// first occurrence.
+func localTime(y int, m time.Month, d, hour, minute int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, hour, minute, 0, 0, loc)
+
+	// normalize the date (d may be out of range) so the wall clock of the
+	// result can be checked
+	date := time.Date(y, m, d, 12, 0, 0, 0, loc)
+	wantY, wantM, wantD := date.Date()
+
+	tY, tM, tD := t.Date()
+	tWall := time.Date(tY, tM, tD, t.Hour(), t.Minute(), 0, 0, time.UTC)
+	want := time.Date(wantY, wantM, wantD, hour, minute, 0, 0, time.UTC)
+
+	if !tWall.Equal(want) {
+		// wall clock time does not exist, so return the transition
+		// at the end of the gap
+		zoneStart, zoneEnd := t.ZoneBounds()
+		if tWall.After(want) {
+			return zoneStart
+		}
+		return zoneEnd
 	}
 
-	// adjust time ranges if end time is before start
-	if !end.After(start) {
-		timeRanges[0].end = timeRanges[0].end.AddDate(0, 0, 1)
+	// check if the wall clock time also occurred in the previous zone
+	zoneStart, _ := t.ZoneBounds()
+	if zoneStart.IsZero() {
+		return t
+	}
 
-		timeRanges = append(timeRanges,
-			timeRange{start.AddDate(0, 0, -1), end},
-		)
+	_, offset := t.Zone()
+	_, prevOffset := zoneStart.Add(-time.Second).Zone()
+	if prevOffset > offset {
+		earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+		if earlier.Before(zoneStart) {
+			return earlier
+		}
 	}
 
-	timeRanges.filterWeekdays(s.weekdays)
-	err = timeRanges.filterDates(s.dates)
+	return t
+}
+
+// activeUntil returns the time the schedule stops being active if it is
+// active at t. The end of the time range that contains t is used, and if
+// another range starts at that time, the ranges are joined for up to a week.
+func (s *schedule) activeUntil(t time.Time) (time.Time, bool, error) {
+	if s.cron != "" {
+		return s.cronActiveUntil(t)
+	}
+
+	limit := t.Add(7 * 24 * time.Hour)
+	end := t
+	active := false
+
+	for end.Before(limit) {
+		timeRanges, err := s.timeRanges(end)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		next := end
+		for _, tr := range timeRanges {
+			if tr.in(end) && tr.end.After(next) {
+				next = tr.end
+			}
+		}
+
+		if next.Equal(end) {
+			break
+		}
+
+		end = next
+		active = true
+	}
+
+	if !active {
+		return time.Time{}, false, nil
+	}
+
+	return end, true, nil
+}
+
+// cronActiveUntil returns the first minute after t that does not match the
+// cron expression if t matches it. Cron schedules have minute resolution, so
+// this steps forward a minute at a time for up to a week.
+func (s *schedule) cronActiveUntil(t time.Time) (time.Time, bool, error) {
+	c, err := parseCron(s.cron)
 	if err != nil {
-		return false, err
+		return time.Time{}, false, err
 	}
 
-	if timeRanges.in(t) {
-		return true, nil
+	loc := s.loc()
+	if !c.match(t.In(loc)) {
+		return time.Time{}, false, nil
+	}
+
+	end := t.Truncate(time.Minute)
+	for i := 0; i < 7*24*60; i++ {
+		end = end.Add(time.Minute)
+		if !c.match(end.In(loc)) {
+			return end, true, nil
+		}
 	}
 
-	return false, nil
+	// active all week, so check again later
+	return end, true, nil
 }
 
 var reHourMin = regexp.MustCompile(`(\d{1,2}):(\d\d)`)
@@ -162,15 +393,16 @@ func (trs *timeRanges) filterDates(dates []string) error {
 				return fmt.Errorf("Invalid day: %v", d)
 			}
 
-			if year != tr.start.UTC().Year() {
+			// start is in the schedule location
+			if year != tr.start.Year() {
 				continue
 			}
 
-			if month != int(tr.start.UTC().Month()) {
+			if month != int(tr.start.Month()) {
 				continue
 			}
 
-			if day != tr.start.UTC().Day() {
+			if day != tr.start.Day() {
 				continue
 			}
 
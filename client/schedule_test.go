@@ -3,6 +3,8 @@ package client
 import (
 	"testing"
 	"time"
+
+	"github.com/simpleiot/simpleiot/data"
 )
 
 type testTime struct {
@@ -106,3 +108,221 @@ func TestScheduleWrapDates(t *testing.T) {
 
 	tests.run(t, sched)
 }
+
+func TestScheduleActiveUntil(t *testing.T) {
+	sched := newSchedule("22:00", "6:30", []time.Weekday{}, nil)
+
+	end, active, err := sched.activeUntil(time.Date(2021, time.August, 9, 3, 10, 20, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !active {
+		t.Fatal("schedule should be active")
+	}
+
+	exp := time.Date(2021, time.August, 9, 6, 30, 0, 0, time.UTC)
+	if !end.Equal(exp) {
+		t.Errorf("expected end %v, got %v", exp, end)
+	}
+
+	_, active, err = sched.activeUntil(time.Date(2021, time.August, 9, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if active {
+		t.Error("schedule should not be active")
+	}
+
+	// all day on weekends, so Saturday and Sunday are joined
+	sched = newSchedule("0:00", "0:00", []time.Weekday{time.Saturday, time.Sunday}, nil)
+
+	end, active, err = sched.activeUntil(time.Date(2021, time.August, 14, 3, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp = time.Date(2021, time.August, 16, 0, 0, 0, 0, time.UTC)
+	if !active || !end.Equal(exp) {
+		t.Errorf("expected weekend end %v, got %v, %v", exp, end, active)
+	}
+}
+
+func TestScheduleTimezone(t *testing.T) {
+	sched := newSchedule("20:00", "23:00", []time.Weekday{1}, nil)
+
+	var err error
+	sched.location, err = loadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2021-08-09 is a Monday. Local time is UTC-4 in August.
+	tests := testTable{
+		{time.Date(2021, time.August, 9, 23, 59, 0, 0, time.UTC), false},
+		{time.Date(2021, time.August, 10, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, time.August, 10, 2, 59, 0, 0, time.UTC), true},
+		{time.Date(2021, time.August, 10, 3, 0, 0, 0, time.UTC), false},
+		// Tuesday local time
+		{time.Date(2021, time.August, 11, 1, 0, 0, 0, time.UTC), false},
+		// local time is UTC-5 in February, 2021-02-08 is a Monday
+		{time.Date(2021, time.February, 9, 0, 30, 0, 0, time.UTC), false},
+		{time.Date(2021, time.February, 9, 1, 0, 0, 0, time.UTC), true},
+	}
+
+	tests.run(t, sched)
+
+	sched = newSchedule("20:00", "23:00", nil, []string{"2021-08-09"})
+	sched.location, _ = loadLocation("America/New_York")
+
+	tests = testTable{
+		{time.Date(2021, time.August, 10, 1, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, time.August, 9, 1, 0, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+}
+
+func TestScheduleTimezoneInvalid(t *testing.T) {
+	_, err := loadLocation("America/Nowhere")
+	if err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestScheduleDSTGap(t *testing.T) {
+	// clocks go from 2:00 EST to 3:00 EDT on 2021-03-14, so a schedule
+	// starting at 2:30 starts at 3:00 EDT (7:00 UTC)
+	sched := newSchedule("2:30", "3:30", nil, nil)
+	sched.location, _ = loadLocation("America/New_York")
+
+	tests := testTable{
+		{time.Date(2021, time.March, 14, 6, 59, 0, 0, time.UTC), false},
+		{time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, time.March, 14, 7, 29, 0, 0, time.UTC), true},
+		{time.Date(2021, time.March, 14, 7, 30, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+
+	// overnight schedules end at the correct local time after the change
+	sched = newSchedule("22:00", "6:00", nil, nil)
+	sched.location, _ = loadLocation("America/New_York")
+
+	tests = testTable{
+		// 22:00 EST
+		{time.Date(2021, time.March, 14, 3, 0, 0, 0, time.UTC), true},
+		// 5:59 EDT
+		{time.Date(2021, time.March, 14, 9, 59, 0, 0, time.UTC), true},
+		// 6:00 EDT
+		{time.Date(2021, time.March, 14, 10, 0, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+}
+
+func TestScheduleDSTOverlap(t *testing.T) {
+	// clocks go from 2:00 EDT back to 1:00 EST on 2021-11-07, so 1:30
+	// occurs twice. Only the first occurrence is used.
+	sched := newSchedule("1:30", "1:45", nil, nil)
+	sched.location, _ = loadLocation("America/New_York")
+
+	tests := testTable{
+		// 1:35 EDT
+		{time.Date(2021, time.November, 7, 5, 35, 0, 0, time.UTC), true},
+		// 1:35 EST
+		{time.Date(2021, time.November, 7, 6, 35, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+
+	// the extra hour is included in schedules that span the change
+	sched = newSchedule("0:30", "2:30", nil, nil)
+	sched.location, _ = loadLocation("America/New_York")
+
+	tests = testTable{
+		// 0:30 EDT
+		{time.Date(2021, time.November, 7, 4, 30, 0, 0, time.UTC), true},
+		// 2:29 EST
+		{time.Date(2021, time.November, 7, 7, 29, 0, 0, time.UTC), true},
+		// 2:30 EST
+		{time.Date(2021, time.November, 7, 7, 30, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+}
+
+func TestScheduleCron(t *testing.T) {
+	sched := newCronSchedule("*/15 * * * mon-fri")
+	sched.location, _ = loadLocation("America/New_York")
+
+	// 2021-08-09 is a Monday
+	tests := testTable{
+		{time.Date(2021, time.August, 9, 14, 15, 30, 0, time.UTC), true},
+		{time.Date(2021, time.August, 9, 14, 16, 0, 0, time.UTC), false},
+		// 21:00 Sunday local time
+		{time.Date(2021, time.August, 9, 1, 0, 0, 0, time.UTC), false},
+	}
+
+	tests.run(t, sched)
+
+	sched = newCronSchedule("* * *")
+	_, err := sched.activeForTime(time.Now())
+	if err == nil {
+		t.Error("expected error for invalid cron expression")
+	}
+}
+
+func TestScheduleSun(t *testing.T) {
+	// New York sunrise is 5:25 and sunset is 20:31 EDT on 2021-06-21
+	ny, _ := loadLocation("America/New_York")
+	pos := &data.GpsPos{Lat: 40.7128, Long: -74.0060}
+
+	sched := newSchedule("sunset", "sunrise", nil, nil)
+	sched.location = ny
+	sched.position = pos
+
+	tests := testTable{
+		{time.Date(2021, time.June, 21, 20, 25, 0, 0, ny), false},
+		{time.Date(2021, time.June, 21, 20, 35, 0, 0, ny), true},
+		{time.Date(2021, time.June, 22, 3, 0, 0, 0, ny), true},
+		{time.Date(2021, time.June, 22, 5, 30, 0, 0, ny), false},
+		{time.Date(2021, time.June, 22, 12, 0, 0, 0, ny), false},
+	}
+
+	tests.run(t, sched)
+
+	// offsets, and mixing sun events and times of day
+	sched = newSchedule("sunrise-60", "6:00", []time.Weekday{1}, nil)
+	sched.location = ny
+	sched.position = pos
+
+	// 2021-06-21 is a Monday
+	tests = testTable{
+		{time.Date(2021, time.June, 21, 4, 20, 0, 0, ny), false},
+		{time.Date(2021, time.June, 21, 4, 30, 0, 0, ny), true},
+		{time.Date(2021, time.June, 21, 6, 0, 0, 0, ny), false},
+		{time.Date(2021, time.June, 22, 4, 30, 0, 0, ny), false},
+	}
+
+	tests.run(t, sched)
+
+	sched = newSchedule("sunset+30", "23:00", nil, nil)
+	sched.location = ny
+	sched.position = pos
+
+	tests = testTable{
+		{time.Date(2021, time.June, 21, 20, 55, 0, 0, ny), false},
+		{time.Date(2021, time.June, 21, 21, 5, 0, 0, ny), true},
+	}
+
+	tests.run(t, sched)
+
+	// a location is required for sun events
+	sched = newSchedule("sunset", "sunrise", nil, nil)
+	_, err := sched.activeForTime(time.Now())
+	if err == nil {
+		t.Error("expected error for missing location")
+	}
+}
@@ -1,6 +1,9 @@
 package client
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // create subject strings for various types of messages
 
@@ -68,3 +71,54 @@ func (sd Destination) Subject(originID string, parentID string) string {
 	}
 	return SubjectNodePoints(destID)
 }
+
+// SubjectNodeNotification constructs a NATS subject for notifications sent
+// by a node
+func SubjectNodeNotification(nodeID string) string {
+	return fmt.Sprintf("node.%v.not", nodeID)
+}
+
+// SubjectNodeEscalation constructs a NATS subject for notifications
+// escalated to a user or group node. Unlike node notifications, only the
+// user, or the users directly in the group, are notified.
+func SubjectNodeEscalation(nodeID string) string {
+	return fmt.Sprintf("node.%v.esc", nodeID)
+}
+
+// SubjectNotificationAck constructs a NATS subject used to acknowledge a
+// notification sent by a rule
+func SubjectNotificationAck(notificationID string) string {
+	return fmt.Sprintf("node.%v.ack", notificationID)
+}
+
+// SubjectNodeMessage constructs a NATS subject for messages sent to a user
+func SubjectNodeMessage(userID string) string {
+	return fmt.Sprintf("node.%v.msg", userID)
+}
+
+// SubjectHistory constructs a NATS subject for history queries. nodeID is a
+// database node, or the instance root node for history kept in the store.
+func SubjectHistory(nodeID string) string {
+	return fmt.Sprintf("history.%v", nodeID)
+}
+
+// SubjectRuleHistory constructs a NATS subject used to request the history
+// of a rule
+func SubjectRuleHistory(ruleID string) string {
+	return fmt.Sprintf("history.rule.%v", ruleID)
+}
+
+// SubjectMsgService constructs a NATS subject used to deliver messages to
+// a message service node
+func SubjectMsgService(nodeID string) string {
+	return fmt.Sprintf("msgService.%v", nodeID)
+}
+
+// subjectNodeID extracts the node ID from node.<id>.* subjects
+func subjectNodeID(subject string) (string, error) {
+	chunks := strings.Split(subject, ".")
+	if len(chunks) < 3 || chunks[0] != "node" {
+		return "", fmt.Errorf("invalid node subject: %v", subject)
+	}
+	return chunks[1], nil
+}
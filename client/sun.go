@@ -0,0 +1,68 @@
+package client
+
+import (
+	"math"
+	"time"
+)
+
+// sunTimes returns sunrise and sunset for a date at a latitude and
+// longitude (degrees, north and east are positive). The date is the solar
+// day at the longitude, so for most locations sunrise and sunset fall on
+// the same local date. ok is false if the sun does not rise or set on
+// that day (polar day/night).
+//
+// This uses the sunrise equation from
+// https://en.wikipedia.org/wiki/Sunrise_equation, which is accurate to
+// about a minute.
+func sunTimes(y int, m time.Month, d int, lat, long float64) (sunrise, sunset time.Time, ok bool) {
+	const j2000 = 2451545.0
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	deg := func(rad float64) float64 { return rad * 180 / math.Pi }
+
+	// julian day number of noon UTC on the date
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	n := math.Ceil(julianDate(midnight) - j2000 + 0.0008)
+
+	// mean solar time
+	jStar := n - long/360
+
+	// solar mean anomaly
+	mean := math.Mod(357.5291+0.98560028*jStar, 360)
+
+	// equation of the center
+	c := 1.9148*math.Sin(rad(mean)) + 0.02*math.Sin(rad(2*mean)) +
+		0.0003*math.Sin(rad(3*mean))
+
+	// ecliptic longitude
+	lambda := math.Mod(mean+c+180+102.9372, 360)
+
+	transit := j2000 + jStar + 0.0053*math.Sin(rad(mean)) -
+		0.0069*math.Sin(rad(2*lambda))
+
+	// declination of the sun
+	sinDecl := math.Sin(rad(lambda)) * math.Sin(rad(23.4397))
+	cosDecl := math.Cos(math.Asin(sinDecl))
+
+	// hour angle, -0.833 degrees accounts for refraction and the size of
+	// the sun's disc
+	cosHA := (math.Sin(rad(-0.833)) - math.Sin(rad(lat))*sinDecl) /
+		(math.Cos(rad(lat)) * cosDecl)
+
+	if cosHA < -1 || cosHA > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	ha := deg(math.Acos(cosHA))
+
+	return fromJulianDate(transit - ha/360), fromJulianDate(transit + ha/360), true
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 2440587.5
+}
+
+func fromJulianDate(j float64) time.Time {
+	sec := (j - 2440587.5) * 86400
+	return time.Unix(0, int64(sec*1e9)).UTC().Round(time.Second)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, long float64
+		date      time.Time
+		sunrise   time.Time
+		sunset    time.Time
+	}{
+		{
+			// 5:25 and 20:31 EDT
+			"New York", 40.7128, -74.0060,
+			time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC),
+			time.Date(2021, time.June, 21, 9, 25, 0, 0, time.UTC),
+			time.Date(2021, time.June, 22, 0, 31, 0, 0, time.UTC),
+		},
+		{
+			"London", 51.5072, -0.1276,
+			time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC),
+			time.Date(2021, time.December, 21, 8, 4, 0, 0, time.UTC),
+			time.Date(2021, time.December, 21, 15, 53, 0, 0, time.UTC),
+		},
+		{
+			// 7:00 and 16:57 AEST
+			"Sydney", -33.8688, 151.2093,
+			time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2021, time.June, 30, 21, 0, 0, 0, time.UTC),
+			time.Date(2021, time.July, 1, 6, 57, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		y, m, d := test.date.Date()
+		sunrise, sunset, ok := sunTimes(y, m, d, test.lat, test.long)
+		if !ok {
+			t.Errorf("%v: sun should rise and set", test.name)
+			continue
+		}
+
+		if diff := sunrise.Sub(test.sunrise); diff < -2*time.Minute || diff > 2*time.Minute {
+			t.Errorf("%v: expected sunrise %v, got %v", test.name, test.sunrise, sunrise)
+		}
+
+		if diff := sunset.Sub(test.sunset); diff < -2*time.Minute || diff > 2*time.Minute {
+			t.Errorf("%v: expected sunset %v, got %v", test.name, test.sunset, sunset)
+		}
+	}
+}
+
+func TestSunTimesPolar(t *testing.T) {
+	// Tromsø does not have a sunrise in December
+	_, _, ok := sunTimes(2021, time.December, 21, 69.6492, 18.9553)
+	if ok {
+		t.Error("sun should not rise")
+	}
+}
@@ -21,6 +21,7 @@ type Sync struct {
 	Disabled       bool   `point:"disabled"`
 	SyncCount      int    `point:"syncCount"`
 	SyncCountReset bool   `point:"syncCountReset"`
+	ExcludeSecrets bool   `point:"excludeSecrets"`
 }
 
 type newEdge struct {
@@ -207,14 +208,16 @@ done:
 				up.rootRemote = data.NodeEdge{}
 			}
 		case pts := <-chLocalNodePoints:
-			if connected {
+			pts.Points = syncPoints(pts.Points, up.config.ExcludeSecrets)
+			if connected && len(pts.Points) > 0 {
 				err = SendNodePoints(up.ncRemote, pts.ID, pts.Points, false)
 				if err != nil {
 					log.Println("Error sending node points to remote system:", err)
 				}
 			}
 		case pts := <-chLocalEdgePoints:
-			if connected {
+			pts.Points = syncPoints(pts.Points, up.config.ExcludeSecrets)
+			if connected && len(pts.Points) > 0 {
 				err = SendEdgePoints(up.ncRemote, pts.ID, pts.Parent, pts.Points, false)
 				if err != nil {
 					log.Println("Error sending edge points to remote system:", err)
@@ -230,7 +233,8 @@ done:
 				switch p.Type {
 				case data.PointTypeURI,
 					data.PointTypeAuthToken,
-					data.PointTypeDisabled:
+					data.PointTypeDisabled,
+					data.PointTypeExcludeSecrets:
 					// we need to restart the sync connection
 					up.disconnect()
 					connectTimer.Reset(10 * time.Millisecond)
@@ -387,6 +391,9 @@ func (up *SyncClient) connect() error {
 func (up *SyncClient) subscribeRemoteNodePoints(id string) error {
 	if _, ok := up.subRemoteNodePoints[id]; !ok {
 		var err error
+		// changing this config restarts the connection, so it is safe to
+		// capture it here
+		excludeSecrets := up.config.ExcludeSecrets
 		up.subRemoteNodePoints[id], err = up.ncRemote.Subscribe(SubjectNodePoints(id), func(msg *nats.Msg) {
 			nodeID, points, err := DecodeNodePointsMsg(msg)
 			if err != nil {
@@ -394,6 +401,11 @@ func (up *SyncClient) subscribeRemoteNodePoints(id string) error {
 				return
 			}
 
+			points = syncPoints(points, excludeSecrets)
+			if len(points) < 1 {
+				return
+			}
+
 			err = SendNodePoints(up.ncLocal, nodeID, points, false)
 			if err != nil {
 				log.Println("Error sending node points to remote system:", err)
@@ -412,6 +424,7 @@ func (up *SyncClient) subscribeRemoteEdgePoints(parent, id string) error {
 	if _, ok := up.subRemoteEdgePoints[id]; !ok {
 		var err error
 		key := id + ":" + parent
+		excludeSecrets := up.config.ExcludeSecrets
 		up.subRemoteEdgePoints[key], err = up.ncRemote.Subscribe(SubjectEdgePoints(id, parent),
 			func(msg *nats.Msg) {
 				nodeID, parentID, points, err := DecodeEdgePointsMsg(msg)
@@ -420,6 +433,11 @@ func (up *SyncClient) subscribeRemoteEdgePoints(parent, id string) error {
 					return
 				}
 
+				points = syncPoints(points, excludeSecrets)
+				if len(points) < 1 {
+					return
+				}
+
 				err = SendEdgePoints(up.ncLocal, nodeID, parentID, points, false)
 				if err != nil {
 					log.Println("Error sending edge points to remote system:", err)
@@ -493,6 +511,39 @@ func (up *SyncClient) disconnect() {
 	}
 }
 
+// syncPoints returns the points that are synced. Secret points are removed
+// if they are excluded from sync.
+func syncPoints(points data.Points, excludeSecrets bool) data.Points {
+	if !excludeSecrets {
+		return points
+	}
+
+	return points.RemoveSecrets()
+}
+
+// samePoints returns true if a and b hold the same points
+func samePoints(a, b data.Points) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, p := range a {
+		found := false
+		for _, pB := range b {
+			if p.IsMatch(pB.Type, pB.Key) {
+				found = p.CRC() == pB.CRC()
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
 // sendNodesRemote is used to send node and children over nats
 // from one NATS server to another. Typically from the current instance
 // to an upstream.
@@ -501,6 +552,9 @@ func (up *SyncClient) sendNodesRemote(node data.NodeEdge) error {
 		node.Parent = up.rootRemote.ID
 	}
 
+	node.Points = syncPoints(node.Points, up.config.ExcludeSecrets)
+	node.EdgePoints = syncPoints(node.EdgePoints, up.config.ExcludeSecrets)
+
 	err := SendNode(up.ncRemote, node, up.config.ID)
 	if err != nil {
 		return err
@@ -527,6 +581,9 @@ func (up *SyncClient) sendNodesRemote(node data.NodeEdge) error {
 // from one NATS server to another. Typically from the current instance
 // to an upstream.
 func (up *SyncClient) sendNodesLocal(node data.NodeEdge) error {
+	node.Points = syncPoints(node.Points, up.config.ExcludeSecrets)
+	node.EdgePoints = syncPoints(node.EdgePoints, up.config.ExcludeSecrets)
+
 	err := SendNode(up.ncLocal, node, up.config.ID)
 	if err != nil {
 		return err
@@ -653,6 +710,16 @@ func (up *SyncClient) syncNode(parent, id string) error {
 
 	nodeUp = nodeUps[0]
 
+	if up.config.ExcludeSecrets {
+		// secret points are not synced, so back them (and the secret
+		// points of all nodes below) out of the hash
+		for _, n := range []*data.NodeEdge{&nodeUp, &nodeLocal} {
+			n.Hash ^= n.SecretHash
+			n.Points = n.Points.RemoveSecrets()
+			n.EdgePoints = n.EdgePoints.RemoveSecrets()
+		}
+	}
+
 	if nodeLocal.ID == up.rootLocal.ID {
 		// we need to back out the edge points from the hash as don't want to sync those
 		for _, p := range nodeUp.EdgePoints {
@@ -669,6 +736,15 @@ func (up *SyncClient) syncNode(parent, id string) error {
 		return nil
 	}
 
+	// upstreams older than the secret hash send 0, and their hash still
+	// includes secret points, so the node points are compared one by one
+	if up.config.ExcludeSecrets && nodeUp.SecretHash == 0 &&
+		samePoints(nodeLocal.Points, nodeUp.Points) &&
+		(nodeLocal.ID == up.rootLocal.ID ||
+			samePoints(nodeLocal.EdgePoints, nodeUp.EdgePoints)) {
+		return up.syncChildren(nodeLocal, nodeUp)
+	}
+
 	// only increment count once during sync
 	if nodeLocal.ID == up.rootLocal.ID {
 		up.config.SyncCount++
@@ -778,7 +854,11 @@ func (up *SyncClient) syncNode(parent, id string) error {
 		}
 	}
 
-	// sync child nodes
+	return up.syncChildren(nodeLocal, nodeUp)
+}
+
+// syncChildren syncs the child nodes of a node that is synced
+func (up *SyncClient) syncChildren(nodeLocal, nodeUp data.NodeEdge) error {
 	children, err := GetNodes(up.ncLocal, nodeLocal.ID, "all", "", false)
 	if err != nil {
 		return fmt.Errorf("Error getting local node children: %v", err)
@@ -799,7 +879,12 @@ func (up *SyncClient) syncNode(parent, id string) error {
 			if child.ID == upChild.ID {
 				found = true
 				upChildProcessed[i] = true
-				if child.Hash != upChild.Hash {
+				hash, upHash := child.Hash, upChild.Hash
+				if up.config.ExcludeSecrets {
+					hash ^= child.SecretHash
+					upHash ^= upChild.SecretHash
+				}
+				if hash != upHash {
 					err := up.syncNode(nodeLocal.ID, child.ID)
 					if err != nil {
 						fmt.Println("Error syncing node: ", err)
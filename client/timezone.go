@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	// embed the timezone database as many embedded systems do not have
+	// one installed
+	_ "time/tzdata"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// loadLocation returns the location for an IANA timezone name. A blank
+// name is UTC.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %v: %w", name, err)
+	}
+
+	return loc, nil
+}
+
+// findTimezone returns the timezone point of a node, or the timezone of the
+// closest ancestor that has one. Blank is returned if no timezone is found.
+func findTimezone(nc *nats.Conn, id string) (string, error) {
+	tz := ""
+
+	check := func(id string) (bool, error) {
+		nodes, err := GetNodes(nc, "all", id, "", false)
+		if err != nil {
+			return false, err
+		}
+
+		for _, n := range nodes {
+			p, ok := n.Points.Find(data.PointTypeTimezone, "")
+			if ok && p.Tombstone == 0 && p.Text != "" {
+				tz = p.Text
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	found, err := check(id)
+	if err != nil || found {
+		return tz, err
+	}
+
+	err = walkUp(nc, id, check)
+
+	return tz, err
+}
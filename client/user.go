@@ -1,5 +1,11 @@
 package client
 
+import (
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
 // User represents a user node
 type User struct {
 	ID        string `node:"id"`
@@ -9,4 +15,104 @@ type User struct {
 	Phone     string `point:"phone"`
 	Email     string `point:"email"`
 	Pass      string `point:"pass"`
+	// notification preferences
+	// PreferredChannel: sms, email, webhook. Blank sends to all channels
+	// the user has contact information for.
+	PreferredChannel string `point:"preferredChannel"`
+	// MinSeverity: info, warning, critical
+	MinSeverity string `point:"minSeverity"`
+	// QuietAction: defer (default), skip
+	QuietAction string `point:"quietAction"`
+	// Timezone quiet hours are evaluated in. If blank, the timezone is
+	// inherited from the closest ancestor with a timezone point, or UTC.
+	Timezone   string       `point:"timezone"`
+	QuietHours []QuietHours `child:"quietHours"`
+}
+
+// QuietHours is a schedule during which non-critical notifications are
+// not delivered to a user.
+type QuietHours struct {
+	ID          string   `node:"id"`
+	Parent      string   `node:"parent"`
+	Description string   `point:"description"`
+	Disabled    bool     `point:"disabled"`
+	Start       string   `point:"start"`
+	End         string   `point:"end"`
+	Weekdays    []bool   `point:"weekday"`
+	Dates       []string `point:"date"`
+	// Timezone overrides the user timezone
+	Timezone string `point:"timezone"`
+}
+
+func (q QuietHours) schedule(tz string) (*schedule, error) {
+	weekdays := []time.Weekday{}
+	for i, v := range q.Weekdays {
+		if v {
+			weekdays = append(weekdays, time.Weekday(i))
+		}
+	}
+
+	if q.Timezone != "" {
+		tz = q.Timezone
+	}
+
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	sched := newSchedule(q.Start, q.End, weekdays, q.Dates)
+	sched.location = loc
+
+	return sched, nil
+}
+
+// quietUntil returns the end of quiet hours if t is in the user's quiet
+// hours. If quiet hours overlap, the latest end is returned.
+func (u User) quietUntil(t time.Time) (end time.Time, quiet bool, err error) {
+	for _, q := range u.QuietHours {
+		if q.Disabled {
+			continue
+		}
+
+		sched, err := q.schedule(u.Timezone)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		qEnd, active, err := sched.activeUntil(t)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		if active && qEnd.After(end) {
+			end = qEnd
+			quiet = true
+		}
+	}
+
+	return end, quiet, nil
+}
+
+// contactMessage returns a copy of the message with contact information
+// limited to the user's preferred channel. If the user does not have
+// contact information for the preferred channel, all channels are used.
+func (u User) contactMessage(m data.Message) data.Message {
+	switch u.PreferredChannel {
+	case data.PointValueSMS:
+		if m.Phone != "" {
+			m.Email = ""
+		}
+	case data.PointValueEmail:
+		if m.Email != "" {
+			m.Phone = ""
+		}
+	case data.PointValueWebhook:
+		// webhook message services accept messages without contact
+		// information, while SMS and email services do not
+		m.Email = ""
+		m.Phone = ""
+	}
+
+	return m
 }
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestUserQuietUntil(t *testing.T) {
+	u := User{
+		QuietHours: []QuietHours{
+			{Start: "22:00", End: "6:00"},
+			// weekends, Saturday is 6
+			{Start: "0:00", End: "12:00", Weekdays: []bool{false, false, false, false, false, false, true}},
+			{Start: "0:00", End: "23:00", Disabled: true},
+		},
+	}
+
+	// 2021-08-09 is a Monday
+	end, quiet, err := u.quietUntil(time.Date(2021, time.August, 9, 3, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !quiet || !end.Equal(time.Date(2021, time.August, 9, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("Monday quiet hours not correct: %v, %v", quiet, end)
+	}
+
+	// on Saturday the overlapping window ends later
+	end, quiet, err = u.quietUntil(time.Date(2021, time.August, 14, 3, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !quiet || !end.Equal(time.Date(2021, time.August, 14, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Saturday quiet hours not correct: %v, %v", quiet, end)
+	}
+
+	_, quiet, err = u.quietUntil(time.Date(2021, time.August, 9, 14, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quiet {
+		t.Error("should not be quiet in the afternoon")
+	}
+}
+
+func TestUserContactMessage(t *testing.T) {
+	m := data.Message{Email: "joe@example.com", Phone: "+15555555555"}
+
+	u := User{PreferredChannel: data.PointValueEmail}
+	if c := u.contactMessage(m); c.Phone != "" || c.Email == "" {
+		t.Error("email preference not correct: ", c)
+	}
+
+	u = User{PreferredChannel: data.PointValueSMS}
+	if c := u.contactMessage(m); c.Email != "" || c.Phone == "" {
+		t.Error("sms preference not correct: ", c)
+	}
+
+	// fall back to all channels if the user has no phone number
+	u = User{PreferredChannel: data.PointValueSMS}
+	if c := u.contactMessage(data.Message{Email: m.Email}); c.Email == "" {
+		t.Error("sms preference fallback not correct: ", c)
+	}
+
+	u = User{}
+	if c := u.contactMessage(m); c != m {
+		t.Error("no preference should not change message: ", c)
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/msg"
+)
+
+// webhook requests are retried a few times, but all attempts must complete
+// before a message service request (see SendMessage) times out.
+const (
+	webhookTimeout    = 4 * time.Second
+	webhookRetries    = 2
+	webhookMaxBackoff = 2 * time.Second
+)
+
+// WebhookData is sent by webhook message services and rule actions. It is
+// encoded as JSON, or used as the data for the body template.
+type WebhookData struct {
+	// the following are set by rule actions
+	RuleID string `json:"ruleID,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+	Active bool   `json:"active"`
+	// the node that triggered the rule
+	NodeID      string `json:"nodeID"`
+	Description string `json:"description"`
+	// point values of the node, indexed by point type, or type.key for
+	// points with a key
+	Values map[string]float64 `json:"values,omitempty"`
+	Text   map[string]string  `json:"text,omitempty"`
+	// the following are set by message services
+	UserID  string    `json:"userID,omitempty"`
+	Subject string    `json:"subject,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	Phone   string    `json:"phone,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// newWebhookData populates webhook data from a node
+func newWebhookData(node data.NodeEdge) WebhookData {
+	ret := WebhookData{
+		NodeID:      node.ID,
+		Description: node.Desc(),
+		Time:        time.Now(),
+	}
+
+	ret.Values, ret.Text = pointMaps(node.Points)
+
+	return ret
+}
+
+// sendWebhook sends data to a webhook and retries temporary errors with
+// exponential backoff.
+func sendWebhook(url string, headers map[string]string, bodyTemplate string,
+	wd WebhookData) error {
+	wh, err := msg.NewWebhook(url, headers, bodyTemplate, webhookTimeout)
+	if err != nil {
+		return err
+	}
+
+	// template errors are not going to be fixed by retrying
+	_, err = wh.Body(wd)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = wh.Send(wd)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *msg.WebhookStatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			return err
+		}
+
+		if attempt >= webhookRetries {
+			return err
+		}
+
+		time.Sleep(ExpBackoff(attempt, webhookMaxBackoff))
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSendWebhookRetry(t *testing.T) {
+	var count int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	err := sendWebhook(srv.URL, nil, "", WebhookData{NodeID: "abc"})
+	if err != nil {
+		t.Fatal("Error sending webhook: ", err)
+	}
+
+	if count != 2 {
+		t.Error("expected 2 requests, got: ", count)
+	}
+}
+
+func TestSendWebhookNoRetry(t *testing.T) {
+	var count int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := sendWebhook(srv.URL, nil, "", WebhookData{NodeID: "abc"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if count != 1 {
+		t.Error("client errors should not be retried, requests: ", count)
+	}
+}
+
+func TestMsgServiceWebhook(t *testing.T) {
+	received := make(chan WebhookData, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wd WebhookData
+		err := json.NewDecoder(r.Body).Decode(&wd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- wd
+	}))
+	defer srv.Close()
+
+	d, err := (&data.Message{UserID: "user1", Subject: "alarm",
+		Message: "tank low"}).ToPb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := MsgService{Service: data.PointValueWebhook, URI: srv.URL}
+
+	err = ms.send(&nats.Msg{Data: d})
+	if err != nil {
+		t.Fatal("Error sending message: ", err)
+	}
+
+	wd := <-received
+	if wd.UserID != "user1" || wd.NodeID != "" || wd.Message != "tank low" {
+		t.Error("Webhook data is not correct: ", wd)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/install"
 	"github.com/simpleiot/simpleiot/server"
+	"github.com/simpleiot/simpleiot/store"
 )
 
 // goreleaser will replace version with Git version. You can also pass version
@@ -47,6 +48,7 @@ func main() {
 		fmt.Println("  - install (install SIOT and register service)")
 		fmt.Println("  - import (import nodes from YAML file)")
 		fmt.Println("  - export (export nodes to YAML file)")
+		fmt.Println("  - rule (test rules with recorded or synthetic points)")
 	}
 
 	_ = flags.Parse(os.Args[1:])
@@ -81,6 +83,8 @@ func main() {
 		runImport(args[1:])
 	case "export":
 		runExport(args[1:])
+	case "rule":
+		runRule(args[1:])
 	default:
 		log.Fatal("Unknown command; options: serve, log, store")
 	}
@@ -184,11 +188,45 @@ func runStore(args []string) {
 	flagAuthToken := flags.String("token", "", "Auth token")
 	flagCheck := flags.Bool("check", false, "Check store")
 	flagFix := flags.Bool("fix", false, "Fix store")
+	flagBackup := flags.String("backup", "", "Back up store to file (SIOT can be running)")
+	flagRestore := flags.String("restore", "", "Restore store from backup file (SIOT must be stopped)")
+	flagStore := flags.String("store", "siot.sqlite", "store file to back up or restore, default siot.sqlite")
 
 	if err := flags.Parse(args); err != nil {
 		log.Fatal("error: ", err)
 	}
 
+	// backup and restore work on the store file directly, so don't
+	// connect to the server
+	dataDir := os.Getenv("SIOT_DATA")
+	if dataDir == "" {
+		dataDir = "./"
+	}
+
+	storeFile := path.Join(dataDir, *flagStore)
+
+	if *flagBackup != "" {
+		err := store.Backup(storeFile, *flagBackup)
+		if err != nil {
+			log.Println("DB backup failed:", err)
+			os.Exit(-1)
+		}
+
+		log.Println("DB backed up to:", *flagBackup)
+		return
+	}
+
+	if *flagRestore != "" {
+		err := store.Restore(*flagRestore, storeFile)
+		if err != nil {
+			log.Println("DB restore failed:", err)
+			os.Exit(-1)
+		}
+
+		log.Println("DB restored to:", storeFile)
+		return
+	}
+
 	// only consider env if command line option is something different
 	// that default
 	natsServer := *flagNatsServer
@@ -535,3 +573,78 @@ func runExport(args []string) {
 	}
 
 }
+
+func runRule(args []string) {
+	if len(args) < 1 || args[0] != "test" {
+		fmt.Println("usage: siot rule test [OPTION]...")
+		os.Exit(-1)
+	}
+
+	flags := flag.NewFlagSet("rule test", flag.ExitOnError)
+	flagRule := flags.String("rule", "", "YAML file with the rule (same format as export)")
+	flagPoints := flags.String("points", "", "CSV file with points (columns: time, nodeID, type, key, value, text)")
+	flagEnd := flags.String("end", "", "time to end the simulation (RFC3339), default is the last point")
+	flagTimezone := flags.String("timezone", "", "timezone for schedules, default is inherited from the export")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		log.Fatal("error: ", err)
+	}
+
+	if *flagRule == "" || *flagPoints == "" {
+		fmt.Println("Error, rule and points files must be given.")
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	yaml, err := os.ReadFile(*flagRule)
+	if err != nil {
+		log.Fatal("Error reading rule: ", err)
+	}
+
+	rule, timezone, err := client.RuleFromYAML(yaml)
+	if err != nil {
+		log.Fatal("Error loading rule: ", err)
+	}
+
+	f, err := os.Open(*flagPoints)
+	if err != nil {
+		log.Fatal("Error opening points: ", err)
+	}
+	defer f.Close()
+
+	points, err := client.PointsFromCSV(f)
+	if err != nil {
+		log.Fatal("Error loading points: ", err)
+	}
+
+	opts := client.RuleSimOptions{Timezone: timezone}
+
+	if *flagTimezone != "" {
+		opts.Timezone = *flagTimezone
+	}
+
+	if *flagEnd != "" {
+		opts.End, err = time.Parse(time.RFC3339, *flagEnd)
+		if err != nil {
+			log.Fatal("Error parsing end time: ", err)
+		}
+	}
+
+	events, err := client.SimulateRule(rule, points, opts)
+	if err != nil {
+		log.Fatal("Error simulating rule: ", err)
+	}
+
+	errCount := 0
+	for _, e := range events {
+		fmt.Println(e)
+		if e.Error != "" {
+			errCount++
+		}
+	}
+
+	if errCount > 0 {
+		log.Printf("Rule test found %v error(s)\n", errCount)
+		os.Exit(1)
+	}
+}
@@ -16,6 +16,8 @@ type Edge struct {
 	Points Points `json:"points"`
 	Hash   uint32 `json:"hash"`
 	Type   string `json:"type"`
+	// SecretHash is the part of Hash from secret points
+	SecretHash uint32 `json:"secretHash"`
 }
 
 func (e Edge) String() string {
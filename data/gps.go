@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	nmea "github.com/adrianmo/go-nmea"
 )
 
@@ -19,3 +21,21 @@ func (p *GpsPos) FromGPGGA(gpgga nmea.GPGGA) {
 	p.Fix = gpgga.FixQuality
 	p.NumSat = gpgga.NumSatellites
 }
+
+// HasFix returns true if the position is valid. A GGA fix quality of 0 means
+// the receiver does not have a fix.
+func (p *GpsPos) HasFix() bool {
+	return p.Fix != "" && p.Fix != "0"
+}
+
+// ToPoints converts a position to the points a GPS node reports. Latitude and
+// longitude can be used as the location of sun schedule conditions.
+func (p *GpsPos) ToPoints() Points {
+	now := time.Now()
+	return Points{
+		{Type: PointTypeLatitude, Time: now, Value: p.Lat},
+		{Type: PointTypeLongitude, Time: now, Value: p.Long},
+		{Type: PointTypeFix, Time: now, Text: p.Fix},
+		{Type: PointTypeNumSat, Time: now, Value: float64(p.NumSat)},
+	}
+}
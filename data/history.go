@@ -289,6 +289,64 @@ func (t TagFilters) Flux(sb *strings.Builder) error {
 	return nil
 }
 
+// Match returns true if tags satisfy the tag filters. This is used to filter
+// history that is not stored in Influx. A tag filter value of "" matches tags
+// that don't exist, the same as Flux.
+func (t TagFilters) Match(tags map[string]string) (bool, error) {
+	for k, v := range t {
+		tag, exists := tags[k]
+
+		matchValue := func(v string) bool {
+			if v == "" {
+				return !exists
+			}
+			return exists && tag == v
+		}
+
+		switch typedV := v.(type) {
+		case string:
+			if !matchValue(typedV) {
+				return false, nil
+			}
+		case []any:
+			if len(typedV) == 0 {
+				continue // no values specified, so skip this filter
+			}
+			match := false
+			for i, elemV := range typedV {
+				strV, ok := elemV.(string)
+				if !ok {
+					return false, errors.New(
+						"invalid tag filter value for " + k + "[" + strconv.Itoa(i) + "]",
+					)
+				}
+				if matchValue(strV) {
+					match = true
+				}
+			}
+			if !match {
+				return false, nil
+			}
+		case []string:
+			if len(typedV) == 0 {
+				continue // no values specified, so skip this filter
+			}
+			match := false
+			for _, strV := range typedV {
+				if matchValue(strV) {
+					match = true
+				}
+			}
+			if !match {
+				return false, nil
+			}
+		default:
+			return false, errors.New("invalid tag filter value for '" + k + "': invalid type")
+		}
+	}
+	return true, nil
+}
+
 // HistoryResults is the result of a history query. The result includes an
 // optional error string along with a slice of either points or aggregated
 // points.
@@ -195,6 +195,9 @@ type NodeEdge struct {
 	Parent     string `json:"parent"`
 	Points     Points `json:"points,omitempty"`
 	EdgePoints Points `json:"edgePoints,omitempty"`
+	// SecretHash is the part of Hash from secret points in the node and
+	// the nodes below it. It is used to compare hashes without secrets.
+	SecretHash uint32 `json:"secretHash,omitempty" yaml:"-"`
 }
 
 func (n NodeEdge) String() string {
@@ -250,6 +253,29 @@ func (n NodeEdge) CalcHash(children []NodeEdge) uint32 {
 	return ret
 }
 
+// CalcSecretHash calculates the part of the hash for a node from secret
+// points
+func (n NodeEdge) CalcSecretHash(children []NodeEdge) uint32 {
+	var ret uint32
+	for _, p := range n.Points {
+		if p.IsSecret() {
+			ret ^= p.CRC()
+		}
+	}
+
+	for _, p := range n.EdgePoints {
+		if p.IsSecret() {
+			ret ^= p.CRC()
+		}
+	}
+
+	for _, c := range children {
+		ret ^= c.SecretHash
+	}
+
+	return ret
+}
+
 // FIXME -- should ToNode really be used as it is lossy?
 
 // ToNode converts to structure stored in db
@@ -302,6 +328,7 @@ func (n *NodeEdge) ToPbNode() (*pb.Node, error) {
 		Points:     points,
 		EdgePoints: edgePoints,
 		Parent:     n.Parent,
+		SecretHash: int32(n.SecretHash),
 	}
 
 	return pbNode, nil
@@ -376,6 +403,7 @@ func PbToNode(pbNode *pb.Node) (NodeEdge, error) {
 		Points:     points,
 		EdgePoints: edgePoints,
 		Parent:     pbNode.Parent,
+		SecretHash: uint32(pbNode.SecretHash),
 	}
 
 	return ret, nil
@@ -12,6 +12,8 @@ type Notification struct {
 	SourceNode string `json:"sourceNode"`
 	Subject    string `json:"subject"`
 	Message    string `json:"message"`
+	// Severity: info, warning, critical. Blank is treated as warning.
+	Severity string `json:"severity"`
 }
 
 // ToPb converts to protobuf data
@@ -22,6 +24,7 @@ func (n *Notification) ToPb() ([]byte, error) {
 		SourceNode: n.SourceNode,
 		Subject:    n.Subject,
 		Msg:        n.Message,
+		Severity:   n.Severity,
 	}
 
 	return proto.Marshal(&pbNot)
@@ -42,5 +45,6 @@ func PbDecodeNotification(data []byte) (Notification, error) {
 		SourceNode: pbNot.SourceNode,
 		Subject:    pbNot.Subject,
 		Message:    pbNot.Msg,
+		Severity:   pbNot.Severity,
 	}, nil
 }
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword returns a salted bcrypt hash of a password. Passwords that
+// are already hashed are returned unchanged.
+func HashPassword(pass string) (string, error) {
+	if IsPasswordHash(pass) {
+		return pass, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// IsPasswordHash returns true if pass is a bcrypt hash
+func IsPasswordHash(pass string) bool {
+	_, err := bcrypt.Cost([]byte(pass))
+	return err == nil
+}
+
+// CheckPassword returns true if pass matches a stored password. Stored
+// passwords that have not been hashed yet (from older versions of SIOT) are
+// compared directly. A blank stored password never matches.
+func CheckPassword(stored, pass string) bool {
+	if stored == "" {
+		return false
+	}
+
+	if IsPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(pass)) == nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1
+}
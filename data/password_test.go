@@ -0,0 +1,36 @@
+package data
+
+import "testing"
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal("Error hashing password: ", err)
+	}
+
+	if hash == "secret" || !IsPasswordHash(hash) {
+		t.Fatal("Password not hashed: ", hash)
+	}
+
+	hash2, err := HashPassword(hash)
+	if err != nil || hash2 != hash {
+		t.Error("Hashed password should not be hashed again")
+	}
+
+	if !CheckPassword(hash, "secret") {
+		t.Error("Password should match hash")
+	}
+
+	if CheckPassword(hash, "wrong") {
+		t.Error("Wrong password should not match hash")
+	}
+
+	// passwords from older versions are not hashed
+	if !CheckPassword("secret", "secret") || CheckPassword("secret", "wrong") {
+		t.Error("Plain text password check failed")
+	}
+
+	if CheckPassword("", "") {
+		t.Error("Blank password should never match")
+	}
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Rule history events
+const (
+	RuleHistoryActive   = "active"
+	RuleHistoryInactive = "inactive"
+	RuleHistoryAction   = "action"
+)
+
+// RuleHistory records a rule activation, deactivation, or action result.
+// Entries are stored as JSON in the text of keyed history points on the
+// rule node.
+type RuleHistory struct {
+	Time time.Time `json:"time"`
+	// Event: active, inactive, action
+	Event string `json:"event"`
+	// the node and point that triggered the rule
+	NodeID    string  `json:"nodeID,omitempty"`
+	PointType string  `json:"pointType,omitempty"`
+	PointKey  string  `json:"pointKey,omitempty"`
+	Value     float64 `json:"value"`
+	Text      string  `json:"text,omitempty"`
+	// the following are set for action events
+	ActionID    string `json:"actionID,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Description string `json:"description,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// RuleHistoryResults is returned by rule history requests
+type RuleHistoryResults struct {
+	ErrorMessage string        `json:"error,omitempty"`
+	History      []RuleHistory `json:"history"`
+}
+
+// ToPoint converts a history entry to a point with the given key
+func (h RuleHistory) ToPoint(key string) (Point, error) {
+	d, err := json.Marshal(h)
+	if err != nil {
+		return Point{}, err
+	}
+
+	return Point{
+		Type: PointTypeHistory,
+		Key:  key,
+		Time: h.Time,
+		Text: string(d),
+	}, nil
+}
+
+// ParseRuleHistory decodes a history entry from history point text
+func ParseRuleHistory(text string) (RuleHistory, error) {
+	var ret RuleHistory
+	err := json.Unmarshal([]byte(text), &ret)
+	return ret, err
+}
+
+// RuleHistoryFromPoints returns the history entries in points, oldest first.
+// Entries that can't be decoded are skipped.
+func RuleHistoryFromPoints(points Points) []RuleHistory {
+	ret := []RuleHistory{}
+
+	for _, p := range points {
+		if p.Type != PointTypeHistory || p.Tombstone%2 == 1 || p.Text == "" {
+			continue
+		}
+
+		h, err := ParseRuleHistory(p.Text)
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, h)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret
+}
@@ -74,6 +74,22 @@ const (
 	PointTypeEmail     = "email"
 	PointTypePass      = "pass"
 
+	// user notification preferences
+	PointTypePreferredChannel = "preferredChannel"
+	PointValueSMS             = "sms"
+	PointValueEmail           = "email"
+	PointTypeMinSeverity      = "minSeverity"
+	PointTypeQuietAction      = "quietAction"
+	PointValueDefer           = "defer"
+	PointValueSkip            = "skip"
+	// messages deferred during quiet hours are stored in the user node
+	// until they are delivered. The key is the notification ID.
+	PointTypeDeferredMessage = "deferredMessage"
+
+	// quiet hours nodes are children of users and use the same points as
+	// schedule conditions (start, end, weekday, date)
+	NodeTypeQuietHours = "quietHours"
+
 	// user edge points
 	PointTypeRole       = "role"
 	PointValueRoleAdmin = "admin"
@@ -135,9 +151,15 @@ const (
 
 	NodeTypeCondition = "condition"
 
+	// a condition group combines child conditions and condition groups
+	// using the operator point (and, or, not)
+	NodeTypeConditionGroup = "conditionGroup"
+
 	PointTypeConditionType = "conditionType"
 	PointValuePointValue   = "pointValue"
 	PointValueSchedule     = "schedule"
+	PointValueNoUpdate     = "noUpdate"
+	PointValueRuleState    = "ruleState"
 
 	PointTypeNodeID = "nodeID"
 
@@ -147,6 +169,18 @@ const (
 	PointTypeEnd     = "end"
 	PointTypeWeekday = "weekday"
 	PointTypeDate    = "date"
+	// IANA timezone name (ex: America/New_York). Schedules are evaluated in
+	// the timezone set on the node, or inherited from an ancestor.
+	PointTypeTimezone = "timezone"
+	// schedule start/end can be a sun event with an optional offset in
+	// minutes (ex: sunset+30)
+	PointValueSunrise = "sunrise"
+	PointValueSunset  = "sunset"
+	// cron expression for schedule conditions
+	PointTypeCron = "cron"
+	// location used to calculate sun events
+	PointTypeLatitude  = "latitude"
+	PointTypeLongitude = "longitude"
 
 	PointTypePointID    = "pointID"
 	PointTypePointKey   = "pointKey"
@@ -165,10 +199,23 @@ const (
 	PointValueOn          = "on"
 	PointValueOff         = "off"
 	PointValueContains    = "contains"
+	PointValueAnd         = "and"
+	PointValueOr          = "or"
+	PointValueNot         = "not"
 
 	PointTypeValueText = "valueText"
 
-	PointTypeMinActive = "minActive"
+	PointTypeMinActive  = "minActive"
+	PointTypeHysteresis = "hysteresis"
+	PointTypeDeadband   = "deadband"
+	PointTypeTimeout    = "timeout"
+
+	PointTypeStatistic = "statistic"
+	PointValueMin      = "min"
+	PointValueMax      = "max"
+	PointValueAvg      = "avg"
+	PointValueRate     = "rate"
+	PointTypeWindow    = "window"
 
 	NodeTypeAction         = "action"
 	NodeTypeActionInactive = "actionInactive"
@@ -185,6 +232,25 @@ const (
 	PointMsgAll  = "msgAll"
 	PointMsgUser = "msgUser"
 
+	// notification nodes hold the state of the last notification sent by
+	// a rule so that it can be acknowledged and escalated
+	NodeTypeNotification = "notification"
+	PointTypeSeverity    = "severity"
+	PointValueInfo       = "info"
+	PointValueWarning    = "warning"
+	PointValueCritical   = "critical"
+	PointTypeSubject     = "subject"
+	PointTypeMessage     = "message"
+	PointTypeSourceNode  = "sourceNode"
+	PointTypeSendTime    = "sendTime"
+	PointTypeLevel       = "level"
+	PointTypeAckBy       = "ackBy"
+	PointTypeAckTime     = "ackTime"
+
+	// escalation nodes are children of rules and describe who to notify
+	// if a notification is not acknowledged (also uses nodeID and timeout)
+	NodeTypeEscalation = "escalation"
+
 	NodeTypeMsgService = "msgService"
 
 	PointTypeService = "service"
@@ -196,10 +262,39 @@ const (
 	PointTypeAuthToken = "authToken"
 	PointTypeFrom      = "from"
 
+	// SMTP message service points (also uses host, port, and from)
+	PointTypeStartTLS = "startTLS"
+	PointTypeUsername = "username"
+	PointTypePassword = "password"
+
+	// webhook message service and rule action points (also uses uri)
+	PointValueWebhook = "webhook"
+	PointTypeHeader   = "header"
+	PointTypeTemplate = "template"
+
+	// setValue rule action expression
+	PointTypeExpression = "expression"
+
+	// rule action sequencing, delay and repeat period are in seconds
+	PointTypeSequence     = "sequence"
+	PointTypeDelay        = "delay"
+	PointTypeRepeatPeriod = "repeatPeriod"
+
+	// exec rule action points (also uses timeout and log)
+	PointValueExec   = "exec"
+	PointTypeCommand = "command"
+	PointTypeArg     = "arg"
+	PointTypeEnv     = "env"
+
+	// rule history entries, see RuleHistory
+	PointTypeHistory = "history"
+
 	NodeTypeVariable      = "variable"
 	PointTypeVariableType = "variableType"
 
 	NodeTypeSync = "sync"
+	// don't sync secret points (see SecretPointTypes) with the upstream
+	PointTypeExcludeSecrets = "excludeSecrets"
 
 	PointTypeMetricNatsCycleNodePoint          = "metricNatsCycleNodePoint"
 	PointTypeMetricNatsCycleNodeEdgePoint      = "metricNatsCycleNodeEdgePoint"
@@ -210,6 +305,10 @@ const (
 	PointTypeMetricNatsThroughputNodePoint     = "metricNatsThroughputNodePoint"
 	PointTypeMetricNatsThroughputNodeEdgePoint = "metricNatsThroughputNodeEdgePoint"
 
+	// counts of tombstones purged by the store, reported on the root node
+	PointTypeStoreGCEdges  = "storeGCEdges"
+	PointTypeStoreGCPoints = "storeGCPoints"
+
 	// serial MCU clients
 	NodeTypeSerialDev         = "serialDev"
 	PointTypeRx               = "rx"
@@ -342,6 +441,12 @@ const (
 	PointTypeServer         = "server"
 	PointTypeFallbackServer = "fallbackServer"
 
+	// GPS receivers write their position with the latitude and longitude
+	// point types
+	NodeTypeGps     = "gps"
+	PointTypeFix    = "fix"
+	PointTypeNumSat = "numSat"
+
 	NodeTypeUpdate           = "update"
 	PointTypeOSUpdate        = "osUpdate"
 	PointTypeAppUpdate       = "appUpdate"
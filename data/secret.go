@@ -0,0 +1,49 @@
+package data
+
+// SecretPointTypes are the point types that contain secrets such as
+// passwords and auth tokens. The text of these points is encrypted at rest
+// by the store (if a secret key is configured), and the points are removed
+// from exports and debug output. Applications can add their own types.
+var SecretPointTypes = map[string]bool{
+	PointTypePass:      true,
+	PointTypePassword:  true,
+	PointTypeToken:     true,
+	PointTypeSID:       true,
+	PointTypeAuthToken: true,
+}
+
+// RedactedText replaces the text of secret points in debug output
+const RedactedText = "<redacted>"
+
+// IsSecret returns true if the point contains a secret
+func (p Point) IsSecret() bool {
+	return SecretPointTypes[p.Type]
+}
+
+// Redact returns a copy of the points where the text of secret points is
+// replaced with RedactedText. Points that are not secret are unchanged.
+func (ps Points) Redact() Points {
+	ret := make(Points, len(ps))
+
+	for i, p := range ps {
+		if p.IsSecret() && p.Text != "" {
+			p.Text = RedactedText
+		}
+		ret[i] = p
+	}
+
+	return ret
+}
+
+// RemoveSecrets returns a copy of the points without any secret points
+func (ps Points) RemoveSecrets() Points {
+	var ret Points
+
+	for _, p := range ps {
+		if !p.IsSecret() {
+			ret = append(ret, p)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,26 @@
+package data
+
+import "testing"
+
+func TestPointsRedact(t *testing.T) {
+	points := Points{
+		{Type: PointTypeDescription, Text: "sync"},
+		{Type: PointTypeAuthToken, Text: "secret"},
+	}
+
+	redacted := points.Redact()
+
+	if redacted[0].Text != "sync" || redacted[1].Text != RedactedText {
+		t.Fatal("Points not redacted correctly: ", redacted)
+	}
+
+	if points[1].Text != "secret" {
+		t.Fatal("Redact modified the original points")
+	}
+
+	removed := points.RemoveSecrets()
+
+	if len(removed) != 1 || removed[0].Type != PointTypeDescription {
+		t.Fatal("Secret points not removed: ", removed)
+	}
+}
@@ -1,9 +1,129 @@
 package data
 
 import (
+	"sort"
 	"time"
 )
 
+// PointWindow keeps the points received within a rolling time window and
+// computes statistics (min/max/avg/rate of change) over them. The window is
+// relative to the newest point time, so it works with both live and
+// recorded data.
+type PointWindow struct {
+	windowLen time.Duration
+	points    []Point
+}
+
+// NewPointWindow initializes and returns a rolling point window
+func NewPointWindow(windowLen time.Duration) *PointWindow {
+	return &PointWindow{
+		windowLen: windowLen,
+	}
+}
+
+// Add adds a point to the window and removes points that are older than
+// the window length relative to the newest point.
+func (pw *PointWindow) Add(p Point) {
+	// points normally arrive in order, but insert in time order just in case
+	i := sort.Search(len(pw.points), func(i int) bool {
+		return pw.points[i].Time.After(p.Time)
+	})
+	pw.points = append(pw.points, Point{})
+	copy(pw.points[i+1:], pw.points[i:])
+	pw.points[i] = p
+
+	newest := pw.points[len(pw.points)-1].Time
+	cutoff := newest.Add(-pw.windowLen)
+
+	drop := 0
+	for drop < len(pw.points) && pw.points[drop].Time.Before(cutoff) {
+		drop++
+	}
+
+	pw.points = pw.points[drop:]
+}
+
+// Len returns the number of points in the window
+func (pw *PointWindow) Len() int {
+	return len(pw.points)
+}
+
+// Min returns the minimum value in the window
+func (pw *PointWindow) Min() float64 {
+	if len(pw.points) == 0 {
+		return 0
+	}
+
+	ret := pw.points[0].Value
+	for _, p := range pw.points[1:] {
+		if p.Value < ret {
+			ret = p.Value
+		}
+	}
+
+	return ret
+}
+
+// Max returns the maximum value in the window
+func (pw *PointWindow) Max() float64 {
+	if len(pw.points) == 0 {
+		return 0
+	}
+
+	ret := pw.points[0].Value
+	for _, p := range pw.points[1:] {
+		if p.Value > ret {
+			ret = p.Value
+		}
+	}
+
+	return ret
+}
+
+// Avg returns the average of the values in the window
+func (pw *PointWindow) Avg() float64 {
+	if len(pw.points) == 0 {
+		return 0
+	}
+
+	var total float64
+	for _, p := range pw.points {
+		total += p.Value
+	}
+
+	return total / float64(len(pw.points))
+}
+
+// Rate returns the rate of change of the values in the window in units per
+// second. The rate is the slope of a least squares fit of the points, which
+// is less sensitive to noise than only using the first and last points.
+// ok is false if there are not enough points to calculate a rate.
+func (pw *PointWindow) Rate() (rate float64, ok bool) {
+	if len(pw.points) < 2 {
+		return 0, false
+	}
+
+	// use time relative to the first point to preserve precision
+	t0 := pw.points[0].Time
+	n := float64(len(pw.points))
+	var sumT, sumV, sumTT, sumTV float64
+	for _, p := range pw.points {
+		t := p.Time.Sub(t0).Seconds()
+		sumT += t
+		sumV += p.Value
+		sumTT += t * t
+		sumTV += t * p.Value
+	}
+
+	den := n*sumTT - sumT*sumT
+	if den == 0 {
+		// all points have the same timestamp
+		return 0, false
+	}
+
+	return (n*sumTV - sumT*sumV) / den, true
+}
+
 // TimeWindowAverager accumulates points, and averages them on a fixed time
 // period and outputs the average/min/max, etc as a point
 type TimeWindowAverager struct {
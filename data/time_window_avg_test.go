@@ -2,6 +2,7 @@ package data
 
 import (
 	"fmt"
+	"math"
 	"testing"
 	"time"
 )
@@ -36,3 +37,79 @@ func TestNewPoint(t *testing.T) {
 		}
 	}
 }
+
+func TestPointWindow(t *testing.T) {
+	start := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	pw := NewPointWindow(time.Minute)
+
+	for i, v := range []float64{10, 20, 30, 40} {
+		pw.Add(Point{Time: start.Add(time.Duration(i) * 20 * time.Second), Value: v})
+	}
+
+	// first point (t=0) is exactly 1m older than the newest (t=60s), so it
+	// is on the edge of the window and is retained
+	if pw.Len() != 4 {
+		t.Fatalf("expected 4 points, got %v", pw.Len())
+	}
+
+	pw.Add(Point{Time: start.Add(80 * time.Second), Value: 50})
+
+	if pw.Len() != 4 {
+		t.Fatalf("expected 4 points after prune, got %v", pw.Len())
+	}
+
+	if pw.Min() != 20 {
+		t.Error("min is not correct: ", pw.Min())
+	}
+
+	if pw.Max() != 50 {
+		t.Error("max is not correct: ", pw.Max())
+	}
+
+	if pw.Avg() != 35 {
+		t.Error("avg is not correct: ", pw.Avg())
+	}
+
+	rate, ok := pw.Rate()
+	if !ok {
+		t.Fatal("rate should be valid")
+	}
+
+	// 10 units every 20 seconds
+	if math.Abs(rate-0.5) > 1e-9 {
+		t.Error("rate is not correct: ", rate)
+	}
+}
+
+func TestPointWindowOutOfOrder(t *testing.T) {
+	start := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	pw := NewPointWindow(time.Minute)
+
+	pw.Add(Point{Time: start.Add(10 * time.Second), Value: 20})
+	pw.Add(Point{Time: start, Value: 10})
+
+	rate, ok := pw.Rate()
+	if !ok {
+		t.Fatal("rate should be valid")
+	}
+
+	if math.Abs(rate-1) > 1e-9 {
+		t.Error("rate is not correct: ", rate)
+	}
+}
+
+func TestPointWindowRateNotEnoughPoints(t *testing.T) {
+	pw := NewPointWindow(time.Minute)
+
+	if _, ok := pw.Rate(); ok {
+		t.Error("rate should not be valid with no points")
+	}
+
+	pw.Add(Point{Time: time.Now(), Value: 10})
+
+	if _, ok := pw.Rate(); ok {
+		t.Error("rate should not be valid with one point")
+	}
+}
@@ -18,6 +18,7 @@ module Api.Node exposing
     , typeDb
     , typeDevice
     , typeFile
+    , typeGps
     , typeGroup
     , typeMetrics
     , typeModbus
@@ -180,6 +181,11 @@ typeNTP =
     "ntp"
 
 
+typeGps : String
+typeGps =
+    "gps"
+
+
 typeUpdate : String
 typeUpdate =
     "update"
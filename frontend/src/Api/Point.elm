@@ -41,10 +41,12 @@ module Api.Point exposing
     , typeConditionType
     , typeConnected
     , typeControlled
+    , typeCron
     , typeData
     , typeDataFormat
     , typeDate
     , typeDebug
+    , typeDelay
     , typeDescription
     , typeDestination
     , typeDevice
@@ -55,6 +57,8 @@ module Api.Point exposing
     , typeDownloadOS
     , typeEmail
     , typeEnd
+    , typeExcludeSecrets
+    , typeExpression
     , typeError
     , typeErrorCount
     , typeErrorCountCRC
@@ -67,18 +71,23 @@ module Api.Point exposing
     , typeFallbackServer
     , typeFilePath
     , typeFirstName
+    , typeFix
     , typeFrequency
     , typeFrom
     , typeHRDest
     , typeHrRx
     , typeHrRxReset
+    , typeHeader
+    , typeHost
     , typeID
     , typeIP
     , typeIndex
     , typeInitialValue
     , typeLastName
+    , typeLatitude
     , typeLightSet
     , typeLog
+    , typeLongitude
     , typeMaxIncrement
     , typeMaxMessageLength
     , typeMaxValue
@@ -93,6 +102,7 @@ module Api.Point exposing
     , typeMsgsRecvdOtherReset
     , typeName
     , typeNodeID
+    , typeNumSat
     , typeOSDownloaded
     , typeOSUpdate
     , typeOffline
@@ -100,6 +110,7 @@ module Api.Point exposing
     , typeOperator
     , typeOrg
     , typePass
+    , typePassword
     , typePeriod
     , typePhone
     , typePointKey
@@ -109,6 +120,11 @@ module Api.Point exposing
     , typePrefix
     , typeProtocol
     , typeRate
+    , typeRepeatPeriod
+    , typeCommand
+    , typeArg
+    , typeEnv
+    , typeTimeout
     , typeRateHR
     , typeReadOnly
     , typeReboot
@@ -118,18 +134,33 @@ module Api.Point exposing
     , typeRxReset
     , typeSID
     , typeSampleRate
+    , typeSequence
     , typeScale
     , typeServer
     , typeService
     , typeSignalType
     , typeSignalsInDb
     , typeStart
+    , typeStartTLS
     , typeSwitchSet
     , typeSyncCount
     , typeSyncCountReset
     , typeSyncParent
     , typeSysState
     , typeTag
+    , typeTemplate
+    , typeTimezone
+    , typePreferredChannel
+    , valueSMS
+    , valueEmail
+    , typeMinSeverity
+    , typeQuietAction
+    , valueDefer
+    , valueSkip
+    , typeSeverity
+    , valueInfo
+    , valueWarning
+    , valueCritical
     , typeTagPointType
     , typeTombstone
     , typeTx
@@ -137,6 +168,7 @@ module Api.Point exposing
     , typeType
     , typeURI
     , typeUnits
+    , typeUsername
     , typeValue
     , typeValueSet
     , typeValueText
@@ -170,7 +202,9 @@ module Api.Point exposing
     , valueProcess
     , valueRTU
     , valueRandomWalk
+    , valueSMTP
     , valueSchedule
+    , valueRuleState
     , valueServer
     , valueSetValue
     , valueSine
@@ -180,6 +214,8 @@ module Api.Point exposing
     , valueText
     , valueTriangle
     , valueTwilio
+    , valueWebhook
+    , valueExec
     , valueUINT16
     , valueUINT32
     )
@@ -414,6 +450,11 @@ typeSyncCountReset =
     "syncCountReset"
 
 
+typeExcludeSecrets : String
+typeExcludeSecrets =
+    "excludeSecrets"
+
+
 typeErrorCountHR : String
 typeErrorCountHR =
     "errorCountHR"
@@ -574,6 +615,11 @@ valueSchedule =
     "schedule"
 
 
+valueRuleState : String
+valueRuleState =
+    "ruleState"
+
+
 typeValueType : String
 typeValueType =
     "valueType"
@@ -599,6 +645,36 @@ typeDate =
     "date"
 
 
+typeTimezone : String
+typeTimezone =
+    "timezone"
+
+
+typeCron : String
+typeCron =
+    "cron"
+
+
+typeLatitude : String
+typeLatitude =
+    "latitude"
+
+
+typeLongitude : String
+typeLongitude =
+    "longitude"
+
+
+typeFix : String
+typeFix =
+    "fix"
+
+
+typeNumSat : String
+typeNumSat =
+    "numSat"
+
+
 typePointType : String
 typePointType =
     "pointType"
@@ -689,6 +765,146 @@ typeFrom =
     "from"
 
 
+valueSMTP : String
+valueSMTP =
+    "smtp"
+
+
+typeHost : String
+typeHost =
+    "host"
+
+
+typeStartTLS : String
+typeStartTLS =
+    "startTLS"
+
+
+typeUsername : String
+typeUsername =
+    "username"
+
+
+typePassword : String
+typePassword =
+    "password"
+
+
+valueWebhook : String
+valueWebhook =
+    "webhook"
+
+
+typeHeader : String
+typeHeader =
+    "header"
+
+
+typeTemplate : String
+typeTemplate =
+    "template"
+
+
+typeExpression : String
+typeExpression =
+    "expression"
+
+
+typeSequence : String
+typeSequence =
+    "sequence"
+
+
+typeDelay : String
+typeDelay =
+    "delay"
+
+
+typeRepeatPeriod : String
+typeRepeatPeriod =
+    "repeatPeriod"
+
+
+valueExec : String
+valueExec =
+    "exec"
+
+
+typeCommand : String
+typeCommand =
+    "command"
+
+
+typeArg : String
+typeArg =
+    "arg"
+
+
+typeEnv : String
+typeEnv =
+    "env"
+
+
+typeTimeout : String
+typeTimeout =
+    "timeout"
+
+
+typePreferredChannel : String
+typePreferredChannel =
+    "preferredChannel"
+
+
+valueSMS : String
+valueSMS =
+    "sms"
+
+
+valueEmail : String
+valueEmail =
+    "email"
+
+
+typeMinSeverity : String
+typeMinSeverity =
+    "minSeverity"
+
+
+typeQuietAction : String
+typeQuietAction =
+    "quietAction"
+
+
+valueDefer : String
+valueDefer =
+    "defer"
+
+
+valueSkip : String
+valueSkip =
+    "skip"
+
+
+typeSeverity : String
+typeSeverity =
+    "severity"
+
+
+valueInfo : String
+valueInfo =
+    "info"
+
+
+valueWarning : String
+valueWarning =
+    "warning"
+
+
+valueCritical : String
+valueCritical =
+    "critical"
+
+
 typeVariableType : String
 typeVariableType =
     "variableType"
@@ -88,12 +88,24 @@ view o =
                         actionType =
                             Point.getText o.node.points Point.typeAction "0"
 
+                        actionNotify =
+                            actionType == Point.valueNotify
+
                         actionSetValue =
                             actionType == Point.valueSetValue
 
                         actionPlayAudio =
                             actionType == Point.valuePlayAudio
 
+                        actionWebhook =
+                            actionType == Point.valueWebhook
+
+                        actionExec =
+                            actionType == Point.valueExec
+
+                        log =
+                            Point.getText o.node.points Point.typeLog "0"
+
                         valueType =
                             Point.getText o.node.points Point.typeValueType "0"
 
@@ -106,7 +118,18 @@ view o =
                         [ ( Point.valueNotify, "notify" )
                         , ( Point.valueSetValue, "set node value" )
                         , ( Point.valuePlayAudio, "play audio" )
+                        , ( Point.valueWebhook, "webhook" )
+                        , ( Point.valueExec, "run command" )
                         ]
+                    , viewIf actionNotify <|
+                        textInput Point.typeTemplate "Message template" "blank for default message"
+                    , viewIf actionNotify <|
+                        optionInput Point.typeSeverity
+                            "Severity"
+                            [ ( Point.valueInfo, "info" )
+                            , ( Point.valueWarning, "warning" )
+                            , ( Point.valueCritical, "critical" )
+                            ]
                     , viewIf actionSetValue <|
                         optionInput Point.typePointType
                             "Point Type"
@@ -183,12 +206,35 @@ view o =
 
                             _ ->
                                 Element.none
+                    , viewIf actionSetValue <|
+                        textInput Point.typeExpression "Expression" "trigger.value * 0.5"
                     , viewIf actionPlayAudio <|
                         textInput Point.typeDevice "Device" ""
                     , viewIf actionPlayAudio <|
                         numberInput Point.typeChannel "Channel"
                     , viewIf actionPlayAudio <|
                         textInput Point.typeFilePath "Wav file path" "/absolute/path/to/sound.wav"
+                    , viewIf actionWebhook <|
+                        textInput Point.typeURI "URL" "https://example.com/hook"
+                    , viewIf actionWebhook <|
+                        NodeInputs.nodeKeyValueInput opts Point.typeHeader "Headers" "Add Header"
+                    , viewIf actionWebhook <|
+                        textInput Point.typeTemplate "Body template" "blank to send JSON"
+                    , viewIf actionExec <|
+                        textInput Point.typeCommand "Command" "/usr/local/bin/script.sh"
+                    , viewIf actionExec <|
+                        NodeInputs.nodeListInput opts Point.typeArg "Arguments" "Add Argument"
+                    , viewIf actionExec <|
+                        NodeInputs.nodeKeyValueInput opts Point.typeEnv "Environment" "Add Variable"
+                    , viewIf actionExec <|
+                        numberInput Point.typeTimeout "Timeout (s)"
+                    , viewIf (actionExec && log /= "") <|
+                        text <|
+                            "Last output: "
+                                ++ log
+                    , numberInput Point.typeSequence "Sequence"
+                    , numberInput Point.typeDelay "Delay (s)"
+                    , numberInput Point.typeRepeatPeriod "Repeat period (s)"
                     , el [ Font.color Style.colors.red ] <| text error
                     , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
                     ]
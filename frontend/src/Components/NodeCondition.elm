@@ -2,11 +2,12 @@ module Components.NodeCondition exposing (view)
 
 import Api.Node as Node
 import Api.Point as Point
-import Components.NodeOptions exposing (CopyMove(..), NodeOptions, findNode, oToInputO)
+import Components.NodeOptions exposing (CopyMove(..), NodeOptions, findNode, findTimezone, oToInputO)
 import Element exposing (..)
 import Element.Background as Background
 import Element.Border as Border
 import Element.Font as Font
+import Time
 import UI.Icon as Icon
 import UI.NodeInputs as NodeInputs
 import UI.Style as Style
@@ -82,6 +83,7 @@ view o =
                         "Type"
                         [ ( Point.valuePointValue, "point value" )
                         , ( Point.valueSchedule, "schedule" )
+                        , ( Point.valueRuleState, "rule state" )
                         ]
                     , case conditionType of
                         "pointValue" ->
@@ -90,6 +92,9 @@ view o =
                         "schedule" ->
                             schedule o labelWidth
 
+                        "ruleState" ->
+                            ruleState o labelWidth
+
                         _ ->
                             el [ Font.color Style.colors.red ] <| text "Please select condition type"
                     , el [ Font.color Style.colors.red ] <| text error
@@ -101,13 +106,77 @@ view o =
                )
 
 
+ruleState : NodeOptions msg -> Int -> Element msg
+ruleState o labelWidth =
+    let
+        opts =
+            oToInputO o labelWidth
+
+        nodeId =
+            Point.getText o.node.points Point.typeNodeID "0"
+    in
+    column
+        [ spacing 6 ]
+        [ NodeInputs.nodeTextInput opts "0" Point.typeNodeID "Rule node ID" ""
+        , if nodeId /= "" then
+            case findNode o.nodes nodeId of
+                Just node ->
+                    el [ Font.italic, paddingEach { top = 0, right = 0, left = labelWidth, bottom = 0 } ] <|
+                        el [ Background.color Style.colors.ltblue ] <|
+                            text <|
+                                "("
+                                    ++ Node.getBestDesc node
+                                    ++ ")"
+
+                Nothing ->
+                    el [ Font.italic, paddingEach { top = 0, right = 0, left = labelWidth, bottom = 0 } ] <|
+                        el [ Background.color Style.colors.orange ] <|
+                            text "(node not found)"
+
+          else
+            Element.none
+        , NodeInputs.nodeOnOffInput opts "" Point.typeValue Point.typeValue "Rule active"
+        , NodeInputs.nodeNumberInput opts "0" Point.typeMinActive "Min active time (m)"
+        ]
+
+
 schedule : NodeOptions msg -> Int -> Element msg
 schedule o labelWidth =
     let
         opts =
             oToInputO o labelWidth
+
+        timezone =
+            findTimezone o.nodes o.node
+
+        -- schedule times are stored in UTC unless a timezone is set on
+        -- the condition or an ancestor, in which case they are stored
+        -- as local times in that timezone
+        timeOpts =
+            if timezone /= "" then
+                { opts | zone = Time.utc }
+
+            else
+                opts
+
+        cron =
+            Point.getText o.node.points Point.typeCron "0"
     in
-    NodeInputs.nodeTimeDateInput opts labelWidth
+    column
+        [ spacing 6 ]
+        [ NodeInputs.nodeTextInput opts "0" Point.typeTimezone "Timezone" "UTC"
+        , NodeInputs.nodeTextInput opts "0" Point.typeCron "Cron" "*/15 * * * mon-fri"
+        , if cron == "" then
+            NodeInputs.nodeTimeDateInput timeOpts labelWidth
+
+          else
+            Element.none
+        , el [ Font.italic, paddingEach { top = 0, right = 0, left = labelWidth, bottom = 0 } ] <|
+            text "Start/end can also be sunrise or sunset, with an offset in minutes (sunset+30)"
+        , NodeInputs.nodeNumberInput opts "0" Point.typeLatitude "Latitude"
+        , NodeInputs.nodeNumberInput opts "0" Point.typeLongitude "Longitude"
+        , NodeInputs.nodeTextInput opts "0" Point.typeNodeID "Location node ID" ""
+        ]
 
 
 pointValue : NodeOptions msg -> Int -> Element msg
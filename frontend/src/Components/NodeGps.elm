@@ -0,0 +1,85 @@
+module Components.NodeGps exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Background as Background
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        fix =
+            Point.getText o.node.points Point.typeFix ""
+
+        noFix =
+            fix == "" || fix == "0"
+
+        summaryBackground =
+            if disabled || noFix then
+                Style.colors.ltgray
+
+            else
+                Style.colors.none
+
+        latitude =
+            Point.getValue o.node.points Point.typeLatitude ""
+
+        longitude =
+            Point.getValue o.node.points Point.typeLongitude ""
+
+        numSat =
+            Point.getValue o.node.points Point.typeNumSat ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10, Background.color summaryBackground ]
+            [ Icon.mapPin
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            , viewIf (not disabled && noFix) <| text "(no fix)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typePort "Port" "/dev/ttyUSB0"
+                    , textInput Point.typeBaud "Baud" "4800"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , text <|
+                        "  Position: "
+                            ++ Round.round 5 latitude
+                            ++ ", "
+                            ++ Round.round 5 longitude
+                    , text <| "  Satellites: " ++ String.fromFloat numSat
+                    ]
+
+                else
+                    []
+               )
@@ -36,17 +36,49 @@ view o =
 
                         optionInput =
                             NodeInputs.nodeOptionInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+
+                        service =
+                            Point.getText o.node.points Point.typeService "0"
+
+                        serviceInputs =
+                            if service == Point.valueSMTP then
+                                [ textInput Point.typeHost "Host" "smtp.example.com"
+                                , numberInput Point.typePort "Port"
+                                , checkboxInput Point.typeStartTLS "STARTTLS"
+                                , textInput Point.typeUsername "Username" ""
+                                , textInput Point.typePassword "Password" ""
+                                , textInput Point.typeFrom "From" "siot@example.com"
+                                ]
+
+                            else if service == Point.valueWebhook then
+                                [ textInput Point.typeURI "URL" "https://example.com/hook"
+                                , NodeInputs.nodeKeyValueInput opts Point.typeHeader "Headers" "Add Header"
+                                , textInput Point.typeTemplate "Body template" "blank to send JSON"
+                                ]
+
+                            else
+                                [ textInput Point.typeSID "SID" ""
+                                , textInput Point.typeAuthToken "Auth Token" ""
+                                , textInput Point.typeFrom "From" ""
+                                ]
                     in
                     [ textInput Point.typeDescription "Description" ""
                     , optionInput Point.typeService
                         "Service"
                         [ ( Point.valueTwilio, "Twilio SMS" )
+                        , ( Point.valueSMTP, "SMTP Email" )
+                        , ( Point.valueWebhook, "Webhook" )
                         ]
-                    , textInput Point.typeSID "SID" ""
-                    , textInput Point.typeAuthToken "Auth Token" ""
-                    , textInput Point.typeFrom "From" ""
-                    , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
                     ]
+                        ++ serviceInputs
+                        ++ [ NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
+                           ]
 
                 else
                     []
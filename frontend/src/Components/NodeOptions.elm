@@ -1,7 +1,7 @@
-module Components.NodeOptions exposing (CopyMove(..), NodeOptions, findNode, oToInputO)
+module Components.NodeOptions exposing (CopyMove(..), NodeOptions, findNode, findTimezone, oToInputO)
 
 import Api.Node exposing (Node, NodeView)
-import Api.Point exposing (Point)
+import Api.Point as Point exposing (Point)
 import Time
 import Tree exposing (Tree)
 import Tree.Zipper as Zipper
@@ -62,3 +62,25 @@ findNode nodes id =
         )
         Nothing
         nodes
+
+
+{-| findTimezone returns the timezone point of a node, or the timezone
+of the closest ancestor that has one. Blank is returned if no timezone
+is found.
+-}
+findTimezone : List (Tree NodeView) -> Node -> String
+findTimezone nodes node =
+    let
+        tz =
+            Point.getText node.points Point.typeTimezone ""
+    in
+    if tz /= "" then
+        tz
+
+    else
+        case findNode nodes node.parent of
+            Just parent ->
+                findTimezone nodes parent
+
+            Nothing ->
+                ""
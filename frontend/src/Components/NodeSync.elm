@@ -50,6 +50,7 @@ view o =
                     , textInput Point.typeURI "URI" "nats://myserver:4222, ws://myserver"
                     , textInput Point.typeAuthToken "Auth Token" ""
                     , textNumber Point.typePeriod "Sync Period (s)"
+                    , checkboxInput Point.typeExcludeSecrets "Exclude secret points"
                     , checkboxInput Point.typeDisabled "Disabled"
                     , counterWithReset Point.typeSyncCount Point.typeSyncCountReset "Sync Count"
                     ]
@@ -49,12 +49,38 @@ view o =
 
                         textInput =
                             NodeInputs.nodeTextInput opts "0"
+
+                        passwordInput =
+                            NodeInputs.nodePasswordInput opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        severities =
+                            [ ( Point.valueInfo, "info" )
+                            , ( Point.valueWarning, "warning" )
+                            , ( Point.valueCritical, "critical" )
+                            ]
                     in
                     [ textInput Point.typeFirstName "First Name" ""
                     , textInput Point.typeLastName "Last Name" ""
                     , textInputLowerCase Point.typeEmail "Email" ""
                     , textInput Point.typePhone "Phone" ""
-                    , textInput Point.typePass "Pass" ""
+                    , passwordInput Point.typePass "Pass"
+                    , optionInput Point.typePreferredChannel
+                        "Notify by"
+                        [ ( "", "all" )
+                        , ( Point.valueSMS, "SMS" )
+                        , ( Point.valueEmail, "email" )
+                        , ( Point.valueWebhook, "webhook" )
+                        ]
+                    , optionInput Point.typeMinSeverity "Min severity" severities
+                    , optionInput Point.typeQuietAction
+                        "Quiet hours"
+                        [ ( Point.valueDefer, "defer" )
+                        , ( Point.valueSkip, "skip" )
+                        ]
+                    , textInput Point.typeTimezone "Timezone" "UTC"
                     , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
                     ]
 
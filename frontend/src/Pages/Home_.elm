@@ -12,6 +12,7 @@ import Components.NodeCondition as NodeCondition
 import Components.NodeDb as NodeDb
 import Components.NodeDevice as NodeDevice
 import Components.NodeFile as File
+import Components.NodeGps as NodeGps
 import Components.NodeGroup as NodeGroup
 import Components.NodeMessageService as NodeMessageService
 import Components.NodeMetrics as NodeMetrics
@@ -1037,6 +1038,7 @@ nodeCustomSortRules =
         , ( Node.typeNetworkManager, "R" )
         , ( Node.typeNTP, "S" )
         , ( Node.typeUpdate, "T" )
+        , ( Node.typeGps, "U" )
 
         -- rule subnodes
         , ( Node.typeCondition, "A" )
@@ -1321,6 +1323,9 @@ viewNode model parent node children depth =
                     "ntp" ->
                         NodeNTP.view
 
+                    "gps" ->
+                        NodeGps.view
+
                     "networkManagerDevice" ->
                         NodeNetworkManagerDevice.view
 
@@ -1644,6 +1649,11 @@ nodeDescNTP =
     row [] [ Icon.clock, text "NTP" ]
 
 
+nodeDescGps : Element Msg
+nodeDescGps =
+    row [] [ Icon.mapPin, text "GPS" ]
+
+
 viewAddNode : String -> NodeView -> NodeToAdd -> Element Msg
 viewAddNode customNodeType parent add =
     column [ spacing 10 ]
@@ -1660,6 +1670,7 @@ viewAddNode customNodeType parent add =
                     , Input.option Node.typeNTP nodeDescNTP
                     , Input.option Node.typeModbus nodeDescModbus
                     , Input.option Node.typeSerialDev nodeDescSerialDev
+                    , Input.option Node.typeGps nodeDescGps
                     , Input.option Node.typeCanBus nodeDescCanBus
                     , Input.option Node.typeMsgService nodeDescMsgService
                     , Input.option Node.typeDb nodeDescDb
@@ -1682,6 +1693,7 @@ viewAddNode customNodeType parent add =
                             , Input.option Node.typeRule nodeDescRule
                             , Input.option Node.typeModbus nodeDescModbus
                             , Input.option Node.typeSerialDev nodeDescSerialDev
+                            , Input.option Node.typeGps nodeDescGps
                             , Input.option Node.typeCanBus nodeDescCanBus
                             , Input.option Node.typeMsgService nodeDescMsgService
                             , Input.option Node.typeDb nodeDescDb
@@ -14,6 +14,7 @@ module UI.Icon exposing
     , file
     , io
     , list
+    , mapPin
     , network
     , oneWire
     , particle
@@ -263,6 +264,11 @@ clock =
     icon FeatherIcons.clock
 
 
+mapPin : Element msg
+mapPin =
+    icon FeatherIcons.mapPin
+
+
 update : Element msg
 update =
     icon FeatherIcons.refreshCw
@@ -7,6 +7,7 @@ module UI.NodeInputs exposing
     , nodeNumberInput
     , nodeOnOffInput
     , nodeOptionInput
+    , nodePasswordInput
     , nodePasteButton
     , nodeTextInput
     , nodeTimeDateInput
@@ -85,6 +86,46 @@ nodeTextInput o key typ lbl placeholder =
         }
 
 
+
+nodePasswordInput :
+    NodeInputOptions msg
+    -> String
+    -> String
+    -> String
+    -> Element msg
+nodePasswordInput o key typ lbl =
+    let
+        textRaw =
+            Point.getText o.node.points typ key
+    in
+    Input.newPassword
+        []
+        { onChange =
+            \d ->
+                o.onEditNodePoint [ Point typ key o.now 0 d 0 ]
+        , text =
+            -- stored passwords are hashed, so there is nothing to show
+            if String.startsWith "$2" textRaw then
+                ""
+
+            else
+                textRaw
+        , placeholder =
+            if textRaw == "" then
+                Nothing
+
+            else
+                Just <| Input.placeholder [] <| text "(unchanged)"
+        , label =
+            if lbl == "" then
+                Input.labelHidden ""
+
+            else
+                Input.labelLeft [ width (px o.labelWidth) ] <| el [ alignRight ] <| text <| lbl ++ ":"
+        , show = False
+        }
+
+
 nodeTimeDateInput : NodeInputOptions msg -> Int -> Element msg
 nodeTimeDateInput o labelWidth =
     let
@@ -99,8 +140,13 @@ nodeTimeDateInput o labelWidth =
 
         sendTime updateSchedule tm =
             let
+                -- sun events (sunrise, sunset+30) are not sanitized
                 tmClean =
-                    Sanitize.time tm
+                    if String.startsWith "s" (String.toLower tm) then
+                        String.toLower tm
+
+                    else
+                        Sanitize.time tm
             in
             updateSchedule sLocal tmClean
                 |> checkScheduleToUTC zoneOffset
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	nmea "github.com/adrianmo/go-nmea"
@@ -18,8 +19,10 @@ type Gps struct {
 	baud     uint
 	c        chan data.GpsPos
 	debug    bool
-	stop     bool
-	port     io.ReadWriteCloser
+
+	lock sync.Mutex
+	done chan struct{}
+	port io.ReadWriteCloser
 }
 
 // NewGps is used to create a new Gps type
@@ -38,14 +41,41 @@ func (gps *Gps) SetDebug(d bool) {
 
 // Stop can be used to stop the GPS acquisition and close port
 func (gps *Gps) Stop() {
-	gps.port.Close()
-	gps.stop = true
+	gps.lock.Lock()
+	defer gps.lock.Unlock()
+
+	if gps.done == nil {
+		return
+	}
+
+	close(gps.done)
+	gps.done = nil
+
+	if gps.port != nil {
+		gps.port.Close()
+		gps.port = nil
+	}
 }
 
 // Start is used to start reading the GPS, and data will be sent back
 // through the handler
 func (gps *Gps) Start() {
-	gps.stop = false
+	gps.lock.Lock()
+	done := make(chan struct{})
+	gps.done = done
+	gps.lock.Unlock()
+
+	// wait returns false if the GPS is stopped during the delay
+	wait := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-done:
+			fmt.Println("Closing GPS")
+			return false
+		}
+	}
+
 	go func() {
 		options := serial.OpenOptions{
 			PortName:              gps.portName,
@@ -56,27 +86,35 @@ func (gps *Gps) Start() {
 			InterCharacterTimeout: 0,
 		}
 		for {
-			var err error
-			gps.port, err = serial.Open(options)
+			port, err := serial.Open(options)
 
 			if err != nil {
 				if gps.debug {
 					fmt.Println("failed to open port: ", options.PortName)
 				}
 				// delay a bit before trying to open port again
-				time.Sleep(10 * time.Second)
+				if !wait(10 * time.Second) {
+					return
+				}
 				continue
 			}
 
+			gps.lock.Lock()
+			select {
+			case <-done:
+				gps.lock.Unlock()
+				port.Close()
+				fmt.Println("Closing GPS")
+				return
+			default:
+			}
+			gps.port = port
+			gps.lock.Unlock()
+
 			fmt.Println("GPS port opened: ", options.PortName)
-			reader := bufio.NewReader(gps.port)
+			reader := bufio.NewReader(port)
 
 			for {
-				if gps.stop {
-					fmt.Println("Closing GPS")
-					return
-				}
-
 				line, err := reader.ReadString('\n')
 
 				if gps.debug {
@@ -99,7 +137,10 @@ func (gps *Gps) Start() {
 							NumSat: m.NumSatellites,
 						}
 
-						gps.c <- ret
+						select {
+						case gps.c <- ret:
+						case <-done:
+						}
 					}
 				} else {
 					if gps.debug {
@@ -108,14 +149,17 @@ func (gps *Gps) Start() {
 				}
 			}
 
-			gps.port.Close()
-			if gps.stop {
-				fmt.Println("Closing GPS")
-				return
+			gps.lock.Lock()
+			if gps.port == port {
+				port.Close()
+				gps.port = nil
 			}
+			gps.lock.Unlock()
 
 			// delay a bit before trying to open port again
-			time.Sleep(10 * time.Second)
+			if !wait(10 * time.Second) {
+				return
+			}
 		}
 	}()
 }
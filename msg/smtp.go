@@ -0,0 +1,154 @@
+package msg
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig describes how to connect to a SMTP server
+type SMTPConfig struct {
+	Host string
+	Port int
+	// StartTLS requires the connection to be upgraded to TLS before
+	// authenticating and sending the message
+	StartTLS bool
+	// Username and Password are used for PLAIN authentication if
+	// Username is set
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// SMTP can be used to send email through a SMTP server
+type SMTP struct {
+	config SMTPConfig
+}
+
+// NewSMTP creates a new SMTP messenger. Port defaults to 25, and Timeout
+// defaults to 30s.
+func NewSMTP(config SMTPConfig) *SMTP {
+	if config.Port == 0 {
+		config.Port = 25
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &SMTP{config: config}
+}
+
+// SendEmail sends an email message
+func (m *SMTP) SendEmail(to, subject, body string) error {
+	if m.config.Host == "" {
+		return errors.New("SMTP host not set")
+	}
+
+	if m.config.From == "" {
+		return errors.New("SMTP from address not set")
+	}
+
+	if to == "" {
+		return errors.New("email to address not set")
+	}
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+
+	conn, err := net.DialTimeout("tcp", addr, m.config.Timeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+
+	// bound the whole transaction, not just the dial
+	err = conn.SetDeadline(time.Now().Add(m.config.Timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP error: %w", err)
+	}
+	defer c.Close()
+
+	if m.config.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+
+		err := c.StartTLS(&tls.Config{ServerName: m.config.Host})
+		if err != nil {
+			return fmt.Errorf("SMTP STARTTLS error: %w", err)
+		}
+	}
+
+	if m.config.Username != "" {
+		// smtp.PlainAuth refuses to send credentials over an unencrypted
+		// connection unless the server is localhost
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		err := c.Auth(auth)
+		if err != nil {
+			return fmt.Errorf("SMTP auth error: %w", err)
+		}
+	}
+
+	err = c.Mail(m.config.From)
+	if err != nil {
+		return fmt.Errorf("SMTP from error: %w", err)
+	}
+
+	err = c.Rcpt(to)
+	if err != nil {
+		return fmt.Errorf("SMTP to error: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+
+	_, err = w.Write(formatEmail(m.config.From, to, subject, body))
+	if err != nil {
+		return fmt.Errorf("SMTP write error: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// formatEmail returns a plain text email with headers and CRLF line endings
+func formatEmail(from, to, subject, body string) []byte {
+	var b strings.Builder
+
+	header := func(k, v string) {
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+
+	header("From", from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	b.WriteString("\r\n")
+
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,161 @@
+package msg
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpSink is a minimal SMTP server that records the envelope and data
+// of each message it receives.
+type smtpSink struct {
+	ln       net.Listener
+	from     string
+	rcpt     []string
+	data     string
+	received chan struct{}
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting SMTP sink: ", err)
+	}
+
+	s := &smtpSink{ln: ln, received: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpSink) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(l string) {
+		_, _ = conn.Write([]byte(l + "\r\n"))
+	}
+
+	reply("220 localhost sink")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = append(s.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			close(s.received)
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSendEmail(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.ln.Close()
+
+	s := NewSMTP(SMTPConfig{
+		Host: "127.0.0.1",
+		Port: sink.port(),
+		From: "siot@example.com",
+	})
+
+	err := s.SendEmail("joe@example.com", "Motor overload", "line 1\nline 2")
+	if err != nil {
+		t.Fatal("Error sending email: ", err)
+	}
+
+	<-sink.received
+
+	if sink.from != "siot@example.com" {
+		t.Error("from is not correct: ", sink.from)
+	}
+
+	if len(sink.rcpt) != 1 || sink.rcpt[0] != "joe@example.com" {
+		t.Error("rcpt is not correct: ", sink.rcpt)
+	}
+
+	if !strings.Contains(sink.data, "Subject: Motor overload\r\n") {
+		t.Error("subject header missing: ", sink.data)
+	}
+
+	if !strings.Contains(sink.data, "\r\n\r\nline 1\r\nline 2\r\n") {
+		t.Error("body is not correct: ", sink.data)
+	}
+}
+
+func TestSMTPStartTLSNotSupported(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.ln.Close()
+
+	s := NewSMTP(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     sink.port(),
+		From:     "siot@example.com",
+		StartTLS: true,
+	})
+
+	err := s.SendEmail("joe@example.com", "test", "test")
+	if err == nil {
+		t.Fatal("expected an error when the server does not support STARTTLS")
+	}
+}
+
+func TestSMTPConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	s := NewSMTP(SMTPConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		From: "siot@example.com",
+	})
+
+	err = s.SendEmail("joe@example.com", "test", "test")
+	if err == nil {
+		t.Fatal("expected an error connecting to " + strconv.Itoa(port))
+	}
+}
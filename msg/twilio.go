@@ -2,6 +2,8 @@ package msg
 
 import (
 	"errors"
+	"net/http"
+	"time"
 
 	"github.com/kevinburke/twilio-go"
 )
@@ -12,11 +14,16 @@ type Twilio struct {
 	smsFrom      string
 }
 
+// twilioTimeout limits how long a request to Twilio can take. It is shorter
+// than the message service request timeout so errors are still reported.
+const twilioTimeout = 15 * time.Second
+
 // NewTwilio creates a new messenger object
 func NewTwilio(twilioSid, twilioAuth, smsFrom string) *Twilio {
 	return &Twilio{
-		twilioClient: twilio.NewClient(twilioSid, twilioAuth, nil),
-		smsFrom:      smsFrom,
+		twilioClient: twilio.NewClient(twilioSid, twilioAuth,
+			&http.Client{Timeout: twilioTimeout}),
+		smsFrom: smsFrom,
 	}
 }
 
@@ -0,0 +1,122 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Webhook can be used to POST data to a HTTP endpoint
+type Webhook struct {
+	url     string
+	headers map[string]string
+	tmpl    *template.Template
+	client  *http.Client
+}
+
+// WebhookStatusError is returned when the endpoint responds with a non
+// 2xx status code
+type WebhookStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *WebhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned status %v: %v", e.StatusCode, e.Body)
+}
+
+// Temporary returns true if the request may succeed if retried
+func (e *WebhookStatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout
+}
+
+// NewWebhook creates a new webhook. If bodyTemplate is blank, data is sent
+// as JSON, otherwise the body is rendered from the Go text/template. The
+// template has a json function that can be used to quote values, for example:
+// {"text": {{json .Message}}}. headers can be used to override the default
+// Content-Type of application/json or to add authentication headers.
+func NewWebhook(url string, headers map[string]string, bodyTemplate string,
+	timeout time.Duration) (*Webhook, error) {
+	if url == "" {
+		return nil, errors.New("webhook URL not set")
+	}
+
+	ret := &Webhook{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+
+	if bodyTemplate != "" {
+		funcs := template.FuncMap{
+			"json": func(v any) (string, error) {
+				d, err := json.Marshal(v)
+				return string(d), err
+			},
+		}
+
+		var err error
+		ret.tmpl, err = template.New("body").Funcs(funcs).Parse(bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing webhook template: %w", err)
+		}
+	}
+
+	return ret, nil
+}
+
+// Body returns the body that is sent for data
+func (w *Webhook) Body(data any) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(data)
+	}
+
+	var buf bytes.Buffer
+	err := w.tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering webhook template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Send POSTs data to the webhook URL
+func (w *Webhook) Send(data any) error {
+	body, err := w.Body(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// include the start of the body, as it often describes the error
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return &WebhookStatusError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+
+	// drain body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package msg
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type webhookTestData struct {
+	NodeID  string `json:"nodeID"`
+	Message string `json:"message"`
+}
+
+func TestWebhookJSON(t *testing.T) {
+	var body, contentType, auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		contentType = r.Header.Get("Content-Type")
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(srv.URL, map[string]string{"Authorization": "Bearer 123"}, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wh.Send(webhookTestData{NodeID: "abc", Message: "hi"})
+	if err != nil {
+		t.Fatal("Error sending webhook: ", err)
+	}
+
+	if body != `{"nodeID":"abc","message":"hi"}` {
+		t.Error("body is not correct: ", body)
+	}
+
+	if contentType != "application/json" {
+		t.Error("content type is not correct: ", contentType)
+	}
+
+	if auth != "Bearer 123" {
+		t.Error("auth header is not correct: ", auth)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	wh, err := NewWebhook("http://localhost", nil, `{"text": {{json .Message}}}`, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := wh.Body(webhookTestData{Message: `tank "A" low`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"text": "tank \"A\" low"}`
+	if string(body) != exp {
+		t.Errorf("body is not correct, exp %v, got %v", exp, string(body))
+	}
+}
+
+func TestWebhookStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(srv.URL, nil, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wh.Send(webhookTestData{})
+
+	var statusErr *WebhookStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatal("expected status error, got: ", err)
+	}
+
+	if statusErr.StatusCode != http.StatusUnauthorized {
+		t.Error("status code is not correct: ", statusErr.StatusCode)
+	}
+
+	if statusErr.Temporary() {
+		t.Error("unauthorized should not be temporary")
+	}
+}
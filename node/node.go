@@ -1,11 +1,9 @@
 package node
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"log"
-	"text/template"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -155,41 +153,3 @@ func (m *Manager) Start() error {
 func (m *Manager) Stop(_ error) {
 	close(m.chStop)
 }
-
-type nodeTemplateData struct {
-	ID          string
-	Description string
-	Ios         map[string]float64
-}
-
-func renderNotifyTemplate(node *data.Node, msgTemplate string) (string, error) {
-	// build map of IO values so they are easy to reference by type or ID in template
-	dtd := nodeTemplateData{
-		ID:          node.ID,
-		Description: node.Desc(),
-		Ios:         make(map[string]float64),
-	}
-
-	for _, io := range node.Points {
-		if io.Type != "" {
-			dtd.Ios[io.Type] = io.Value
-		}
-	}
-
-	buf := new(bytes.Buffer)
-
-	tmpl, err := template.New("msg").Parse(msgTemplate)
-
-	if err != nil {
-		return "", err
-	}
-
-	err = tmpl.Execute(buf, dtd)
-
-	if err != nil {
-		return "", err
-	}
-
-	return buf.String(), nil
-
-}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
 	"strconv"
+	"time"
 
 	"github.com/simpleiot/simpleiot/assets/files"
+	"github.com/simpleiot/simpleiot/store"
 	"github.com/simpleiot/simpleiot/system"
 )
 
@@ -29,11 +32,21 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 	flagNatsDisableServer := flags.Bool("natsDisableServer", false, "disable NATS server (if you want to run NATS separately)")
 	flagStore := flags.String("store", "siot.sqlite", "store file, default siot.sqlite")
 	flagResetStore := flags.Bool("resetStore", false, "permanently wipe data in store at start-up")
+	flagStoreMemory := flags.Bool("storeMemory", false, "keep the store in memory, all data is lost when SIOT stops")
 	flagAuthToken := flags.String("token", "", "auth token")
 	flagSyslog := flags.Bool("syslog", false, "log to syslog instead of stdout")
 	flagDev := flags.Bool("dev", false, "run server in development mode")
 	flagCustomUIDir := flags.String("customUIDir", "", "pass custom UI directory")
 	flagUIAssetsDebug := flags.Bool("UIAssetsDebug", false, "Dump asset files for debugging")
+	flagHistory := flags.String("history", "", "keep local point history for a retention period, ex: 30d or 30d,temp=7d")
+	flagHistoryDownsample := flags.Duration("historyDownsample", 0, "downsample local history older than this, ex: 24h")
+	flagHistoryWindow := flags.Duration("historyWindow", 5*time.Minute, "local history downsample window")
+	flagBackupPeriod := flags.Duration("backupPeriod", 0, "back up the store to the data dir periodically, ex: 24h")
+	flagBackupKeep := flags.Int("backupKeep", 7, "number of periodic store backups to keep")
+	flagTombstoneRetention := flags.Duration("tombstoneRetention", 0, "permanently remove deleted nodes and points after this time, ex: 2160h")
+	flagStoreBatchWindow := flags.Duration("storeBatchWindow", 0, "wait this long for more points before writing a batch to the store, ex: 5ms")
+	flagRuleExec := flags.Bool("ruleExec", false, "allow rule exec actions to run commands")
+	flagSecretKeyFile := flags.String("secretKeyFile", "", "file containing a base64 key used to encrypt secret points in the store")
 
 	if err := flags.Parse(args); err != nil {
 		return Options{}, err
@@ -150,10 +163,31 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 	// todo -- move this to a node
 	particleAPIKey := os.Getenv("SIOT_PARTICLE_API_KEY")
 
+	// the secret key is never stored in the data dir with the store
+	var secretKey []byte
+	secretKeyE := os.Getenv("SIOT_SECRET_KEY")
+	if *flagSecretKeyFile != "" {
+		secretKey, err = store.ReadSecretKey(*flagSecretKeyFile)
+		if err != nil {
+			return Options{}, err
+		}
+	} else if secretKeyE != "" {
+		secretKey, err = store.ParseSecretKey(secretKeyE)
+		if err != nil {
+			return Options{}, fmt.Errorf("Error parsing SIOT_SECRET_KEY: %w", err)
+		}
+	}
+
+	historyRetention, historyTypeRetention, err := store.ParseHistoryRetention(*flagHistory)
+	if err != nil {
+		return Options{}, err
+	}
+
 	// TODO, convert this to builder pattern
 	o := Options{
 		StoreFile:         storeFilePath,
 		ResetStore:        *flagResetStore,
+		StoreMemory:       *flagStoreMemory,
 		HTTPPort:          port,
 		DebugHTTP:         *flagDebugHTTP,
 		DebugLifecycle:    *flagDebugLifecycle,
@@ -171,6 +205,21 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 		Dev:               *flagDev,
 		CustomUIDir:       *flagCustomUIDir,
 		UIAssetsDebug:     *flagUIAssetsDebug,
+		History: store.HistoryParams{
+			Retention:        historyRetention,
+			TypeRetention:    historyTypeRetention,
+			DownsampleAge:    *flagHistoryDownsample,
+			DownsampleWindow: *flagHistoryWindow,
+		},
+		Backup: store.BackupParams{
+			Dir:    path.Join(dataDir, "backups"),
+			Period: *flagBackupPeriod,
+			Keep:   *flagBackupKeep,
+		},
+		TombstoneRetention: *flagTombstoneRetention,
+		SecretKey:          secretKey,
+		StoreBatchWindow:   *flagStoreBatchWindow,
+		RuleExec:           *flagRuleExec,
 	}
 
 	return o, nil
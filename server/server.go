@@ -30,6 +30,7 @@ var ErrServerStopped = errors.New("Server stopped")
 type Options struct {
 	StoreFile         string
 	ResetStore        bool
+	StoreMemory       bool
 	DataDir           string
 	HTTPPort          string
 	DebugHTTP         bool
@@ -51,6 +52,20 @@ type Options struct {
 	CustomUIDir       string
 	CustomUIFS        fs.FS
 	UIAssetsDebug     bool
+	// History configures local time-series history in the store
+	History store.HistoryParams
+	// Backup configures periodic backups of the store
+	Backup store.BackupParams
+	// TombstoneRetention is how long deleted nodes and points are kept in
+	// the store, 0 keeps them forever
+	TombstoneRetention time.Duration
+	// SecretKey encrypts secret points in the store, see store.Params
+	SecretKey []byte
+	// StoreBatchWindow is how long the store waits for more points before
+	// writing a batch, see store.Params
+	StoreBatchWindow time.Duration
+	// RuleExec allows rule exec actions to run commands
+	RuleExec bool
 	// optional ID (must be unique) for this instance, otherwise, a UUID will be used
 	ID string
 }
@@ -70,6 +85,8 @@ type Server struct {
 func NewServer(o Options) (*Server, *nats.Conn, error) {
 	chNatsClientClosed := make(chan struct{})
 
+	client.EnableRuleExec(o.RuleExec)
+
 	// start the server side nats client
 	nc, err := nats.Connect(o.NatsServer,
 		nats.Timeout(10*time.Second),
@@ -183,11 +200,23 @@ func (s *Server) Run() error {
 	// ====================================
 
 	storeParams := store.Params{
-		File:      o.StoreFile,
-		AuthToken: o.AuthToken,
-		Server:    o.NatsServer,
-		Nc:        s.nc,
-		ID:        s.options.ID,
+		File:               o.StoreFile,
+		AuthToken:          o.AuthToken,
+		Server:             o.NatsServer,
+		Nc:                 s.nc,
+		ID:                 s.options.ID,
+		History:            o.History,
+		Backup:             o.Backup,
+		TombstoneRetention: o.TombstoneRetention,
+		SecretKey:          o.SecretKey,
+		WriteBatchWindow:   o.StoreBatchWindow,
+	}
+
+	if o.StoreMemory {
+		storeParams.Backend, err = store.NewMemoryDb(s.options.ID)
+		if err != nil {
+			log.Fatal("Error creating memory store: ", err)
+		}
 	}
 
 	siotStore, err := store.NewStore(storeParams)
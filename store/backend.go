@@ -0,0 +1,121 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Backend is the database used by a Store. DbSqlite is the default backend,
+// and DbMemory keeps everything in memory. All backends must pass the
+// conformance tests in backend_test.go.
+type Backend interface {
+	// RootNodeID returns the ID of the instance root node
+	RootNodeID() string
+	// JWTKey returns the key used to sign auth tokens
+	JWTKey() []byte
+	// NodePoints writes node points and updates the hash of all upstream
+	// edges. Points older than the stored point are ignored.
+	NodePoints(id string, points data.Points) error
+	// EdgePoints writes edge points and updates the hash of all upstream
+	// edges. An edge is created if it does not exist, which requires a
+	// node type point.
+	EdgePoints(nodeID, parentID string, points data.Points) error
+	// GetNodes returns nodes with their edge points and hash. If parent is
+	// set to "all", then all instances of the node are returned. If parent
+	// is set and id is "all", then all child nodes are returned. Parent can
+	// be set to "root" and id to "all" to fetch the root node(s).
+	GetNodes(parent, id, typ string, includeDel bool) ([]data.NodeEdge, error)
+	// Up returns upstream ids for a node
+	Up(id string, includeDeleted bool) ([]string, error)
+	// UserCheck returns the user nodes that match email and password and
+	// have a path to the root node. Returns nil, nil if user is not found.
+	UserCheck(email, password string) (data.Nodes, error)
+	// VerifyNodeHashes verifies the hash of every node, and fixes the ones
+	// that are not correct if fix is set.
+	VerifyNodeHashes(fix bool) error
+	// Reset permanently wipes all data, and then initializes the root node
+	// with the same ID.
+	Reset() error
+	// Close the backend
+	Close() error
+}
+
+var errNotSupported = errors.New("not supported by the store backend")
+
+// backends can optionally support the following features
+
+type historyBackend interface {
+	historyEnabled() bool
+	historyQuery(query data.HistoryQuery) data.HistoryResults
+	historyMaint(now time.Time) (int64, error)
+}
+
+type backupBackend interface {
+	backupRotate(p BackupParams, now time.Time) (string, error)
+}
+
+type gcBackend interface {
+	gcTombstones(cutoff time.Time) (gcStats, error)
+}
+
+// batchBackend writes node points for multiple messages at once. Backends
+// that don't implement this get one NodePoints call per message.
+type batchBackend interface {
+	nodePointsBatch(writes []nodePointsWrite) []error
+}
+
+// nodePointsWrite is one node points message in a batch
+type nodePointsWrite struct {
+	id     string
+	points data.Points
+}
+
+// initRootNodes creates the root node and default admin user in a new
+// store. If rootID is blank, a UUID is used. The root node ID is returned.
+func initRootNodes(b Backend, rootID string) (string, error) {
+	log.Println("STORE: Initialize root node and admin user")
+
+	if rootID == "" {
+		rootID = uuid.New().String()
+	}
+
+	err := b.EdgePoints(rootID, "root", data.Points{
+		{Type: data.PointTypeTombstone, Value: 0},
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeDevice},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error sending root node edges: %w", err)
+	}
+
+	// create admin user off root node
+	admin := data.User{
+		ID:        uuid.New().String(),
+		FirstName: "admin",
+		LastName:  "user",
+		Email:     "admin@admin.com",
+		Pass:      "admin",
+	}
+
+	points := admin.ToPoints()
+
+	err = b.NodePoints(admin.ID, points)
+	if err != nil {
+		return "", fmt.Errorf("Error setting default user: %v", err)
+	}
+
+	err = b.EdgePoints(admin.ID, rootID, data.Points{
+		{Type: data.PointTypeTombstone, Value: 0},
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeUser},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return rootID, nil
+}
@@ -0,0 +1,418 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// The following tests are run against every store backend
+
+func TestBackendSqlite(t *testing.T) {
+	testBackend(t, func(t *testing.T) Backend {
+		return newTestDb(t)
+	})
+}
+
+func TestBackendMemory(t *testing.T) {
+	testBackend(t, func(t *testing.T) Backend {
+		db, err := NewMemoryDb("")
+		if err != nil {
+			t.Fatal("Error creating memory db: ", err)
+		}
+		return db
+	})
+}
+
+func testBackend(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db Backend)
+	}{
+		{"root", testBackendRoot},
+		{"nodePoints", testBackendNodePoints},
+		{"edgePoints", testBackendEdgePoints},
+		{"getNodes", testBackendGetNodes},
+		{"up", testBackendUp},
+		{"userCheck", testBackendUserCheck},
+		{"hash", testBackendHash},
+		{"reset", testBackendReset},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newBackend(t)
+			defer db.Close()
+			test.test(t, db)
+		})
+	}
+}
+
+// backendNode returns a single node
+func backendNode(t *testing.T, db Backend, parent, id string) data.NodeEdge {
+	t.Helper()
+
+	nodes, err := db.GetNodes(parent, id, "", true)
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 node for %v:%v, got %v", parent, id, len(nodes))
+	}
+
+	return nodes[0]
+}
+
+// backendCheckHashes checks the stored hash of every node in the tree
+func backendCheckHashes(t *testing.T, db Backend, node data.NodeEdge) {
+	t.Helper()
+
+	children, err := db.GetNodes(node.ID, "all", "", true)
+	if err != nil {
+		t.Fatal("Error getting children: ", err)
+	}
+
+	for _, c := range children {
+		backendCheckHashes(t, db, c)
+	}
+
+	if node.CalcHash(children) != node.Hash {
+		t.Errorf("Hash for %v is not correct", node.ID)
+	}
+}
+
+func backendAddNode(t *testing.T, db Backend, parent, id, typ string) {
+	t.Helper()
+
+	err := db.EdgePoints(id, parent, data.Points{
+		{Type: data.PointTypeTombstone},
+		{Type: data.PointTypeNodeType, Text: typ},
+	})
+	if err != nil {
+		t.Fatal("Error adding node: ", err)
+	}
+}
+
+func testBackendRoot(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+	if rootID == "" {
+		t.Fatal("Root ID not set")
+	}
+
+	if len(db.JWTKey()) == 0 {
+		t.Fatal("JWT key not set")
+	}
+
+	root := backendNode(t, db, "root", "all")
+	if root.ID != rootID || root.Type != data.NodeTypeDevice {
+		t.Fatal("Root node is not correct: ", root)
+	}
+
+	users, err := db.GetNodes(rootID, "all", data.NodeTypeUser, false)
+	if err != nil || len(users) != 1 {
+		t.Fatal("Admin user not found: ", err)
+	}
+
+	err = db.EdgePoints(rootID, "root", data.Points{
+		{Type: data.PointTypeTombstone, Value: 1},
+	})
+	if err == nil {
+		t.Fatal("Should not be able to delete root node")
+	}
+}
+
+func testBackendNodePoints(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+	now := time.Now()
+
+	err := db.NodePoints(rootID, data.Points{
+		{Time: now, Type: data.PointTypeDescription, Text: "root"},
+		{Time: now, Type: data.PointTypeValue, Key: "1", Value: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// older point is ignored
+	err = db.NodePoints(rootID, data.Points{
+		{Time: now.Add(-time.Second), Type: data.PointTypeDescription, Text: "old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := backendNode(t, db, "all", rootID)
+
+	if root.Desc() != "root" {
+		t.Error("Older point should be ignored: ", root.Desc())
+	}
+
+	// blank key is stored as "0"
+	p, ok := root.Points.Find(data.PointTypeDescription, "0")
+	if !ok || p.Key != "0" {
+		t.Error("Point key is not correct: ", p)
+	}
+
+	v, ok := root.Points.Value(data.PointTypeValue, "1")
+	if !ok || v != 1 {
+		t.Error("Array point is not correct: ", v)
+	}
+
+	// newer point replaces the stored point
+	err = db.NodePoints(rootID, data.Points{
+		{Time: now.Add(time.Second), Type: data.PointTypeDescription, Text: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root = backendNode(t, db, "all", rootID)
+
+	if root.Desc() != "new" {
+		t.Error("Newer point should be written: ", root.Desc())
+	}
+}
+
+func testBackendEdgePoints(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+
+	err := db.EdgePoints("group", rootID, data.Points{{Type: data.PointTypeTombstone}})
+	if err == nil {
+		t.Fatal("New edge without node type should fail")
+	}
+
+	err = db.EdgePoints("group", "group", data.Points{
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeGroup}})
+	if err == nil {
+		t.Fatal("Edge to itself should fail")
+	}
+
+	backendAddNode(t, db, rootID, "group", data.NodeTypeGroup)
+
+	n := backendNode(t, db, rootID, "group")
+	if n.Type != data.NodeTypeGroup || n.Parent != rootID {
+		t.Fatal("Node is not correct: ", n)
+	}
+
+	if _, ok := n.EdgePoints.Find(data.PointTypeNodeType, ""); ok {
+		t.Error("Node type point should not be stored")
+	}
+
+	// delete the node
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n = backendNode(t, db, rootID, "group")
+	if ts, _ := n.IsTombstone(); !ts {
+		t.Error("Node should be deleted")
+	}
+}
+
+func testBackendGetNodes(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+
+	backendAddNode(t, db, rootID, "group1", data.NodeTypeGroup)
+	backendAddNode(t, db, rootID, "group2", data.NodeTypeGroup)
+	backendAddNode(t, db, "group1", "var", data.NodeTypeVariable)
+	// mirror the variable in group2
+	backendAddNode(t, db, "group2", "var", data.NodeTypeVariable)
+
+	err := db.NodePoints("var", data.Points{{Type: data.PointTypeValue, Value: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.EdgePoints("group2", rootID, data.Points{
+		{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetNodes("", "all", "", false)
+	if err == nil {
+		t.Error("Blank parent should return an error")
+	}
+
+	_, err = db.GetNodes("all", "all", "", false)
+	if err == nil {
+		t.Error("Parent and ID both all should return an error")
+	}
+
+	for _, test := range []struct {
+		parent     string
+		id         string
+		typ        string
+		includeDel bool
+		count      int
+	}{
+		{rootID, "all", "", false, 2},
+		{rootID, "all", "", true, 3},
+		{rootID, "all", data.NodeTypeGroup, false, 1},
+		{rootID, "", data.NodeTypeGroup, true, 2},
+		{"all", "var", "", false, 2},
+		{"group1", "var", "", false, 1},
+		{"group2", "var", "", false, 1},
+		{"group1", "bogus", "", false, 0},
+		{"all", "bogus", "", false, 0},
+	} {
+		nodes, err := db.GetNodes(test.parent, test.id, test.typ, test.includeDel)
+		if err != nil {
+			t.Fatal("Error getting nodes: ", err)
+		}
+
+		if len(nodes) != test.count {
+			t.Errorf("GetNodes(%v, %v, %v, %v) returned %v nodes, expected %v",
+				test.parent, test.id, test.typ, test.includeDel,
+				len(nodes), test.count)
+		}
+	}
+
+	n := backendNode(t, db, "group1", "var")
+	if v, _ := n.Points.Value(data.PointTypeValue, ""); v != 3 {
+		t.Error("Node points not returned")
+	}
+}
+
+func testBackendUp(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+
+	backendAddNode(t, db, rootID, "group1", data.NodeTypeGroup)
+	backendAddNode(t, db, rootID, "group2", data.NodeTypeGroup)
+	backendAddNode(t, db, "group1", "var", data.NodeTypeVariable)
+	backendAddNode(t, db, "group2", "var", data.NodeTypeVariable)
+
+	err := db.EdgePoints("var", "group2", data.Points{
+		{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ups, err := db.Up("var", false)
+	if err != nil || len(ups) != 1 || ups[0] != "group1" {
+		t.Error("Up is not correct: ", ups, err)
+	}
+
+	ups, err = db.Up("var", true)
+	if err != nil || len(ups) != 2 {
+		t.Error("Up with deleted is not correct: ", ups, err)
+	}
+
+	ups, err = db.Up(rootID, false)
+	if err != nil || len(ups) != 1 || ups[0] != "root" {
+		t.Error("Up for root is not correct: ", ups, err)
+	}
+}
+
+func testBackendUserCheck(t *testing.T, db Backend) {
+	nodes, err := db.UserCheck("admin@admin.com", "admin")
+	if err != nil || len(nodes) != 1 {
+		t.Fatal("Admin user check failed: ", err)
+	}
+
+	pass, _ := nodes[0].Points.Text(data.PointTypePass, "")
+	if !data.IsPasswordHash(pass) {
+		t.Error("Password is not hashed")
+	}
+
+	nodes, err = db.UserCheck("admin@admin.com", "wrong")
+	if err != nil || len(nodes) != 0 {
+		t.Fatal("Wrong password should not match: ", err)
+	}
+
+	// users in a deleted group can't log in
+	rootID := db.RootNodeID()
+	backendAddNode(t, db, rootID, "group", data.NodeTypeGroup)
+	backendAddNode(t, db, "group", "user", data.NodeTypeUser)
+
+	err = db.NodePoints("user", data.Points{
+		{Type: data.PointTypeEmail, Text: "user@test.com"},
+		{Type: data.PointTypePass, Text: "pass"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err = db.UserCheck("user@test.com", "pass")
+	if err != nil || len(nodes) != 1 {
+		t.Fatal("User check failed: ", err)
+	}
+
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err = db.UserCheck("user@test.com", "pass")
+	if err != nil || len(nodes) != 0 {
+		t.Fatal("User in deleted group should not match: ", err)
+	}
+}
+
+func testBackendHash(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+
+	backendAddNode(t, db, rootID, "group", data.NodeTypeGroup)
+	backendAddNode(t, db, "group", "var", data.NodeTypeVariable)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		err := db.NodePoints("var", data.Points{{Time: now.Add(time.Duration(i) * time.Second),
+			Type: data.PointTypeValue, Value: float64(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := backendNode(t, db, "root", "all")
+	backendCheckHashes(t, db, root)
+
+	// deleting a node changes the root hash
+	err := db.EdgePoints("var", "group", data.Points{
+		{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root2 := backendNode(t, db, "root", "all")
+	if root2.Hash == root.Hash {
+		t.Error("Root hash did not change")
+	}
+
+	backendCheckHashes(t, db, root2)
+
+	err = db.VerifyNodeHashes(false)
+	if err != nil {
+		t.Error("Verify failed: ", err)
+	}
+}
+
+func testBackendReset(t *testing.T, db Backend) {
+	rootID := db.RootNodeID()
+
+	backendAddNode(t, db, rootID, "group", data.NodeTypeGroup)
+
+	err := db.Reset()
+	if err != nil {
+		t.Fatal("Reset failed: ", err)
+	}
+
+	if db.RootNodeID() != rootID {
+		t.Fatal("Root ID should not change on reset")
+	}
+
+	nodes, err := db.GetNodes(rootID, "all", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the admin user is left
+	if len(nodes) != 1 || nodes[0].Type != data.NodeTypeUser {
+		t.Fatal("Reset did not remove nodes")
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupPrefix and backupSuffix are used to name periodic backups
+const (
+	backupPrefix = "siot-"
+	backupSuffix = ".sqlite"
+)
+
+// BackupParams configures periodic store backups
+type BackupParams struct {
+	// Dir is where periodic backups are written
+	Dir string
+	// Period between backups. Periodic backups are disabled if 0.
+	Period time.Duration
+	// Keep is the number of periodic backups to keep
+	Keep int
+}
+
+// Backup writes a consistent snapshot of the store in dbFile to file. This
+// can be done while SIOT is running.
+func Backup(dbFile, file string) error {
+	_, err := os.Stat(dbFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite",
+		fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(8000)", dbFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return vacuumInto(db, file)
+}
+
+// vacuumInto writes a snapshot of db to file. The snapshot is written to a
+// temp file first so that file is never left half written.
+func vacuumInto(db *sql.DB, file string) error {
+	if file == "" {
+		return errors.New("backup file not specified")
+	}
+
+	tmp := file + ".tmp"
+	err := os.Remove(tmp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	_, err = db.Exec("VACUUM INTO ?", tmp)
+	if err != nil {
+		return fmt.Errorf("Error writing backup: %w", err)
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// backupRotate writes a backup to the backup dir and removes the oldest
+// backups so that only p.Keep backups remain. The name of the new backup
+// is returned.
+func (sdb *DbSqlite) backupRotate(p BackupParams, now time.Time) (string, error) {
+	err := os.MkdirAll(p.Dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(p.Dir, backupPrefix+now.UTC().Format("20060102T150405Z")+backupSuffix)
+
+	err = vacuumInto(sdb.db, file)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return file, err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		n := e.Name()
+		if !e.IsDir() && strings.HasPrefix(n, backupPrefix) && strings.HasSuffix(n, backupSuffix) {
+			backups = append(backups, n)
+		}
+	}
+
+	// names contain the time, so they sort oldest first
+	sort.Strings(backups)
+
+	for len(backups) > p.Keep && p.Keep > 0 {
+		err := os.Remove(filepath.Join(p.Dir, backups[0]))
+		if err != nil {
+			log.Println("Error removing old backup:", err)
+		}
+		backups = backups[1:]
+	}
+
+	return file, nil
+}
+
+// CheckBackup verifies a backup file is a valid SIOT store
+func CheckBackup(file string) error {
+	_, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", file))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	err = db.QueryRow("PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return fmt.Errorf("Error checking backup: %w", err)
+	}
+
+	if result != "ok" {
+		return fmt.Errorf("backup integrity check failed: %v", result)
+	}
+
+	var rootID string
+	err = db.QueryRow("SELECT root_id FROM meta WHERE id = 0").Scan(&rootID)
+	if err != nil {
+		return fmt.Errorf("backup is not a SIOT store: %w", err)
+	}
+
+	if rootID == "" {
+		return errors.New("backup does not have a root node")
+	}
+
+	return nil
+}
+
+// Restore replaces the store in dbFile with a backup. SIOT must not be
+// running when this is done, and an error is returned if the store is open.
+func Restore(backupFile, dbFile string) error {
+	lock, err := lockStore(dbFile)
+	if err != nil {
+		return fmt.Errorf("can't restore, SIOT must be stopped: %w", err)
+	}
+	defer lock.unlock()
+
+	err = CheckBackup(backupFile)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(backupFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := dbFile + ".restore"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	// the WAL files of the old store must not be applied to the backup
+	for _, ext := range []string{"-wal", "-shm"} {
+		err := os.Remove(dbFile + ext)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(tmp, dbFile)
+}
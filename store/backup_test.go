@@ -0,0 +1,116 @@
+package store
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestDbSqliteBackupRestore(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	backupFile := "test-backup.sqlite"
+	restoreFile := "test-restore.sqlite"
+	defer func() {
+		_ = exec.Command("sh", "-c", "rm "+backupFile+"* "+restoreFile+"*").Run()
+	}()
+
+	rootID := db.RootNodeID()
+
+	err := db.NodePoints(rootID, data.Points{{Time: time.Now(),
+		Type: data.PointTypeDescription, Text: "backup"}})
+	if err != nil {
+		t.Fatal("Error writing point: ", err)
+	}
+
+	// back up the store file while it is open
+	err = Backup(testFile, backupFile)
+	if err != nil {
+		t.Fatal("Error backing up: ", err)
+	}
+
+	err = CheckBackup(backupFile)
+	if err != nil {
+		t.Fatal("Backup check failed: ", err)
+	}
+
+	// restore over an existing store
+	dbR, err := NewSqliteDb(restoreFile, "", nil)
+	if err != nil {
+		t.Fatal("Error opening store: ", err)
+	}
+
+	err = Restore(backupFile, restoreFile)
+	if err == nil {
+		t.Fatal("Expected error restoring over an open store")
+	}
+
+	dbR.Close()
+
+	err = Restore(backupFile, restoreFile)
+	if err != nil {
+		t.Fatal("Error restoring: ", err)
+	}
+
+	dbR, err = NewSqliteDb(restoreFile, "", nil)
+	if err != nil {
+		t.Fatal("Error opening restored store: ", err)
+	}
+	defer dbR.Close()
+
+	if dbR.RootNodeID() != rootID {
+		t.Fatal("Restored root ID is not correct")
+	}
+
+	nodes, err := dbR.getNodes(nil, "all", rootID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting restored root node: ", err)
+	}
+
+	if nodes[0].Desc() != "backup" {
+		t.Error("Restored point not found")
+	}
+
+	err = CheckBackup(testFile + "-missing")
+	if err == nil {
+		t.Error("Expected error checking missing backup")
+	}
+}
+
+func TestDbSqliteBackupRotate(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	dir := "test-backups"
+	defer os.RemoveAll(dir)
+
+	p := BackupParams{Dir: dir, Keep: 2}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		_, err := db.backupRotate(p, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal("Error backing up: ", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Error reading backup dir: ", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatal("Expected 2 backups, got: ", len(entries))
+	}
+
+	// the oldest backup is removed
+	_, err = os.Stat(path.Join(dir, "siot-20240101T000000Z.sqlite"))
+	if err == nil {
+		t.Error("Oldest backup was not removed")
+	}
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Write batching
+//
+// Node and edge point messages are queued by the NATS handlers and written
+// by a single writer goroutine. While a batch is being written, new messages
+// queue up and are written together in the next batch, so at high point
+// rates many messages share one transaction and one hash update for each
+// upstream edge. Messages are acked after the batch is written, so an ack
+// still means the points are in the store.
+
+// writeQueueSize is the number of point messages that can be queued before
+// the NATS handlers block
+var writeQueueSize = 1000
+
+// maxWriteBatch is the maximum number of point messages written in a batch
+var maxWriteBatch = 500
+
+var errStoreStopped = errors.New("store stopped")
+
+// pointsWrite is a node or edge points message waiting to be written
+type pointsWrite struct {
+	msg      *nats.Msg
+	start    time.Time
+	nodeID   string
+	parentID string // only set for edge points
+	points   data.Points
+	err      error
+}
+
+// queueWrite queues a points message for the writer
+func (st *Store) queueWrite(w *pointsWrite) {
+	// the read lock is held while the message is queued so the writer
+	// can't do its final drain until the message is in the queue
+	st.writeIntake.RLock()
+	defer st.writeIntake.RUnlock()
+
+	if st.writeIntakeClosed {
+		st.reply(w.msg.Reply, errStoreStopped)
+		return
+	}
+
+	select {
+	case st.chWrite <- w:
+	case <-st.chStop:
+		st.reply(w.msg.Reply, errStoreStopped)
+	}
+}
+
+// writer writes queued points messages in batches until the store is stopped
+func (st *Store) writer() {
+	defer close(st.chWriteDone)
+
+	for {
+		select {
+		case w := <-st.chWrite:
+			st.writeBatch(st.collectBatch(w))
+		case <-st.chStop:
+			// stop accepting messages, then write anything that is
+			// still queued. Handlers blocked on a full queue give up
+			// when chStop is closed, so this does not block for long.
+			st.writeIntake.Lock()
+			st.writeIntakeClosed = true
+			st.writeIntake.Unlock()
+
+			for {
+				select {
+				case w := <-st.chWrite:
+					st.writeBatch(st.collectBatch(w))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// collectBatch returns a batch that starts with w. Messages that are already
+// queued are added to the batch, and if WriteBatchWindow is set, messages
+// that arrive during the window.
+func (st *Store) collectBatch(w *pointsWrite) []*pointsWrite {
+	batch := []*pointsWrite{w}
+
+	if st.params.WriteBatchWindow <= 0 {
+		for len(batch) < maxWriteBatch {
+			select {
+			case w := <-st.chWrite:
+				batch = append(batch, w)
+			default:
+				return batch
+			}
+		}
+
+		return batch
+	}
+
+	timer := time.NewTimer(st.params.WriteBatchWindow)
+	defer timer.Stop()
+
+	for len(batch) < maxWriteBatch {
+		select {
+		case w := <-st.chWrite:
+			batch = append(batch, w)
+		case <-timer.C:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// writeBatch writes a batch of points messages. Then the points are
+// processed in upstream nodes and each message is acked in the order
+// received.
+func (st *Store) writeBatch(batch []*pointsWrite) {
+	// consecutive node points messages are written together. Edge points
+	// are written one at a time between them so writes are still done in
+	// the order received.
+	var nodeWrites []*pointsWrite
+
+	for _, w := range batch {
+		if w.parentID == "" {
+			nodeWrites = append(nodeWrites, w)
+			continue
+		}
+
+		st.writeNodePoints(nodeWrites)
+		nodeWrites = nil
+
+		// Its important that we write to the DB before sending points
+		// upstream, or clients may do a rescan and not see the node is
+		// deleted.
+		w.err = st.db.EdgePoints(w.nodeID, w.parentID, w.points)
+	}
+
+	st.writeNodePoints(nodeWrites)
+
+	for _, w := range batch {
+		metric := st.metricCycleNodePoint
+
+		if w.parentID == "" {
+			if w.err != nil {
+				// TODO track error stats
+				log.Printf("Error writing nodeID (%v) to Db: %v", w.nodeID, w.err)
+				log.Println("msg subject:", w.msg.Subject)
+			} else {
+				err := st.processPointsUpstream(w.nodeID, w.nodeID, w.points)
+				if err != nil {
+					// TODO track error stats
+					log.Println("Error processing point in upstream nodes:", err)
+				}
+			}
+		} else {
+			metric = st.metricCycleNodeEdgePoint
+
+			if w.err != nil {
+				// TODO track error stats
+				log.Printf("Error writing edge points (%v:%v) to Db: %v",
+					w.nodeID, w.parentID, w.err)
+			} else {
+				err := st.processEdgePointsUpstream(w.nodeID, w.nodeID, w.parentID, w.points)
+				if err != nil {
+					// TODO track error stats
+					log.Println("Error processing point in upstream nodes:", err)
+				}
+			}
+		}
+
+		st.reply(w.msg.Reply, w.err)
+
+		err := metric.AddSample(float64(time.Since(w.start).Milliseconds()))
+		if err != nil {
+			log.Println("Error adding metric sample:", err)
+		}
+	}
+}
+
+// writeNodePoints writes node points messages with a single backend call if
+// the backend supports batches
+func (st *Store) writeNodePoints(writes []*pointsWrite) {
+	if len(writes) < 1 {
+		return
+	}
+
+	b, ok := st.db.(batchBackend)
+	if !ok {
+		for _, w := range writes {
+			w.err = st.db.NodePoints(w.nodeID, w.points)
+		}
+		return
+	}
+
+	batch := make([]nodePointsWrite, len(writes))
+	for i, w := range writes {
+		batch[i] = nodePointsWrite{id: w.nodeID, points: w.points}
+	}
+
+	errs := b.nodePointsBatch(batch)
+
+	for i, w := range writes {
+		w.err = errs[i]
+	}
+}
@@ -0,0 +1,406 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Tombstone garbage collection
+//
+// Deleted edges and points are purged after a retention period. Purging
+// must not change node hashes, otherwise this instance would never converge
+// with upstream instances that still have the tombstones (or purged them at
+// a different time). So the hash contribution of everything purged from an
+// owner is folded into a single purged record for that owner, which stays in
+// the hashes of the edges above it. The record also holds the newest
+// tombstone time, and writes not newer than that which don't match a stored
+// point or edge are ignored, so an old copy can't bring a purged item back.
+
+// kinds of purged items. The owner of a purged edge is its parent node,
+// the owner of a node point is the node, and the owner of an edge point is
+// the edge.
+const (
+	purgedEdge      = "edge"
+	purgedNodePoint = "nodePoint"
+	purgedEdgePoint = "edgePoint"
+)
+
+type purged struct {
+	kind  string
+	owner string
+	// time of the newest purged tombstone
+	time time.Time
+	hash uint32
+	// secret is the part of hash from secret points
+	secret uint32
+}
+
+// hashUpdate returns the hash contribution of the purged items
+func (p purged) hashUpdate() hashUpdate {
+	return hashUpdate{hash: p.hash, secret: p.secret}
+}
+
+// add folds the hash and time of a purged item into the record
+func (p *purged) add(t time.Time, update hashUpdate) {
+	if t.After(p.time) {
+		p.time = t
+	}
+	p.hash ^= update.hash
+	p.secret ^= update.secret
+}
+
+// gcStats are the counts of items removed by a garbage collection pass
+type gcStats struct {
+	edges  int64
+	points int64
+}
+
+func (sdb *DbSqlite) initPurged() error {
+	// there is one purged record for each kind of item and owner
+	_, err := sdb.db.Exec(`CREATE TABLE IF NOT EXISTS purged (kind TEXT,
+				owner TEXT,
+				time INT,
+				hash INT,
+				secret_hash INT DEFAULT 0,
+				UNIQUE(owner, kind))`)
+	if err != nil {
+		return fmt.Errorf("Error creating purged table: %v", err)
+	}
+
+	return nil
+}
+
+// getPurged returns the purged record of an owner. false is returned if
+// nothing has been purged from the owner.
+func (sdb *DbSqlite) getPurged(tx *sql.Tx, kind, owner string) (purged, bool, error) {
+	p := purged{kind: kind, owner: owner}
+	var timeNS int64
+	err := tx.QueryRow(`SELECT time, hash, secret_hash FROM purged
+		WHERE owner = ? AND kind = ?`, owner, kind).Scan(&timeNS, &p.hash, &p.secret)
+	if err == sql.ErrNoRows {
+		return p, false, nil
+	}
+	if err != nil {
+		return p, false, err
+	}
+
+	p.time = time.Unix(0, timeNS)
+	return p, true, nil
+}
+
+func writePurged(tx *sql.Tx, p purged) error {
+	_, err := tx.Exec(`INSERT INTO purged(kind, owner, time, hash, secret_hash)
+		VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(owner, kind) DO UPDATE SET
+		time = ?3,
+		hash = ?4,
+		secret_hash = ?5`, p.kind, p.owner, p.time.UnixNano(), p.hash, p.secret)
+	return err
+}
+
+// addPurged folds the hash of a purged item into the record of its owner
+func (sdb *DbSqlite) addPurged(tx *sql.Tx, kind, owner string, t time.Time,
+	update hashUpdate) error {
+	p, _, err := sdb.getPurged(tx, kind, owner)
+	if err != nil {
+		return err
+	}
+
+	p.add(t, update)
+	return writePurged(tx, p)
+}
+
+// purgedHash returns the hash of the items purged from a node, its child
+// edges, and the edge to its parent.
+func (sdb *DbSqlite) purgedHash(parent, id string) (hashUpdate, error) {
+	rows, err := sdb.db.Query(`SELECT hash, secret_hash FROM purged
+		WHERE (owner = ?1 AND kind IN (?3, ?4)) OR (kind = ?5 AND owner IN
+		(SELECT id FROM edges WHERE up = ?2 AND down = ?1))`,
+		id, parent, purgedEdge, purgedNodePoint, purgedEdgePoint)
+	if err != nil {
+		return hashUpdate{}, err
+	}
+	defer rows.Close()
+
+	var ret hashUpdate
+
+	for rows.Next() {
+		var hash hashUpdate
+		err := rows.Scan(&hash.hash, &hash.secret)
+		if err != nil {
+			return hashUpdate{}, err
+		}
+		ret.add(hash)
+	}
+
+	return ret, rows.Close()
+}
+
+// gcTombstones permanently removes deleted edges and points that were
+// deleted before cutoff. Deleted edges are only removed if nothing below
+// them has changed since cutoff. Nodes that no longer have any edges are
+// removed along with their children.
+func (sdb *DbSqlite) gcTombstones(cutoff time.Time) (gcStats, error) {
+	var stats gcStats
+
+	sdb.writeLock.Lock()
+	defer sdb.writeLock.Unlock()
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return stats, err
+	}
+
+	rollback := func() {
+		rbErr := tx.Rollback()
+		if rbErr != nil {
+			log.Println("Rollback error:", rbErr)
+		}
+	}
+
+	cutoffNS := cutoff.UnixNano()
+
+	// deleted edges
+	rows, err := tx.Query(`SELECT edges.id, edges.up, edges.down, edges.hash, edges.secret_hash,
+		edge_points.time
+		FROM edges JOIN edge_points ON edge_points.edge_id = edges.id
+		WHERE edge_points.type = ? AND edge_points.value != 0 AND edge_points.time < ?`,
+		data.PointTypeTombstone, cutoffNS)
+	if err != nil {
+		rollback()
+		return stats, err
+	}
+	defer rows.Close()
+
+	var deleted []data.Edge
+	var deletedTimes []time.Time
+
+	for rows.Next() {
+		var e data.Edge
+		var timeNS int64
+		err := rows.Scan(&e.ID, &e.Up, &e.Down, &e.Hash, &e.SecretHash, &timeNS)
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+		deleted = append(deleted, e)
+		deletedTimes = append(deletedTimes, time.Unix(0, timeNS))
+	}
+
+	if err := rows.Close(); err != nil {
+		rollback()
+		return stats, err
+	}
+
+	for i, e := range deleted {
+		// edge may have already been removed with a parent
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM edges WHERE id = ?`, e.ID).Scan(&count)
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		// don't remove anything that is still being written to
+		err = tx.QueryRow(`WITH RECURSIVE sub(id) AS
+			(SELECT ?1 UNION SELECT edges.down FROM edges JOIN sub ON edges.up = sub.id)
+			SELECT (SELECT COUNT(*) FROM node_points WHERE node_id IN sub AND time >= ?2) +
+			(SELECT COUNT(*) FROM edge_points WHERE time >= ?2 AND edge_id IN
+				(SELECT id FROM edges WHERE up IN sub OR id = ?3))`,
+			e.Down, cutoffNS, e.ID).Scan(&count)
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		err = sdb.addPurged(tx, purgedEdge, e.Up, deletedTimes[i],
+			hashUpdate{hash: e.Hash, secret: e.SecretHash})
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+
+		err = gcEdge(tx, e.ID, e.Down, &stats)
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+	}
+
+	// deleted points
+	for _, t := range []struct {
+		table string
+		owner string
+		kind  string
+	}{
+		{"node_points", "node_id", purgedNodePoint},
+		{"edge_points", "edge_id", purgedEdgePoint},
+	} {
+		rows, err := tx.Query(`SELECT id, `+t.owner+`, type, key, time, value, text
+			FROM `+t.table+` WHERE tombstone % 2 = 1 AND time < ?`, cutoffNS)
+		if err != nil {
+			rollback()
+			return stats, err
+		}
+		defer rows.Close()
+
+		var ids []string
+		// purged records by owner
+		var owners []string
+		items := make(map[string]*purged)
+
+		for rows.Next() {
+			var id, owner string
+			var p data.Point
+			var timeNS int64
+			err := rows.Scan(&id, &owner, &p.Type, &p.Key, &timeNS, &p.Value, &p.Text)
+			if err != nil {
+				rollback()
+				return stats, err
+			}
+			err = sdb.decryptPoint(&p)
+			if err != nil {
+				rollback()
+				return stats, err
+			}
+			p.Time = time.Unix(0, timeNS)
+
+			item, ok := items[owner]
+			if !ok {
+				item = &purged{}
+				items[owner] = item
+				owners = append(owners, owner)
+			}
+
+			var update hashUpdate
+			update.point(p)
+			item.add(p.Time, update)
+			ids = append(ids, id)
+		}
+
+		if err := rows.Close(); err != nil {
+			rollback()
+			return stats, err
+		}
+
+		for _, owner := range owners {
+			item := items[owner]
+			err := sdb.addPurged(tx, t.kind, owner, item.time, item.hashUpdate())
+			if err != nil {
+				rollback()
+				return stats, err
+			}
+		}
+
+		for _, id := range ids {
+			_, err := tx.Exec(`DELETE FROM `+t.table+` WHERE id = ?`, id)
+			if err != nil {
+				rollback()
+				return stats, err
+			}
+
+			stats.points++
+		}
+	}
+
+	return stats, tx.Commit()
+}
+
+// gcEdge removes an edge and its points. If the node below the edge does
+// not have any other edges, the node is removed as well. Purged records
+// owned by removed edges and nodes are removed too, as their hash is
+// already in the hash of the removed edge.
+func gcEdge(tx *sql.Tx, edgeID, nodeID string, stats *gcStats) error {
+	res, err := tx.Exec(`DELETE FROM edge_points WHERE edge_id = ?`, edgeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM purged WHERE owner = ? AND kind = ?`,
+		edgeID, purgedEdgePoint)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	stats.points += count
+
+	_, err = tx.Exec(`DELETE FROM edges WHERE id = ?`, edgeID)
+	if err != nil {
+		return err
+	}
+	stats.edges++
+
+	var edgeCount int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM edges WHERE down = ?`, nodeID).Scan(&edgeCount)
+	if err != nil {
+		return err
+	}
+
+	if edgeCount > 0 {
+		// node is still in the tree somewhere else
+		return nil
+	}
+
+	res, err = tx.Exec(`DELETE FROM node_points WHERE node_id = ?`, nodeID)
+	if err != nil {
+		return err
+	}
+
+	count, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	stats.points += count
+
+	_, err = tx.Exec(`DELETE FROM purged WHERE owner = ? AND kind IN (?, ?)`,
+		nodeID, purgedNodePoint, purgedEdge)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, down FROM edges WHERE up = ?`, nodeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var children [][2]string
+
+	for rows.Next() {
+		var c [2]string
+		err := rows.Scan(&c[0], &c[1])
+		if err != nil {
+			return err
+		}
+		children = append(children, c)
+	}
+
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		err := gcEdge(tx, c[0], c[1], stats)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
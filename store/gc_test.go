@@ -0,0 +1,344 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// rootHash returns the stored hash of the root node and checks that it
+// matches the calculated hash
+func rootHash(t *testing.T, db *DbSqlite) uint32 {
+	t.Helper()
+
+	roots, err := db.getNodes(nil, "root", "all", "", true)
+	if err != nil || len(roots) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	root := roots[0]
+
+	children, err := db.getNodes(nil, root.ID, "all", "", true)
+	if err != nil {
+		t.Fatal("Error getting children: ", err)
+	}
+
+	purgedHash, err := db.purgedHash(root.Parent, root.ID)
+	if err != nil {
+		t.Fatal("Error getting purged hash: ", err)
+	}
+
+	if root.CalcHash(children)^purgedHash.hash != root.Hash {
+		t.Fatal("Root hash is not correct")
+	}
+
+	if root.CalcSecretHash(children)^purgedHash.secret != root.SecretHash {
+		t.Fatal("Root secret hash is not correct")
+	}
+
+	return root.Hash
+}
+
+func TestDbSqliteGCTombstones(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+	old := time.Now().Add(-72 * time.Hour)
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	// group with a child variable, deleted a long time ago
+	err := db.NodePoints("group", data.Points{{Time: old,
+		Type: data.PointTypeDescription, Text: "group"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: old, Type: data.PointTypeTombstone},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.NodePoints("var", data.Points{{Time: old,
+		Type: data.PointTypeValue, Value: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.EdgePoints("var", "group", data.Points{
+		{Time: old, Type: data.PointTypeTombstone},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tombstoneTime := old.Add(time.Hour)
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: tombstoneTime, Type: data.PointTypeTombstone, Value: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deleted array point on the root node
+	deletedPoint := data.Point{Time: old, Type: data.PointTypeValue, Key: "1",
+		Value: 5, Tombstone: 1}
+	err = db.NodePoints(rootID, data.Points{deletedPoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := rootHash(t, db)
+
+	stats, err := db.gcTombstones(cutoff)
+	if err != nil {
+		t.Fatal("Error purging tombstones: ", err)
+	}
+
+	// 2 edges with tombstone points, 2 node points, and 1 deleted point
+	if stats.edges != 2 || stats.points != 5 {
+		t.Fatalf("Wrong gc stats: %+v", stats)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Purging tombstones changed the root hash")
+	}
+
+	var count int
+	err = db.db.QueryRow("SELECT COUNT(*) FROM node_points WHERE node_id IN ('group', 'var')").Scan(&count)
+	if err != nil || count != 0 {
+		t.Fatal("Node points not purged: ", count, err)
+	}
+
+	// second pass should not find anything
+	stats, err = db.gcTombstones(cutoff)
+	if err != nil || stats.edges != 0 || stats.points != 0 {
+		t.Fatalf("Second gc pass: %+v, %v", stats, err)
+	}
+
+	// an old write of the deleted point is ignored
+	err = db.NodePoints(rootID, data.Points{{Time: old.Add(-time.Hour),
+		Type: data.PointTypeValue, Key: "1", Value: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Old point changed the root hash")
+	}
+
+	// a newer write is added, and the purged hash stays in the root hash
+	newPoint := data.Point{Time: time.Now(), Type: data.PointTypeValue, Key: "1", Value: 3}
+	err = db.NodePoints(rootID, data.Points{newPoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash ^= newPoint.CRC()
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Root hash not correct after rewriting purged point")
+	}
+
+	// an old undelete is ignored
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: tombstoneTime.Add(-time.Minute), Type: data.PointTypeTombstone},
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := db.getNodes(nil, rootID, "group", "", true)
+	if err != nil || len(children) != 0 {
+		t.Fatal("Purged edge should not be restored by an old point: ", err)
+	}
+
+	// a newer undelete restores the edge
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: time.Now(), Type: data.PointTypeTombstone},
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children, err = db.getNodes(nil, rootID, "group", "", false)
+	if err != nil || len(children) != 1 {
+		t.Fatal("Purged edge was not restored: ", err)
+	}
+
+	rootHash(t, db)
+
+	// one record for the purged root points and one for the purged edges
+	err = db.db.QueryRow("SELECT COUNT(*) FROM purged WHERE owner = ?", rootID).Scan(&count)
+	if err != nil || count != 2 {
+		t.Fatal("Wrong number of purged records: ", count, err)
+	}
+
+	err = db.db.QueryRow("SELECT COUNT(*) FROM purged").Scan(&count)
+	if err != nil || count != 2 {
+		t.Fatal("Purged records for removed nodes were not removed: ", count, err)
+	}
+}
+
+func TestDbSqliteGCOwner(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+	old := time.Now().Add(-72 * time.Hour)
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	err := db.EdgePoints("group", rootID, data.Points{
+		{Time: old, Type: data.PointTypeTombstone},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deleted points in the group are folded into one record
+	for _, key := range []string{"1", "2"} {
+		err = db.NodePoints("group", data.Points{{Time: old, Type: data.PointTypeValue,
+			Key: key, Value: 5, Tombstone: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash := rootHash(t, db)
+
+	stats, err := db.gcTombstones(cutoff)
+	if err != nil || stats.points != 2 {
+		t.Fatalf("Error purging points: %+v, %v", stats, err)
+	}
+
+	var count int
+	err = db.db.QueryRow("SELECT COUNT(*) FROM purged WHERE owner = 'group'").Scan(&count)
+	if err != nil || count != 1 {
+		t.Fatal("Purged points not folded into one record: ", count, err)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Purging points changed the root hash")
+	}
+
+	// delete the group, its purged record is carried by the purged edge
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: old.Add(time.Hour), Type: data.PointTypeTombstone, Value: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash = rootHash(t, db)
+
+	stats, err = db.gcTombstones(cutoff)
+	if err != nil || stats.edges != 1 {
+		t.Fatalf("Error purging edge: %+v, %v", stats, err)
+	}
+
+	err = db.db.QueryRow("SELECT COUNT(*) FROM purged WHERE owner = 'group'").Scan(&count)
+	if err != nil || count != 0 {
+		t.Fatal("Purged record of removed node not removed: ", count, err)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Purging edge changed the root hash")
+	}
+}
+
+func TestDbSqliteGCRecent(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+	old := time.Now().Add(-72 * time.Hour)
+
+	err := db.EdgePoints("group", rootID, data.Points{
+		{Time: old, Type: data.PointTypeTombstone, Value: 1},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// node is deleted, but still being written to
+	err = db.NodePoints("group", data.Points{{Time: time.Now(),
+		Type: data.PointTypeValue, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.gcTombstones(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal("Error purging tombstones: ", err)
+	}
+
+	if stats.edges != 0 || stats.points != 0 {
+		t.Fatalf("Nothing should be purged: %+v", stats)
+	}
+}
+
+func TestDbSqliteGCResend(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+	old := time.Now().Add(-72 * time.Hour)
+
+	err := db.EdgePoints("group", rootID, data.Points{
+		{Time: old, Type: data.PointTypeTombstone, Value: 1},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deletedPoint := data.Point{Time: old, Type: data.PointTypeValue, Key: "1",
+		Value: 5, Tombstone: 1}
+	err = db.NodePoints(rootID, data.Points{deletedPoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := rootHash(t, db)
+
+	stats, err := db.gcTombstones(time.Now().Add(-24 * time.Hour))
+	if err != nil || stats.edges != 1 || stats.points != 2 {
+		t.Fatalf("Error purging tombstones: %+v, %v", stats, err)
+	}
+
+	// an upstream that has not purged sends the same tombstones back
+	err = db.NodePoints(rootID, data.Points{deletedPoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Resending purged point changed the root hash")
+	}
+
+	err = db.EdgePoints("group", rootID, data.Points{
+		{Time: old, Type: data.PointTypeTombstone, Value: 1},
+		{Time: old, Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := db.getNodes(nil, rootID, "group", "", true)
+	if err != nil || len(children) != 0 {
+		t.Fatal("Purged edge should not be restored by a resent tombstone: ", err)
+	}
+
+	if rootHash(t, db) != hash {
+		t.Fatal("Resending purged edge changed the root hash")
+	}
+}
@@ -1,5 +1,7 @@
 package store
 
+import "github.com/simpleiot/simpleiot/data"
+
 /* old implementation
 
 // updateHash updates the hash in all the upstream edges
@@ -31,3 +33,26 @@ func updateHash(node *data.Node, upEdges []*data.Edge, downEdges []*data.Edge) {
 }
 
 */
+
+// hashUpdate is a change to the hashes of the edges above a node. secret is
+// the part of the change from secret points, which is kept separately so
+// that hashes can be compared without secrets (see data.NodeEdge.SecretHash).
+type hashUpdate struct {
+	hash   uint32
+	secret uint32
+}
+
+// point adds a point to the update, or backs it out if it was already added
+func (u *hashUpdate) point(p data.Point) {
+	crc := p.CRC()
+	u.hash ^= crc
+	if p.IsSecret() {
+		u.secret ^= crc
+	}
+}
+
+// add adds another update to this one
+func (u *hashUpdate) add(o hashUpdate) {
+	u.hash ^= o.hash
+	u.secret ^= o.secret
+}
@@ -0,0 +1,495 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+var errHistoryDisabled = errors.New("local history is not enabled")
+
+// historyMaxRows is the maximum number of rows a history query reads. This
+// keeps a query with a large time range from using all available memory.
+var historyMaxRows = 100000
+
+// HistoryParams configure the local time-series history kept in the store.
+// This allows small systems to keep history without an external database.
+type HistoryParams struct {
+	// Retention is how long points are kept. Point types that are not in
+	// TypeRetention are not recorded if Retention is zero.
+	Retention time.Duration
+	// TypeRetention overrides Retention for specific point types. A
+	// retention of zero means points of that type are not recorded.
+	TypeRetention map[string]time.Duration
+	// Points older than DownsampleAge are combined into one point per
+	// DownsampleWindow that holds the mean, min, max, and count of the
+	// original points. Downsampling is disabled if either is zero.
+	DownsampleAge    time.Duration
+	DownsampleWindow time.Duration
+}
+
+// Enabled returns true if any points are recorded
+func (h HistoryParams) Enabled() bool {
+	if h.Retention > 0 {
+		return true
+	}
+
+	for _, r := range h.TypeRetention {
+		if r > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h HistoryParams) retention(typ string) time.Duration {
+	if r, ok := h.TypeRetention[typ]; ok {
+		return r
+	}
+	return h.Retention
+}
+
+// ParseHistoryRetention parses a comma separated list of retention periods.
+// An entry without a point type sets the default retention, and entries in
+// the form type=period set the retention for a point type, for example:
+// 30d,temp=7d,voltage=0. Periods are Go durations, and a d suffix is
+// accepted for days.
+func ParseHistoryRetention(s string) (time.Duration, map[string]time.Duration, error) {
+	var retention time.Duration
+	types := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		typ, period, found := strings.Cut(entry, "=")
+		if !found {
+			typ, period = "", entry
+		}
+
+		d, err := parseHistoryPeriod(period)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid history retention %q: %w", entry, err)
+		}
+
+		if typ == "" {
+			retention = d
+		} else {
+			types[strings.TrimSpace(typ)] = d
+		}
+	}
+
+	return retention, types, nil
+}
+
+func parseHistoryPeriod(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		d, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(d * float64(24*time.Hour)), nil
+	}
+
+	if s == "0" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func (sdb *DbSqlite) historyEnabled() bool {
+	return sdb.history.Enabled()
+}
+
+func (sdb *DbSqlite) initHistory() error {
+	// period is the downsample window in ns, or 0 for points that have
+	// not been downsampled
+	_, err := sdb.db.Exec(`CREATE TABLE IF NOT EXISTS history (node_id TEXT NOT NULL,
+				type TEXT,
+				key TEXT,
+				time INT,
+				value REAL,
+				min REAL,
+				max REAL,
+				count INT,
+				period INT)`)
+	if err != nil {
+		return fmt.Errorf("Error creating history table: %v", err)
+	}
+
+	_, err = sdb.db.Exec(`CREATE INDEX IF NOT EXISTS historyNodeTime ON history(node_id, time)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = sdb.db.Exec(`CREATE INDEX IF NOT EXISTS historyTime ON history(time)`)
+	return err
+}
+
+// recordHistory adds node points to the history. Only numeric points are
+// recorded -- text points are usually configuration and not time series
+// data.
+func (sdb *DbSqlite) recordHistory(tx *sql.Tx, id string, points data.Points) error {
+	stmt, err := tx.Prepare(`INSERT INTO history(node_id, type, key, time,
+		value, min, max, count, period) VALUES(?, ?, ?, ?, ?, ?, ?, 1, 0)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		if p.Text != "" || p.Tombstone%2 == 1 || sdb.history.retention(p.Type) <= 0 {
+			continue
+		}
+
+		t := p.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		key := p.Key
+		if key == "" {
+			key = "0"
+		}
+
+		_, err := stmt.Exec(id, p.Type, key, t.UnixNano(), p.Value, p.Value, p.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyMaint removes history that is older than the retention period and
+// downsamples old history. Returns the number of rows removed.
+func (sdb *DbSqlite) historyMaint(now time.Time) (int64, error) {
+	if !sdb.history.Enabled() {
+		return 0, nil
+	}
+
+	sdb.writeLock.Lock()
+	defer sdb.writeLock.Unlock()
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	rollback := func() {
+		rbErr := tx.Rollback()
+		if rbErr != nil {
+			log.Println("Rollback error:", rbErr)
+		}
+	}
+
+	var removed int64
+
+	exec := func(query string, args ...any) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		removed += n
+		return nil
+	}
+
+	var types []any
+	for typ, r := range sdb.history.TypeRetention {
+		types = append(types, typ)
+		err := exec(`DELETE FROM history WHERE type = ? AND time < ?`,
+			typ, now.Add(-r).UnixNano())
+		if err != nil {
+			rollback()
+			return 0, fmt.Errorf("Error removing old history: %w", err)
+		}
+	}
+
+	q := `DELETE FROM history WHERE time < ?`
+	if len(types) > 0 {
+		q += ` AND type NOT IN (?` + strings.Repeat(",?", len(types)-1) + `)`
+	}
+
+	err = exec(q, append([]any{now.Add(-sdb.history.Retention).UnixNano()}, types...)...)
+	if err != nil {
+		rollback()
+		return 0, fmt.Errorf("Error removing old history: %w", err)
+	}
+
+	if sdb.history.DownsampleAge > 0 && sdb.history.DownsampleWindow > 0 {
+		w := sdb.history.DownsampleWindow.Nanoseconds()
+		// align the cutoff to a window so that each window is only
+		// downsampled once
+		cutoff := now.Add(-sdb.history.DownsampleAge).UnixNano()
+		cutoff -= cutoff % w
+
+		_, err := tx.Exec(`INSERT INTO history(node_id, type, key, time,
+				value, min, max, count, period)
+			SELECT node_id, type, key, (time / ?1) * ?1,
+				SUM(value * count) / SUM(count), MIN(min), MAX(max),
+				SUM(count), ?1
+			FROM history WHERE period < ?1 AND time < ?2
+			GROUP BY node_id, type, key, time / ?1`, w, cutoff)
+		if err != nil {
+			rollback()
+			return 0, fmt.Errorf("Error downsampling history: %w", err)
+		}
+
+		_, err = tx.Exec(`DELETE FROM history WHERE period < ? AND time < ?`,
+			w, cutoff)
+		if err != nil {
+			rollback()
+			return 0, fmt.Errorf("Error downsampling history: %w", err)
+		}
+	}
+
+	return removed, tx.Commit()
+}
+
+// historyFilterValues returns the values of a tag filter if they can be
+// used in a SQL query
+func historyFilterValues(v any) ([]any, bool) {
+	var ret []any
+
+	switch typedV := v.(type) {
+	case string:
+		ret = append(ret, typedV)
+	case []string:
+		for _, s := range typedV {
+			ret = append(ret, s)
+		}
+	case []any:
+		ret = typedV
+	}
+
+	if len(ret) == 0 {
+		return nil, false
+	}
+
+	for _, r := range ret {
+		if s, ok := r.(string); !ok || s == "" {
+			return nil, false
+		}
+	}
+
+	return ret, true
+}
+
+// historyNodeTags returns the tags for a node in the same format used by
+// the Influx database client
+func (sdb *DbSqlite) historyNodeTags(id string) map[string]string {
+	tags := map[string]string{"node.id": id}
+
+	nodes, err := sdb.getNodes(nil, "all", id, "", false)
+	if err != nil || len(nodes) < 1 {
+		return tags
+	}
+
+	tags["node.type"] = nodes[0].Type
+	tags["node.description"] = ""
+	for _, p := range nodes[0].Points {
+		if p.Tombstone%2 == 1 {
+			continue
+		}
+		switch p.Type {
+		case data.PointTypeDescription:
+			tags["node.description"] = p.Text
+		case data.PointTypeTag:
+			if p.Text != "" {
+				tags["node.tag."+p.Key] = p.Text
+			}
+		}
+	}
+
+	return tags
+}
+
+// historyQuery runs a history query against the local history
+func (sdb *DbSqlite) historyQuery(qry data.HistoryQuery) data.HistoryResults {
+	var results data.HistoryResults
+
+	stop := qry.Stop
+	if stop.IsZero() {
+		stop = time.Now()
+	}
+
+	q := `SELECT node_id, type, key, time, value, min, max, count FROM history
+		WHERE time >= ? AND time < ?`
+	args := []any{qry.Start.UnixNano(), stop.UnixNano()}
+
+	// filter on columns in the query, other tags are matched below
+	for tag, col := range map[string]string{"node.id": "node_id", "type": "type"} {
+		if vals, ok := historyFilterValues(qry.TagFilters[tag]); ok {
+			q += ` AND ` + col + ` IN (?` + strings.Repeat(",?", len(vals)-1) + `)`
+			args = append(args, vals...)
+		}
+	}
+
+	q += ` ORDER BY time LIMIT ?`
+	args = append(args, historyMaxRows+1)
+
+	rows, err := sdb.db.Query(q, args...)
+	if err != nil {
+		results.ErrorMessage = "executing query: " + err.Error()
+		return results
+	}
+	defer rows.Close()
+
+	type historyRow struct {
+		nodeID, typ, key string
+		time             int64
+		value, min, max  float64
+		count            int64
+	}
+
+	var hRows []historyRow
+	for rows.Next() {
+		var r historyRow
+		err := rows.Scan(&r.nodeID, &r.typ, &r.key, &r.time, &r.value, &r.min,
+			&r.max, &r.count)
+		if err != nil {
+			results.ErrorMessage = "scanning history: " + err.Error()
+			return results
+		}
+		if len(hRows) >= historyMaxRows {
+			results.ErrorMessage = fmt.Sprintf("query returns more than %v points, "+
+				"use a shorter time range or filter", historyMaxRows)
+			return results
+		}
+		hRows = append(hRows, r)
+	}
+
+	if err := rows.Close(); err != nil {
+		results.ErrorMessage = "reading history: " + err.Error()
+		return results
+	}
+
+	nodeTags := make(map[string]map[string]string)
+
+	// tags returns the node tags for a row, or nil if the row does not
+	// match the tag filters
+	tags := func(r historyRow) (map[string]string, error) {
+		nt, ok := nodeTags[r.nodeID]
+		if !ok {
+			nt = sdb.historyNodeTags(r.nodeID)
+			nodeTags[r.nodeID] = nt
+		}
+
+		all := map[string]string{"type": r.typ, "key": r.key}
+		for k, v := range nt {
+			all[k] = v
+		}
+
+		match, err := qry.TagFilters.Match(all)
+		if err != nil || !match {
+			return nil, err
+		}
+		return nt, nil
+	}
+
+	if qry.AggregateWindow == nil {
+		for _, r := range hRows {
+			nt, err := tags(r)
+			if err != nil {
+				results.ErrorMessage = err.Error()
+				return results
+			}
+			if nt == nil {
+				continue
+			}
+
+			results.Points = append(results.Points, data.HistoryPoint{
+				Time:     time.Unix(0, r.time),
+				NodeTags: nt,
+				Type:     r.typ,
+				Key:      r.key,
+				Value:    r.value,
+			})
+		}
+
+		return results
+	}
+
+	w := qry.AggregateWindow.Nanoseconds()
+	if w <= 0 {
+		results.ErrorMessage = "aggregate window must be greater than 0"
+		return results
+	}
+
+	type aggregate struct {
+		data.HistoryAggregatedPoint
+		sum float64
+	}
+
+	var aggs []*aggregate
+	index := make(map[string]*aggregate)
+
+	for _, r := range hRows {
+		nt, err := tags(r)
+		if err != nil {
+			results.ErrorMessage = err.Error()
+			return results
+		}
+		if nt == nil {
+			continue
+		}
+
+		// windows are aligned to the epoch, and the aggregate time is the
+		// end of the window, the same as Influx
+		start := r.time - r.time%w
+		k := fmt.Sprintf("%v|%v|%v|%v", r.nodeID, r.typ, r.key, start)
+
+		a, ok := index[k]
+		if !ok {
+			a = &aggregate{HistoryAggregatedPoint: data.HistoryAggregatedPoint{
+				Time:     time.Unix(0, start+w),
+				NodeTags: nt,
+				Type:     r.typ,
+				Key:      r.key,
+				Min:      r.min,
+				Max:      r.max,
+			}}
+			index[k] = a
+			aggs = append(aggs, a)
+		}
+
+		if r.min < a.Min {
+			a.Min = r.min
+		}
+		if r.max > a.Max {
+			a.Max = r.max
+		}
+		a.Count += r.count
+		a.sum += r.value * float64(r.count)
+	}
+
+	sort.SliceStable(aggs, func(i, j int) bool {
+		return aggs[i].Time.Before(aggs[j].Time)
+	})
+
+	for _, a := range aggs {
+		if a.Count > 0 {
+			a.Mean = a.sum / float64(a.Count)
+		}
+		results.AggregatedPoints = append(results.AggregatedPoints,
+			a.HistoryAggregatedPoint)
+	}
+
+	return results
+}
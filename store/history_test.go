@@ -0,0 +1,198 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestParseHistoryRetention(t *testing.T) {
+	retention, types, err := ParseHistoryRetention("30d, temp=12h,voltage=0")
+	if err != nil {
+		t.Fatal("Error parsing retention: ", err)
+	}
+
+	if retention != 30*24*time.Hour {
+		t.Error("Wrong retention: ", retention)
+	}
+
+	if len(types) != 2 || types["temp"] != 12*time.Hour || types["voltage"] != 0 {
+		t.Error("Wrong type retention: ", types)
+	}
+
+	_, _, err = ParseHistoryRetention("temp=soon")
+	if err == nil {
+		t.Error("Expected error for invalid retention")
+	}
+}
+
+func TestDbSqliteHistory(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	db.history = HistoryParams{
+		Retention:        24 * time.Hour,
+		TypeRetention:    map[string]time.Duration{data.PointTypeTemperature: 0},
+		DownsampleAge:    time.Hour,
+		DownsampleWindow: 10 * time.Minute,
+	}
+
+	rootID := db.RootNodeID()
+
+	now := time.Now().Truncate(time.Hour)
+	start := now.Add(-2 * time.Hour)
+
+	// one point a minute for two hours
+	for i := 0; i < 120; i++ {
+		err := db.NodePoints(rootID, data.Points{{
+			Time:  start.Add(time.Duration(i) * time.Minute),
+			Type:  data.PointTypeValue,
+			Value: float64(i % 10),
+		}})
+		if err != nil {
+			t.Fatal("Error writing point: ", err)
+		}
+	}
+
+	// text points and excluded types are not recorded
+	err := db.NodePoints(rootID, data.Points{
+		{Time: now, Type: data.PointTypeDescription, Text: "root"},
+		{Time: now, Type: data.PointTypeTemperature, Value: 20},
+	})
+	if err != nil {
+		t.Fatal("Error writing point: ", err)
+	}
+
+	// a point that is older than the retention period
+	err = db.NodePoints(rootID, data.Points{{Time: now.Add(-48 * time.Hour),
+		Type: data.PointTypeVoltage, Value: 12}})
+	if err != nil {
+		t.Fatal("Error writing point: ", err)
+	}
+
+	res := db.historyQuery(data.HistoryQuery{
+		Start:      start,
+		Stop:       now,
+		TagFilters: data.TagFilters{"type": data.PointTypeValue},
+	})
+
+	if res.ErrorMessage != "" {
+		t.Fatal("Query error: ", res.ErrorMessage)
+	}
+
+	if len(res.Points) != 120 {
+		t.Fatal("Expected 120 points, got: ", len(res.Points))
+	}
+
+	if res.Points[0].NodeTags["node.id"] != rootID ||
+		res.Points[0].NodeTags["node.description"] != "root" {
+		t.Error("Node tags not correct: ", res.Points[0].NodeTags)
+	}
+
+	removed, err := db.historyMaint(now)
+	if err != nil {
+		t.Fatal("Error maintaining history: ", err)
+	}
+
+	if removed != 1 {
+		t.Error("Expected 1 point to be removed, got: ", removed)
+	}
+
+	window := 10 * time.Minute
+	aggQuery := data.HistoryQuery{
+		Start:           start,
+		Stop:            now,
+		AggregateWindow: &window,
+	}
+
+	res = db.historyQuery(aggQuery)
+	if res.ErrorMessage != "" {
+		t.Fatal("Query error: ", res.ErrorMessage)
+	}
+
+	// the first hour was downsampled, but aggregates should not change
+	if len(res.AggregatedPoints) != 12 {
+		t.Fatal("Expected 12 aggregated points, got: ", len(res.AggregatedPoints))
+	}
+
+	for _, p := range res.AggregatedPoints {
+		if p.Count != 10 || p.Min != 0 || p.Max != 9 || p.Mean != 4.5 {
+			t.Error("Aggregated point not correct: ", p)
+		}
+	}
+
+	if !res.AggregatedPoints[0].Time.Equal(start.Add(window)) {
+		t.Error("Aggregated point time should be the end of the window: ",
+			res.AggregatedPoints[0].Time)
+	}
+
+	// raw query of the downsampled hour returns one point per window
+	res = db.historyQuery(data.HistoryQuery{
+		Start: start,
+		Stop:  start.Add(time.Hour),
+	})
+
+	if len(res.Points) != 6 {
+		t.Fatal("Expected 6 downsampled points, got: ", len(res.Points))
+	}
+
+	if res.Points[0].Value != 4.5 {
+		t.Error("Downsampled value not correct: ", res.Points[0].Value)
+	}
+
+	// node tags that are not columns are filtered after the query
+	res = db.historyQuery(data.HistoryQuery{
+		Start:      start,
+		Stop:       now,
+		TagFilters: data.TagFilters{"node.type": "user"},
+	})
+
+	if len(res.Points) != 0 {
+		t.Error("Expected no points for filter, got: ", len(res.Points))
+	}
+
+	// queries that read too many rows return an error
+	maxRows := historyMaxRows
+	historyMaxRows = 5
+	defer func() { historyMaxRows = maxRows }()
+
+	res = db.historyQuery(data.HistoryQuery{
+		Start: start,
+		Stop:  start.Add(time.Hour),
+	})
+
+	if res.ErrorMessage == "" || len(res.Points) != 0 {
+		t.Error("Expected error for too many rows, got points: ", len(res.Points))
+	}
+}
+
+func TestDbSqliteHistoryOldPoint(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	db.history = HistoryParams{Retention: 24 * time.Hour}
+
+	rootID := db.RootNodeID()
+	now := time.Now()
+
+	for _, tm := range []time.Time{now, now.Add(-time.Minute)} {
+		err := db.NodePoints(rootID, data.Points{{Time: tm,
+			Type: data.PointTypeValue, Value: 1}})
+		if err != nil {
+			t.Fatal("Error writing point: ", err)
+		}
+	}
+
+	// the older point is ignored by the store, so it is not in the history
+	var count int
+	err := db.db.QueryRow(`SELECT COUNT(*) FROM history WHERE node_id = ? AND type = ?`,
+		rootID, data.PointTypeValue).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Error("Expected 1 history row, got: ", count)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// errStoreLocked is returned if another process has the store open
+var errStoreLocked = errors.New("store is in use by another process")
+
+// storeLock is an exclusive lock on a store file. It is held by the server
+// while the store is open so the store can't be replaced while it is running.
+type storeLock struct {
+	f *os.File
+}
+
+// lockStore locks dbFile. errStoreLocked is returned if the lock is held by
+// another process.
+func lockStore(dbFile string) (*storeLock, error) {
+	f, err := os.OpenFile(dbFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening store lock: %w", err)
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errStoreLocked
+		}
+		return nil, fmt.Errorf("Error locking store: %w", err)
+	}
+
+	return &storeLock{f: f}, nil
+}
+
+func (l *storeLock) unlock() {
+	// closing the file releases the lock
+	l.f.Close()
+}
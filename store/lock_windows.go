@@ -0,0 +1,13 @@
+//go:build windows
+
+package store
+
+// storeLock is a no-op on windows. Windows does not allow the store file
+// to be replaced while SQLite has it open.
+type storeLock struct{}
+
+func lockStore(_ string) (*storeLock, error) {
+	return &storeLock{}, nil
+}
+
+func (l *storeLock) unlock() {}
@@ -0,0 +1,426 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// DbMemory is a store backend that keeps all data in memory. It is useful
+// for tests and ephemeral instances -- all data is lost when it is closed.
+type DbMemory struct {
+	lock   sync.RWMutex
+	rootID string
+	jwtKey []byte
+	// node points, key is node ID
+	points map[string]data.Points
+	// edges indexed by down and up node IDs
+	edgesDown map[string][]*memEdge
+	edgesUp   map[string][]*memEdge
+}
+
+type memEdge struct {
+	up     string
+	down   string
+	typ    string
+	hash   hashUpdate
+	points data.Points
+}
+
+// NewMemoryDb creates a new in-memory store. If rootID is blank, a UUID is
+// used.
+func NewMemoryDb(rootID string) (*DbMemory, error) {
+	ret := &DbMemory{jwtKey: make([]byte, 20)}
+
+	_, err := rand.Read(ret.jwtKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading making JWT key: %v", err)
+	}
+
+	ret.clear()
+
+	ret.rootID, err = initRootNodes(ret, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (mdb *DbMemory) clear() {
+	mdb.points = make(map[string]data.Points)
+	mdb.edgesDown = make(map[string][]*memEdge)
+	mdb.edgesUp = make(map[string][]*memEdge)
+}
+
+// RootNodeID returns the ID of the instance root node
+func (mdb *DbMemory) RootNodeID() string {
+	mdb.lock.RLock()
+	defer mdb.lock.RUnlock()
+	return mdb.rootID
+}
+
+// JWTKey returns the key used to sign auth tokens
+func (mdb *DbMemory) JWTKey() []byte {
+	return mdb.jwtKey
+}
+
+// mergePoints merges points into stored points using the same rules as the
+// SQLite store. The updated points and the hash update are returned.
+func mergePoints(stored, points data.Points) (data.Points, hashUpdate) {
+	var update hashUpdate
+
+NextPin:
+	for _, pIn := range points {
+		if pIn.Time.IsZero() {
+			pIn.Time = time.Now()
+		}
+
+		if pIn.Key == "" {
+			pIn.Key = "0"
+		}
+
+		for i, p := range stored {
+			if pIn.Type == p.Type && pIn.Key == p.Key {
+				if !p.Time.After(pIn.Time) {
+					stored[i] = pIn
+					update.point(p)
+					update.point(pIn)
+				} else {
+					log.Println("Ignoring point due to timestamps:", pIn)
+				}
+				continue NextPin
+			}
+		}
+
+		stored = append(stored, pIn)
+		update.point(pIn)
+	}
+
+	return stored, update
+}
+
+// updateHash applies a hash update to all upstream edges
+func (mdb *DbMemory) updateHash(id string, update hashUpdate) {
+	for _, e := range mdb.edgesDown[id] {
+		e.hash.add(update)
+		if e.up != "none" {
+			mdb.updateHash(e.up, update)
+		}
+	}
+}
+
+// NodePoints writes node points to the store. Passwords are hashed in
+// points before they are written.
+func (mdb *DbMemory) NodePoints(id string, points data.Points) error {
+	err := hashPasswords(points)
+	if err != nil {
+		return err
+	}
+
+	points.Collapse()
+
+	mdb.lock.Lock()
+	defer mdb.lock.Unlock()
+
+	var update hashUpdate
+	mdb.points[id], update = mergePoints(mdb.points[id], points)
+	mdb.updateHash(id, update)
+
+	return nil
+}
+
+// EdgePoints writes edge points to the store. Edges are created as needed.
+func (mdb *DbMemory) EdgePoints(nodeID, parentID string, points data.Points) error {
+	points.Collapse()
+
+	if nodeID == parentID {
+		return fmt.Errorf("Error: edgePoints nodeID=parentID=%v", nodeID)
+	}
+
+	mdb.lock.Lock()
+	defer mdb.lock.Unlock()
+
+	if nodeID == mdb.rootID {
+		for _, p := range points {
+			if p.Type == data.PointTypeTombstone && p.Value > 0 {
+				return fmt.Errorf("Error, can't delete root node")
+			}
+		}
+	}
+
+	if parentID == "" {
+		parentID = "root"
+	}
+
+	var edge *memEdge
+	for _, e := range mdb.edgesDown[nodeID] {
+		if e.up == parentID {
+			edge = e
+			break
+		}
+	}
+
+	// we don't store node type points
+	var nodeType string
+	var edgePoints data.Points
+	for _, p := range points {
+		if p.Type == data.PointTypeNodeType {
+			nodeType = p.Text
+			continue
+		}
+		edgePoints = append(edgePoints, p)
+	}
+
+	var update hashUpdate
+
+	if edge == nil {
+		if nodeType == "" {
+			return fmt.Errorf("Node type must be sent with new edges")
+		}
+
+		edge = &memEdge{up: parentID, down: nodeID, typ: nodeType}
+
+		// existing node points must be added to the hash
+		for _, p := range mdb.points[nodeID] {
+			update.point(p)
+		}
+
+		mdb.edgesDown[nodeID] = append(mdb.edgesDown[nodeID], edge)
+		mdb.edgesUp[parentID] = append(mdb.edgesUp[parentID], edge)
+
+		if parentID == "root" {
+			mdb.rootID = nodeID
+		}
+	}
+
+	var edgeUpdate hashUpdate
+	edge.points, edgeUpdate = mergePoints(edge.points, edgePoints)
+	update.add(edgeUpdate)
+
+	mdb.updateHash(nodeID, update)
+
+	return nil
+}
+
+func (mdb *DbMemory) nodeEdge(e *memEdge) data.NodeEdge {
+	return data.NodeEdge{
+		ID:         e.down,
+		Type:       e.typ,
+		Parent:     e.up,
+		Hash:       e.hash.hash,
+		SecretHash: e.hash.secret,
+		Points:     append(data.Points{}, mdb.points[e.down]...),
+		EdgePoints: append(data.Points{}, e.points...),
+	}
+}
+
+// GetNodes returns nodes, see Backend for details
+func (mdb *DbMemory) GetNodes(parent, id, typ string, includeDel bool) ([]data.NodeEdge, error) {
+	var ret []data.NodeEdge
+
+	if parent == "" || parent == "none" {
+		return nil, errors.New("Parent must be set to valid ID, or all")
+	}
+
+	if id == "" {
+		id = "all"
+	}
+
+	mdb.lock.RLock()
+	defer mdb.lock.RUnlock()
+
+	var edges []*memEdge
+
+	switch {
+	case parent == "root":
+		edges = mdb.edgesDown[mdb.rootID]
+	case parent == "all" && id == "all":
+		return nil, errors.New("invalid combination of parent and id")
+	case parent == "all":
+		edges = mdb.edgesDown[id]
+	case id == "all":
+		edges = mdb.edgesUp[parent]
+	default:
+		for _, e := range mdb.edgesDown[id] {
+			if e.up == parent {
+				edges = append(edges, e)
+			}
+		}
+	}
+
+	for _, e := range edges {
+		if typ != "" && e.typ != typ {
+			continue
+		}
+
+		ne := mdb.nodeEdge(e)
+
+		if !includeDel {
+			tombstone, _ := ne.IsTombstone()
+			if tombstone {
+				// skip deleted nodes
+				continue
+			}
+		}
+
+		ret = append(ret, ne)
+	}
+
+	return ret, nil
+}
+
+// Up returns upstream ids for a node
+func (mdb *DbMemory) Up(id string, includeDeleted bool) ([]string, error) {
+	mdb.lock.RLock()
+	defer mdb.lock.RUnlock()
+
+	var ups []string
+
+	for _, e := range mdb.edgesDown[id] {
+		if includeDeleted {
+			ups = append(ups, e.up)
+		} else {
+			p, _ := e.points.Find(data.PointTypeTombstone, "")
+			if math.Mod(p.Value, 2) == 0 {
+				ups = append(ups, e.up)
+			}
+		}
+	}
+
+	return ups, nil
+}
+
+// UserCheck checks user authentication
+// returns nil, nil if user is not found
+func (mdb *DbMemory) UserCheck(email, password string) (data.Nodes, error) {
+	mdb.lock.RLock()
+	defer mdb.lock.RUnlock()
+
+	// make sure user nodes are still alive and have path to root
+	var checkUserPathRoot func(string) bool
+
+	checkUserPathRoot = func(id string) bool {
+		for _, e := range mdb.edgesDown[id] {
+			p, _ := e.points.Find(data.PointTypeTombstone, "")
+			if p.Value != 0 {
+				return false
+			}
+
+			if e.up == "root" || checkUserPathRoot(e.up) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var ret []data.NodeEdge
+
+	for id, edges := range mdb.edgesDown {
+		isUser := false
+		for _, e := range edges {
+			if e.typ == data.NodeTypeUser {
+				isUser = true
+			}
+		}
+
+		if !isUser {
+			continue
+		}
+
+		var ne []data.NodeEdge
+		for _, e := range edges {
+			tombstone, _ := mdb.nodeEdge(e).IsTombstone()
+			if !tombstone {
+				ne = append(ne, mdb.nodeEdge(e))
+			}
+		}
+
+		if len(ne) < 1 {
+			continue
+		}
+
+		n := ne[0].ToNode()
+		u := n.ToUser()
+		if u.Email == email && data.CheckPassword(u.Pass, password) &&
+			checkUserPathRoot(id) {
+			ret = append(ret, ne...)
+		}
+	}
+
+	return ret, nil
+}
+
+// VerifyNodeHashes recursively verifies all the hash values for all nodes
+func (mdb *DbMemory) VerifyNodeHashes(fix bool) error {
+	mdb.lock.Lock()
+	defer mdb.lock.Unlock()
+
+	var verify func(e *memEdge)
+
+	verify = func(e *memEdge) {
+		// children first as they can change the current hash
+		for _, c := range mdb.edgesUp[e.down] {
+			verify(c)
+		}
+
+		n := mdb.nodeEdge(e)
+		hash := hashUpdate{hash: n.CalcHash(nil), secret: n.CalcSecretHash(nil)}
+		for _, c := range mdb.edgesUp[e.down] {
+			hash.add(c.hash)
+		}
+
+		if hash != e.hash {
+			log.Printf("Hash failed for %v, stored: %v/%v, calc: %v/%v",
+				e.down, e.hash.hash, e.hash.secret, hash.hash, hash.secret)
+			if fix {
+				log.Println("fixing ...")
+				e.hash = hash
+			}
+		}
+	}
+
+	roots := mdb.edgesDown[mdb.rootID]
+	if len(roots) < 1 {
+		return errors.New("no root nodes")
+	}
+
+	verify(roots[0])
+
+	return nil
+}
+
+// Reset the database by permanently wiping all data
+func (mdb *DbMemory) Reset() error {
+	mdb.lock.Lock()
+	mdb.clear()
+	rootID := mdb.rootID
+	mdb.lock.Unlock()
+
+	var err error
+	rootID, err = initRootNodes(mdb, rootID)
+	if err != nil {
+		return fmt.Errorf("error initializing root node: %v", err)
+	}
+
+	mdb.lock.Lock()
+	mdb.rootID = rootID
+	mdb.lock.Unlock()
+
+	return nil
+}
+
+// Close the db. All data is lost.
+func (mdb *DbMemory) Close() error {
+	mdb.lock.Lock()
+	defer mdb.lock.Unlock()
+	mdb.clear()
+	return nil
+}
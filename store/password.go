@@ -0,0 +1,83 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// hashPasswords replaces the text of pass points with a hash of the
+// password. Points are modified in place so that the hash, and not the
+// password, is sent to upstream subscribers.
+func hashPasswords(points data.Points) error {
+	for i, p := range points {
+		if p.Type != data.PointTypePass || p.Text == "" || data.IsPasswordHash(p.Text) {
+			continue
+		}
+
+		hash, err := data.HashPassword(p.Text)
+		if err != nil {
+			return fmt.Errorf("Error hashing password: %w", err)
+		}
+
+		points[i].Text = hash
+	}
+
+	return nil
+}
+
+// migratePasswords hashes passwords that were stored by older versions of
+// SIOT. The hashed password is written with the current time so that it
+// replaces the plain text password in upstream instances.
+func (sdb *DbSqlite) migratePasswords() error {
+	rows, err := sdb.db.Query(`SELECT node_id, key, text FROM node_points
+		WHERE type = ? AND text != ''`, data.PointTypePass)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type update struct {
+		id string
+		p  data.Point
+	}
+
+	var updates []update
+
+	for rows.Next() {
+		var id string
+		var p data.Point
+		err := rows.Scan(&id, &p.Key, &p.Text)
+		if err != nil {
+			return err
+		}
+
+		// encrypted passwords were hashed before they were encrypted
+		if data.IsPasswordHash(p.Text) || isEncrypted(p.Text) {
+			continue
+		}
+
+		p.Type = data.PointTypePass
+		p.Time = time.Now()
+		updates = append(updates, update{id, p})
+	}
+
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		err := sdb.NodePoints(u.id, data.Points{u.p})
+		if err != nil {
+			return fmt.Errorf("Error writing hashed password: %w", err)
+		}
+	}
+
+	if len(updates) > 0 {
+		log.Printf("STORE: hashed %v plain text passwords\n", len(updates))
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Secret points
+//
+// The text of secret points (see data.SecretPointTypes) is encrypted with
+// AES-GCM before it is written to the database if a secret key is
+// configured. The key is never stored in the database. Encrypted text is
+// prefixed with secretPrefix so that plain text from older versions can be
+// detected and encrypted at start-up. Point CRCs and node hashes are always
+// calculated with the plain text, so encryption is invisible to sync.
+
+const secretPrefix = "enc:v1:"
+
+// SecretKeySize is the size of the key used to encrypt secret points
+const SecretKeySize = 32
+
+var errSecretKeyMissing = errors.New("store contains encrypted secrets, but no secret key is configured")
+
+// ParseSecretKey decodes a base64 encoded secret key
+func ParseSecretKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding secret key: %w", err)
+	}
+
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("secret key must be %v bytes, got %v", SecretKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// ReadSecretKey reads a base64 encoded secret key from a file
+func ReadSecretKey(file string) ([]byte, error) {
+	s, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading secret key file: %w", err)
+	}
+
+	return ParseSecretKey(string(s))
+}
+
+func isEncrypted(text string) bool {
+	return strings.HasPrefix(text, secretPrefix)
+}
+
+// initSecrets sets up encryption of secret points. If key is nil, the
+// database must not contain any encrypted secrets.
+func (sdb *DbSqlite) initSecrets(key []byte) error {
+	if key == nil {
+		var count int
+		err := sdb.db.QueryRow(`SELECT (SELECT COUNT(*) FROM node_points WHERE text LIKE ?1) +
+			(SELECT COUNT(*) FROM edge_points WHERE text LIKE ?1)`, secretPrefix+"%").Scan(&count)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return errSecretKeyMissing
+		}
+
+		return nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("Error creating secret cipher: %w", err)
+	}
+
+	sdb.secrets, err = cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("Error creating secret cipher: %w", err)
+	}
+
+	return nil
+}
+
+// encryptText returns the text to store for a point. The text of secret
+// points is encrypted if a secret key is configured.
+func (sdb *DbSqlite) encryptText(p data.Point) (string, error) {
+	if sdb.secrets == nil || p.Text == "" || !p.IsSecret() {
+		return p.Text, nil
+	}
+
+	nonce := make([]byte, sdb.secrets.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	ct := sdb.secrets.Seal(nonce, nonce, []byte(p.Text), []byte(p.Type))
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// decryptPoint decrypts the text of a point read from the database
+func (sdb *DbSqlite) decryptPoint(p *data.Point) error {
+	if !isEncrypted(p.Text) {
+		return nil
+	}
+
+	if sdb.secrets == nil {
+		return errSecretKeyMissing
+	}
+
+	ct, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(p.Text, secretPrefix))
+	if err != nil {
+		return fmt.Errorf("Error decoding secret point %v: %w", p.Type, err)
+	}
+
+	nonceSize := sdb.secrets.NonceSize()
+	if len(ct) < nonceSize {
+		return fmt.Errorf("secret point %v is too short", p.Type)
+	}
+
+	text, err := sdb.secrets.Open(nil, ct[:nonceSize], ct[nonceSize:], []byte(p.Type))
+	if err != nil {
+		return fmt.Errorf("Error decrypting secret point %v, wrong secret key?: %w", p.Type, err)
+	}
+
+	p.Text = string(text)
+
+	return nil
+}
+
+// migrateSecrets encrypts secret points that are stored in plain text and
+// makes sure stored secrets can be decrypted with the current key. Only the
+// text is updated, so point times and hashes do not change.
+func (sdb *DbSqlite) migrateSecrets() error {
+	if sdb.secrets == nil {
+		return nil
+	}
+
+	sdb.writeLock.Lock()
+	defer sdb.writeLock.Unlock()
+
+	var types []any
+	var params []string
+	for typ := range data.SecretPointTypes {
+		types = append(types, typ)
+		params = append(params, "?")
+	}
+
+	if len(types) == 0 {
+		return nil
+	}
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rollback := func() {
+		rbErr := tx.Rollback()
+		if rbErr != nil {
+			log.Println("Rollback error:", rbErr)
+		}
+	}
+
+	var count int
+
+	for _, table := range []string{"node_points", "edge_points"} {
+		rows, err := tx.Query(`SELECT id, type, text FROM `+table+`
+			WHERE text != '' AND type IN (`+strings.Join(params, ",")+`)`, types...)
+		if err != nil {
+			rollback()
+			return err
+		}
+		defer rows.Close()
+
+		var ids []string
+		var points data.Points
+
+		for rows.Next() {
+			var id string
+			var p data.Point
+			err := rows.Scan(&id, &p.Type, &p.Text)
+			if err != nil {
+				rollback()
+				return err
+			}
+			ids = append(ids, id)
+			points = append(points, p)
+		}
+
+		if err := rows.Close(); err != nil {
+			rollback()
+			return err
+		}
+
+		for i, p := range points {
+			if isEncrypted(p.Text) {
+				err := sdb.decryptPoint(&p)
+				if err != nil {
+					rollback()
+					return err
+				}
+				continue
+			}
+
+			text, err := sdb.encryptText(p)
+			if err != nil {
+				rollback()
+				return err
+			}
+
+			_, err = tx.Exec(`UPDATE `+table+` SET text = ? WHERE id = ?`, text, ids[i])
+			if err != nil {
+				rollback()
+				return err
+			}
+
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Printf("STORE: encrypted %v secret points\n", count)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestDbSqliteSecrets(t *testing.T) {
+	db := newTestDb(t)
+
+	rootID := db.RootNodeID()
+
+	// secret stored before encryption is enabled
+	err := db.NodePoints(rootID, data.Points{{Time: time.Now(),
+		Type: data.PointTypeAuthToken, Text: "old-token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := rootHash(t, db)
+	db.Close()
+
+	key := make([]byte, SecretKeySize)
+	key[0] = 1
+
+	db, err = NewSqliteDb(testFile, "", key)
+	if err != nil {
+		t.Fatal("Error opening db with secret key: ", err)
+	}
+
+	err = db.NodePoints(rootID, data.Points{{Time: time.Now(),
+		Type: data.PointTypeToken, Text: "new-token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.db.Query(`SELECT text FROM node_points WHERE type IN (?, ?, ?)`,
+		data.PointTypeAuthToken, data.PointTypeToken, data.PointTypePass)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for rows.Next() {
+		var text string
+		err := rows.Scan(&text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(text, secretPrefix) {
+			t.Error("Secret stored in plain text: ", text)
+		}
+		count++
+	}
+	rows.Close()
+
+	// auth token, token, and admin password
+	if count != 3 {
+		t.Fatal("Wrong number of secret points: ", count)
+	}
+
+	nodes, err := db.GetNodes("all", rootID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	if v, _ := nodes[0].Points.Text(data.PointTypeAuthToken, ""); v != "old-token" {
+		t.Fatal("Secret not decrypted: ", v)
+	}
+
+	if v, _ := nodes[0].Points.Text(data.PointTypeToken, ""); v != "new-token" {
+		t.Fatal("Secret not decrypted: ", v)
+	}
+
+	// encrypting the old token must not change the hash
+	p, _ := nodes[0].Points.Find(data.PointTypeToken, "")
+	if rootHash(t, db) != hash^p.CRC() {
+		t.Fatal("Hash changed when secrets were encrypted")
+	}
+
+	users, err := db.UserCheck("admin@admin.com", "admin")
+	if err != nil || len(users) != 1 {
+		t.Fatal("User check failed with encrypted password: ", err)
+	}
+
+	db.Close()
+
+	// secrets can't be read without the key
+	_, err = NewSqliteDb(testFile, "", nil)
+	if !errors.Is(err, errSecretKeyMissing) {
+		t.Fatal("Expected missing key error, got: ", err)
+	}
+
+	key[0] = 2
+	_, err = NewSqliteDb(testFile, "", key)
+	if err == nil {
+		t.Fatal("Expected error with the wrong key")
+	}
+}
+
+func TestDbSqliteSecretHash(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+
+	getRoot := func() data.NodeEdge {
+		t.Helper()
+		rootHash(t, db)
+		nodes, err := db.GetNodes("root", "all", "", false)
+		if err != nil || len(nodes) < 1 {
+			t.Fatal("Error getting root node: ", err)
+		}
+		return nodes[0]
+	}
+
+	// the admin user has a secret password
+	root := getRoot()
+	if root.SecretHash == 0 {
+		t.Fatal("Root secret hash does not include admin password")
+	}
+
+	noSecrets := root.Hash ^ root.SecretHash
+
+	err := db.NodePoints(rootID, data.Points{{Time: time.Now(),
+		Type: data.PointTypeToken, Text: "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root = getRoot()
+	if root.Hash^root.SecretHash != noSecrets {
+		t.Error("Hash without secrets changed when a secret was written")
+	}
+
+	err = db.NodePoints(rootID, data.Points{{Time: time.Now(),
+		Type: data.PointTypeDescription, Text: "root"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root = getRoot()
+	if root.Hash^root.SecretHash == noSecrets {
+		t.Error("Hash without secrets did not change when a point was written")
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"crypto/cipher"
 	"crypto/rand"
 	"database/sql"
 	"errors"
@@ -23,6 +24,11 @@ type DbSqlite struct {
 	db        *sql.DB
 	meta      Meta
 	writeLock sync.Mutex
+	history   HistoryParams
+	// secrets encrypts the text of secret points, nil if not configured
+	secrets cipher.AEAD
+	// lock keeps the store from being restored while it is open
+	lock *storeLock
 }
 
 // Meta contains metadata about the database
@@ -33,8 +39,26 @@ type Meta struct {
 	JWTKey  []byte `json:"jwtKey"`
 }
 
-// NewSqliteDb creates a new Sqlite data store
-func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
+// NewSqliteDb creates a new Sqlite data store. If secretKey is set, it is
+// used to encrypt secret points (see data.SecretPointTypes).
+func NewSqliteDb(dbFile string, rootID string, secretKey []byte) (*DbSqlite, error) {
+	lock, err := lockStore(dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := newSqliteDb(dbFile, rootID, secretKey)
+	if err != nil {
+		lock.unlock()
+		return nil, err
+	}
+
+	ret.lock = lock
+
+	return ret, nil
+}
+
+func newSqliteDb(dbFile string, rootID string, secretKey []byte) (*DbSqlite, error) {
 	ret := &DbSqlite{}
 
 	pragmas := "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(8000)&_pragma=journal_size_limit(100000000)"
@@ -82,7 +106,8 @@ func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
 				up TEXT,
 				down TEXT,
 				hash INT,
-				type TEXT)`)
+				type TEXT,
+				secret_hash INT DEFAULT 0)`)
 
 	if err != nil {
 		return nil, fmt.Errorf("Error creating edges table: %v", err)
@@ -135,6 +160,21 @@ func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
 		return nil, err
 	}
 
+	err = ret.initHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ret.initPurged()
+	if err != nil {
+		return nil, err
+	}
+
+	addedSecretHashes, err := ret.addSecretHashColumn()
+	if err != nil {
+		return nil, fmt.Errorf("Error adding secret hash column: %v", err)
+	}
+
 	err = ret.initMeta()
 	if err != nil {
 		return nil, fmt.Errorf("Error initializing db meta: %v", err)
@@ -145,6 +185,21 @@ func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
 		return nil, fmt.Errorf("Error running migrations: %v", err)
 	}
 
+	err = ret.initSecrets(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing secrets: %w", err)
+	}
+
+	err = ret.migratePasswords()
+	if err != nil {
+		return nil, fmt.Errorf("Error migrating passwords: %v", err)
+	}
+
+	err = ret.migrateSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting secrets: %v", err)
+	}
+
 	if ret.meta.RootID == "" {
 		// we need to initialize root node and user
 		ret.meta.RootID, err = ret.initRoot(rootID)
@@ -153,6 +208,16 @@ func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
 		}
 	}
 
+	if addedSecretHashes {
+		// secret points must be decrypted to calculate the hashes, so
+		// this is done after secrets are initialized
+		log.Println("Calculating secret point hashes")
+		err = ret.VerifyNodeHashes(true)
+		if err != nil {
+			return nil, fmt.Errorf("Error calculating secret hashes: %v", err)
+		}
+	}
+
 	if len(ret.meta.JWTKey) <= 0 {
 		err := ret.initJwtKey()
 		if err != nil {
@@ -201,6 +266,25 @@ func (sdb *DbSqlite) initMeta() error {
 	return nil
 }
 
+// addSecretHashColumn adds the secret hash column to edges in stores
+// created before it existed. true is returned if the column was added, and
+// the edge secret hashes need to be calculated.
+func (sdb *DbSqlite) addSecretHashColumn() (bool, error) {
+	var count int
+	err := sdb.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('edges')
+		WHERE name='secret_hash'`).Scan(&count)
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	_, err = sdb.db.Exec(`ALTER TABLE edges ADD COLUMN secret_hash INT DEFAULT 0`)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (sdb *DbSqlite) runMigrations() error {
 	if sdb.meta.Version < 4 {
 		_, err := sdb.db.Exec(`UPDATE node_points SET key = '0' WHERE key = ''`)
@@ -223,12 +307,12 @@ func (sdb *DbSqlite) runMigrations() error {
 	return nil
 }
 
-// reset the database by permanently wiping all data
-func (sdb *DbSqlite) reset() error {
+// Reset the database by permanently wiping all data
+func (sdb *DbSqlite) Reset() error {
 	var err error
 
 	// truncate several tables
-	tables := []string{"meta", "edges", "node_points", "edge_points"}
+	tables := []string{"meta", "edges", "node_points", "edge_points", "history", "purged"}
 	for _, v := range tables {
 		_, err = sdb.db.Exec(`DELETE FROM ` + v)
 		if err != nil {
@@ -256,9 +340,9 @@ func (sdb *DbSqlite) reset() error {
 	return nil
 }
 
-// verifyNodeHashes recursively verifies all the hash values for all nodes
+// VerifyNodeHashes recursively verifies all the hash values for all nodes
 // this walks to the bottom of the tree, and then works its way back up
-func (sdb *DbSqlite) verifyNodeHashes(fix bool) error {
+func (sdb *DbSqlite) VerifyNodeHashes(fix bool) error {
 	// must run this in a transaction so we don't get any modifications
 	// while reading child nodes. This may be expensive for a large DB, so
 	// we may want to eventually break this down into transactions for each node
@@ -307,15 +391,26 @@ func (sdb *DbSqlite) verifyNodeHashes(fix bool) error {
 			}
 		}
 
-		hash := node.CalcHash(children)
+		hash := hashUpdate{
+			hash:   node.CalcHash(children),
+			secret: node.CalcSecretHash(children),
+		}
 
-		if hash != node.Hash {
-			log.Printf("Hash failed for %v, stored: %v, calc: %v",
-				node.ID, node.Hash, hash)
+		// purged items stay in the hash, see gc.go
+		purgedHash, err := sdb.purgedHash(node.Parent, node.ID)
+		if err != nil {
+			return err
+		}
+
+		hash.add(purgedHash)
+
+		if hash.hash != node.Hash || hash.secret != node.SecretHash {
+			log.Printf("Hash failed for %v, stored: %v/%v, calc: %v/%v",
+				node.ID, node.Hash, node.SecretHash, hash.hash, hash.secret)
 			if fix {
 				log.Println("fixing ...")
-				_, err := tx.Exec(`UPDATE edges SET hash = ? WHERE up = ? AND down = ?`,
-					hash, node.Parent, node.ID)
+				_, err := tx.Exec(`UPDATE edges SET hash = ?, secret_hash = ? WHERE up = ? AND down = ?`,
+					hash.hash, hash.secret, node.Parent, node.ID)
 				if err != nil {
 					return err
 				}
@@ -341,64 +436,19 @@ func (sdb *DbSqlite) verifyNodeHashes(fix bool) error {
 }
 
 func (sdb *DbSqlite) initRoot(rootID string) (string, error) {
-	log.Println("STORE: Initialize root node and admin user")
-	rootNode := data.NodeEdge{
-		ID:   rootID,
-		Type: data.NodeTypeDevice,
-	}
-
-	rootNode.ID = rootID
-
-	if rootNode.ID == "" {
-		rootNode.ID = uuid.New().String()
-	}
-
-	err := sdb.nodePoints(rootNode.ID, rootNode.Points)
-	if err != nil {
-		return "", fmt.Errorf("Error setting root node points: %v", err)
-	}
-
-	err = sdb.edgePoints(rootNode.ID, "root", data.Points{
-		{Type: data.PointTypeTombstone, Value: 0},
-		{Type: data.PointTypeNodeType, Text: rootNode.Type},
-	})
-	if err != nil {
-		return "", fmt.Errorf("Error sending root node edges: %w", err)
-	}
-
-	// create admin user off root node
-	admin := data.User{
-		ID:        uuid.New().String(),
-		FirstName: "admin",
-		LastName:  "user",
-		Email:     "admin@admin.com",
-		Pass:      "admin",
-	}
-
-	points := admin.ToPoints()
-
-	err = sdb.nodePoints(admin.ID, points)
-	if err != nil {
-		return "", fmt.Errorf("Error setting default user: %v", err)
-	}
-
-	err = sdb.edgePoints(admin.ID, rootNode.ID, data.Points{
-		{Type: data.PointTypeTombstone, Value: 0},
-		{Type: data.PointTypeNodeType, Text: data.NodeTypeUser},
-	})
-
+	rootID, err := initRootNodes(sdb, rootID)
 	if err != nil {
 		return "", err
 	}
 
 	sdb.writeLock.Lock()
 	defer sdb.writeLock.Unlock()
-	_, err = sdb.db.Exec("UPDATE meta SET root_id = ?", rootNode.ID)
+	_, err = sdb.db.Exec("UPDATE meta SET root_id = ?", rootID)
 	if err != nil {
 		return "", fmt.Errorf("Error setting meta rootID: %v", err)
 	}
 
-	return rootNode.ID, nil
+	return rootID, nil
 }
 
 func (sdb *DbSqlite) initJwtKey() error {
@@ -418,14 +468,39 @@ func (sdb *DbSqlite) initJwtKey() error {
 	return nil
 }
 
-func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
-	points.Collapse()
+// NodePoints writes node points to the store. Passwords are hashed in
+// points before they are written.
+func (sdb *DbSqlite) NodePoints(id string, points data.Points) error {
+	return sdb.nodePointsBatch([]nodePointsWrite{{id: id, points: points}})[0]
+}
+
+// nodePointsBatch writes points for multiple nodes in one transaction, and
+// updates the hash of each upstream edge once. An error is returned for each
+// write. Each write is done in a savepoint, so a write that fails does not
+// affect the other writes in the batch.
+func (sdb *DbSqlite) nodePointsBatch(writes []nodePointsWrite) []error {
+	errs := make([]error, len(writes))
+
+	// batchErr sets the error for all writes that have not failed yet
+	batchErr := func(err error) []error {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	for i := range writes {
+		errs[i] = hashPasswords(writes[i].points)
+		writes[i].points.Collapse()
+	}
 
 	sdb.writeLock.Lock()
 	defer sdb.writeLock.Unlock()
 	tx, err := sdb.db.Begin()
 	if err != nil {
-		return err
+		return batchErr(err)
 	}
 
 	rollback := func() {
@@ -435,10 +510,60 @@ func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
 		}
 	}
 
-	rowsPoints, err := tx.Query("SELECT * FROM node_points WHERE node_id=?", id)
+	hashUpdates := make(map[string]hashUpdate)
+
+	for i, w := range writes {
+		if errs[i] != nil {
+			continue
+		}
+
+		_, err := tx.Exec("SAVEPOINT write")
+		if err != nil {
+			rollback()
+			return batchErr(err)
+		}
+
+		update, err := sdb.nodePoints(tx, w.id, w.points)
+		if err != nil {
+			errs[i] = err
+			_, err = tx.Exec("ROLLBACK TO write")
+			if err != nil {
+				rollback()
+				return batchErr(err)
+			}
+		} else {
+			u := hashUpdates[w.id]
+			u.add(update)
+			hashUpdates[w.id] = u
+		}
+
+		_, err = tx.Exec("RELEASE write")
+		if err != nil {
+			rollback()
+			return batchErr(err)
+		}
+	}
+
+	err = sdb.updateHashes(tx, hashUpdates)
 	if err != nil {
 		rollback()
-		return err
+		return batchErr(fmt.Errorf("Error updating upstream hash: %v", err))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return batchErr(err)
+	}
+
+	return errs
+}
+
+// nodePoints writes node points in a transaction and returns the hash
+// update for the node. The caller must update the upstream hashes.
+func (sdb *DbSqlite) nodePoints(tx *sql.Tx, id string, points data.Points) (hashUpdate, error) {
+	rowsPoints, err := tx.Query("SELECT * FROM node_points WHERE node_id=?", id)
+	if err != nil {
+		return hashUpdate{}, err
 	}
 	defer rowsPoints.Close()
 
@@ -454,8 +579,11 @@ func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
 		err := rowsPoints.Scan(&pID, &nodeID, &p.Type, &p.Key, &timeNS, &index, &p.Value, &p.Text,
 			&p.Data, &p.Tombstone, &p.Origin)
 		if err != nil {
-			rollback()
-			return err
+			return hashUpdate{}, err
+		}
+		err = sdb.decryptPoint(&p)
+		if err != nil {
+			return hashUpdate{}, err
 		}
 		p.Time = time.Unix(0, timeNS)
 		dbPoints = append(dbPoints, p)
@@ -463,14 +591,18 @@ func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
 	}
 
 	if err := rowsPoints.Close(); err != nil {
-		rollback()
-		return fmt.Errorf("Error closing rowsPoints: %v", err)
+		return hashUpdate{}, fmt.Errorf("Error closing rowsPoints: %v", err)
+	}
+
+	purgedPoints, isPurged, err := sdb.getPurged(tx, purgedNodePoint, id)
+	if err != nil {
+		return hashUpdate{}, err
 	}
 
 	var writePoints data.Points
 	var writePointIDs []string
 
-	var hashUpdate uint32
+	var update hashUpdate
 
 NextPin:
 	for _, pIn := range points {
@@ -489,8 +621,8 @@ NextPin:
 					writePoints = append(writePoints, pIn)
 					writePointIDs = append(writePointIDs, dbPointIDs[j])
 					// back out old CRC and add in new one
-					hashUpdate ^= pDb.CRC()
-					hashUpdate ^= pIn.CRC()
+					update.point(pDb)
+					update.point(pIn)
 				} else {
 					log.Println("Ignoring node point due to timestamps:", id, pIn)
 				}
@@ -498,9 +630,15 @@ NextPin:
 			}
 		}
 
+		// the point may have been purged, see gc.go
+		if isPurged && !pIn.Time.After(purgedPoints.time) {
+			log.Println("Ignoring node point due to timestamps:", id, pIn)
+			continue NextPin
+		}
+
 		// point was not found so write it
 		writePoints = append(writePoints, pIn)
-		hashUpdate ^= pIn.CRC()
+		update.point(pIn)
 		writePointIDs = append(writePointIDs, uuid.New().String())
 	}
 
@@ -520,8 +658,7 @@ NextPin:
 		 `)
 
 	if err != nil {
-		rollback()
-		return err
+		return hashUpdate{}, err
 	}
 
 	defer func() {
@@ -534,31 +671,31 @@ NextPin:
 	for i, p := range writePoints {
 		tNs := p.Time.UnixNano()
 		pID := writePointIDs[i]
-		_, err = stmt.Exec(pID, id, p.Type, p.Key, tNs, 0, p.Value, p.Text, p.Data, p.Tombstone,
+		text, err := sdb.encryptText(p)
+		if err != nil {
+			return hashUpdate{}, err
+		}
+		_, err = stmt.Exec(pID, id, p.Type, p.Key, tNs, 0, p.Value, text, p.Data, p.Tombstone,
 			p.Origin)
 		if err != nil {
-			rollback()
-			return err
+			return hashUpdate{}, err
 		}
 	}
 
 	stmt.Close()
 
-	err = sdb.updateHash(tx, id, hashUpdate)
-	if err != nil {
-		rollback()
-		return fmt.Errorf("Error updating upstream hash: %v", err)
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return err
+	if sdb.history.Enabled() {
+		err = sdb.recordHistory(tx, id, writePoints)
+		if err != nil {
+			return hashUpdate{}, fmt.Errorf("Error recording history: %v", err)
+		}
 	}
 
-	return nil
+	return update, nil
 }
 
-func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) error {
+// EdgePoints writes edge points to the store. Edges are created as needed.
+func (sdb *DbSqlite) EdgePoints(nodeID, parentID string, points data.Points) error {
 	points.Collapse()
 
 	if nodeID == parentID {
@@ -610,6 +747,36 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 		edge = edges[0]
 	}
 
+	var purgedPoints purged
+	var isPurged bool
+
+	if newEdge {
+		// the edge may have been purged, so an edge with a tombstone point
+		// not newer than the edges purged from the parent is ignored
+		purgedEdges, ok, err := sdb.getPurged(tx, purgedEdge, parentID)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		if ok {
+			for _, p := range points {
+				if p.Type == data.PointTypeTombstone && !p.Time.IsZero() &&
+					!p.Time.After(purgedEdges.time) {
+					rollback()
+					log.Println("Ignoring edge points for purged edge:", parentID, nodeID)
+					return nil
+				}
+			}
+		}
+	} else {
+		purgedPoints, isPurged, err = sdb.getPurged(tx, purgedEdgePoint, edge.ID)
+		if err != nil {
+			rollback()
+			return err
+		}
+	}
+
 	rowsPoints, err := tx.Query("SELECT * FROM edge_points WHERE edge_id=?", edge.ID)
 	if err != nil {
 		rollback()
@@ -632,6 +799,11 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 			rollback()
 			return err
 		}
+		err = sdb.decryptPoint(&p)
+		if err != nil {
+			rollback()
+			return err
+		}
 		p.Time = time.Unix(0, timeNS)
 		dbPoints = append(dbPoints, p)
 		dbPointIDs = append(dbPointIDs, pID)
@@ -645,7 +817,7 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 	var writePoints data.Points
 	var writePointIDs []string
 
-	var hashUpdate uint32
+	var update hashUpdate
 
 	var nodeType string
 
@@ -672,8 +844,8 @@ NextPin:
 					writePoints = append(writePoints, pIn)
 					writePointIDs = append(writePointIDs, dbPointIDs[j])
 					// back out old CRC and add in new one
-					hashUpdate ^= pDb.CRC()
-					hashUpdate ^= pIn.CRC()
+					update.point(pDb)
+					update.point(pIn)
 				} else {
 					log.Println("Ignoring edge point due to timestamps:", edge.ID, pIn)
 				}
@@ -681,9 +853,15 @@ NextPin:
 			}
 		}
 
+		// the point may have been purged, see gc.go
+		if isPurged && !pIn.Time.After(purgedPoints.time) {
+			log.Println("Ignoring edge point due to timestamps:", edge.ID, pIn)
+			continue NextPin
+		}
+
 		// point was not found so write it
 		writePoints = append(writePoints, pIn)
-		hashUpdate ^= pIn.CRC()
+		update.point(pIn)
 		writePointIDs = append(writePointIDs, uuid.New().String())
 	}
 
@@ -711,7 +889,13 @@ NextPin:
 	for i, p := range writePoints {
 		tNs := p.Time.UnixNano()
 		pID := writePointIDs[i]
-		_, err = stmt.Exec(pID, edge.ID, p.Type, p.Key, tNs, 0, p.Value, p.Text, p.Data, p.Tombstone,
+		text, err := sdb.encryptText(p)
+		if err != nil {
+			stmt.Close()
+			rollback()
+			return err
+		}
+		_, err = stmt.Exec(pID, edge.ID, p.Type, p.Key, tNs, 0, p.Value, text, p.Data, p.Tombstone,
 			p.Origin)
 		if err != nil {
 			stmt.Close()
@@ -757,8 +941,13 @@ NextPin:
 				rollback()
 				return err
 			}
+			err = sdb.decryptPoint(&p)
+			if err != nil {
+				rollback()
+				return err
+			}
 			p.Time = time.Unix(0, timeNS)
-			hashUpdate ^= p.CRC()
+			update.point(p)
 		}
 
 		if err := rowsPoints.Close(); err != nil {
@@ -798,7 +987,7 @@ NextPin:
 		}
 	}
 
-	err = sdb.updateHash(tx, nodeID, hashUpdate)
+	err = sdb.updateHash(tx, nodeID, update)
 	if err != nil {
 		rollback()
 		return fmt.Errorf("Error updating upstream hash: %v", err)
@@ -812,23 +1001,34 @@ NextPin:
 	return nil
 }
 
-func (sdb *DbSqlite) updateHash(tx *sql.Tx, id string, hashUpdate uint32) error {
-	// key in edgeCache is up-down
-	cache := make(map[string]uint32)
-	err := sdb.updateHashHelper(tx, id, hashUpdate, cache)
-	if err != nil {
-		return err
+func (sdb *DbSqlite) updateHash(tx *sql.Tx, id string, update hashUpdate) error {
+	return sdb.updateHashes(tx, map[string]hashUpdate{id: update})
+}
+
+// updateHashes applies hash updates for multiple nodes. Each upstream edge
+// is read and written once, even if it is above several updated nodes.
+func (sdb *DbSqlite) updateHashes(tx *sql.Tx, updates map[string]hashUpdate) error {
+	// key in cache is edge ID
+	cache := make(map[string]hashUpdate)
+	// key in ups is node ID, value is the edges above the node
+	ups := make(map[string][]data.Edge)
+
+	for id, update := range updates {
+		err := sdb.updateHashHelper(tx, id, update, cache, ups)
+		if err != nil {
+			return err
+		}
 	}
 
 	// write update hash values back to edges
-	stmt, err := tx.Prepare(`UPDATE edges SET hash = ? WHERE id = ?`)
+	stmt, err := tx.Prepare(`UPDATE edges SET hash = ?, secret_hash = ? WHERE id = ?`)
 
 	if err != nil {
 		return err
 	}
 
 	for id, hash := range cache {
-		_, err = stmt.Exec(hash, id)
+		_, err = stmt.Exec(hash.hash, hash.secret, id)
 		if err != nil {
 			stmt.Close()
 			return fmt.Errorf("Error updating edge hash: %v", err)
@@ -840,21 +1040,29 @@ func (sdb *DbSqlite) updateHash(tx *sql.Tx, id string, hashUpdate uint32) error
 	return nil
 }
 
-func (sdb *DbSqlite) updateHashHelper(tx *sql.Tx, id string, hashUpdate uint32, cache map[string]uint32) error {
-	edges, err := sdb.edges(tx, "SELECT * FROM edges WHERE down=?", id)
-	if err != nil {
-		return err
+func (sdb *DbSqlite) updateHashHelper(tx *sql.Tx, id string, update hashUpdate,
+	cache map[string]hashUpdate, ups map[string][]data.Edge) error {
+	edges, ok := ups[id]
+	if !ok {
+		var err error
+		edges, err = sdb.edges(tx, "SELECT * FROM edges WHERE down=?", id)
+		if err != nil {
+			return err
+		}
+		ups[id] = edges
 	}
 
 	for _, e := range edges {
-		if _, ok := cache[e.ID]; !ok {
-			cache[e.ID] = e.Hash
+		hash, ok := cache[e.ID]
+		if !ok {
+			hash = hashUpdate{hash: e.Hash, secret: e.SecretHash}
 		}
 
-		cache[e.ID] ^= hashUpdate
+		hash.add(update)
+		cache[e.ID] = hash
 
 		if e.Up != "none" {
-			err := sdb.updateHashHelper(tx, e.Up, hashUpdate, cache)
+			err := sdb.updateHashHelper(tx, e.Up, update, cache, ups)
 			if err != nil {
 				return err
 			}
@@ -882,7 +1090,8 @@ func (sdb *DbSqlite) edges(tx *sql.Tx, query string, args ...any) ([]data.Edge,
 
 	for rowsEdges.Next() {
 		var edge data.Edge
-		err = rowsEdges.Scan(&edge.ID, &edge.Up, &edge.Down, &edge.Hash, &edge.Type)
+		err = rowsEdges.Scan(&edge.ID, &edge.Up, &edge.Down, &edge.Hash, &edge.Type,
+			&edge.SecretHash)
 		if err != nil {
 			return nil, fmt.Errorf("Error scanning edges: %v", err)
 		}
@@ -922,13 +1131,28 @@ func (sdb *DbSqlite) edges(tx *sql.Tx, query string, args ...any) ([]data.Edge,
 
 // Close the db
 func (sdb *DbSqlite) Close() error {
-	return sdb.db.Close()
+	err := sdb.db.Close()
+	if sdb.lock != nil {
+		sdb.lock.unlock()
+	}
+	return err
 }
 
-func (sdb *DbSqlite) rootNodeID() string {
+// RootNodeID returns the ID of the instance root node
+func (sdb *DbSqlite) RootNodeID() string {
 	return sdb.meta.RootID
 }
 
+// JWTKey returns the key used to sign auth tokens
+func (sdb *DbSqlite) JWTKey() []byte {
+	return sdb.meta.JWTKey
+}
+
+// GetNodes returns nodes, see Backend for details
+func (sdb *DbSqlite) GetNodes(parent, id, typ string, includeDel bool) ([]data.NodeEdge, error) {
+	return sdb.getNodes(nil, parent, id, typ, includeDel)
+}
+
 // If parent is set to "all", then all instances of the node are returned.
 // If parent is set and id is "all", then all child nodes are returned.
 // Parent can be set to "root" and id to "all" to fetch the root node(s).
@@ -980,6 +1204,7 @@ func (sdb *DbSqlite) getNodes(tx *sql.Tx, parent, id, typ string, includeDel boo
 		ne.ID = edge.Down
 		ne.Parent = edge.Up
 		ne.Hash = edge.Hash
+		ne.SecretHash = edge.SecretHash
 		ne.Type = edge.Type
 		ne.EdgePoints = edge.Points
 
@@ -1051,6 +1276,10 @@ func (sdb *DbSqlite) queryPoints(tx *sql.Tx, query string, args ...any) (map[str
 		if err != nil {
 			return nil, err
 		}
+		err = sdb.decryptPoint(&p)
+		if err != nil {
+			return nil, err
+		}
 		p.Time = time.Unix(0, timeNS)
 		retPoints[nodeOrEdgeID] = append(retPoints[nodeOrEdgeID], p)
 	}
@@ -1058,9 +1287,9 @@ func (sdb *DbSqlite) queryPoints(tx *sql.Tx, query string, args ...any) (map[str
 	return retPoints, nil
 }
 
-// userCheck checks user authentication
+// UserCheck checks user authentication
 // returns nil, nil if user is not found
-func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
+func (sdb *DbSqlite) UserCheck(email, password string) (data.Nodes, error) {
 	var users []data.NodeEdge
 
 	rows, err := sdb.db.Query("SELECT down FROM edges WHERE type=?", data.NodeTypeUser)
@@ -1098,7 +1327,7 @@ func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
 
 		n := ne[0].ToNode()
 		u := n.ToUser()
-		if u.Email == email && u.Pass == password {
+		if u.Email == email && data.CheckPassword(u.Pass, password) {
 			users = append(users, ne...)
 		}
 	}
@@ -1157,8 +1386,8 @@ func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
 	return ret, nil
 }
 
-// up returns upstream ids for a node
-func (sdb *DbSqlite) up(id string, includeDeleted bool) ([]string, error) {
+// Up returns upstream ids for a node
+func (sdb *DbSqlite) Up(id string, includeDeleted bool) ([]string, error) {
 	var ups []string
 
 	edges, err := sdb.edges(nil, "SELECT * FROM edges WHERE down=?", id)
@@ -15,7 +15,7 @@ var testFile = "test.sqlite"
 func newTestDb(t *testing.T) *DbSqlite {
 	_ = exec.Command("sh", "-c", "rm "+testFile+"*").Run()
 
-	db, err := NewSqliteDb(testFile, "")
+	db, err := NewSqliteDb(testFile, "", nil)
 	if err != nil {
 		t.Fatal("Error opening db: ", err)
 	}
@@ -27,7 +27,7 @@ func TestDbSqlite(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
-	rootID := db.rootNodeID()
+	rootID := db.RootNodeID()
 
 	if rootID == "" {
 		t.Fatal("Root ID is blank: ", rootID)
@@ -45,7 +45,7 @@ func TestDbSqlite(t *testing.T) {
 	}
 
 	// modify a point and see if it changes
-	err = db.nodePoints(rootID, data.Points{{Type: data.PointTypeDescription, Text: "root"}})
+	err = db.NodePoints(rootID, data.Points{{Type: data.PointTypeDescription, Text: "root"}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,7 +62,7 @@ func TestDbSqlite(t *testing.T) {
 	}
 
 	// send an old point and verify it does not change
-	err = db.nodePoints(rootID, data.Points{{Time: time.Now().Add(-time.Hour),
+	err = db.NodePoints(rootID, data.Points{{Time: time.Now().Add(-time.Hour),
 		Type: data.PointTypeDescription, Text: "root with old time"}})
 	if err != nil {
 		t.Fatal(err)
@@ -131,7 +131,7 @@ func TestDbSqlite(t *testing.T) {
 	}
 
 	// test edge points
-	err = db.edgePoints(adminID, rootID, data.Points{{Type: data.PointTypeRole, Text: data.PointValueRoleAdmin}})
+	err = db.EdgePoints(adminID, rootID, data.Points{{Type: data.PointTypeRole, Text: data.PointValueRoleAdmin}})
 	if err != nil {
 		t.Fatal("Error sending edge points: ", err)
 	}
@@ -152,7 +152,7 @@ func TestDbSqlite(t *testing.T) {
 	// try two children
 	groupNodeID := uuid.New().String()
 
-	err = db.edgePoints(groupNodeID, rootID, data.Points{
+	err = db.EdgePoints(groupNodeID, rootID, data.Points{
 		{Type: data.PointTypeTombstone, Value: 0},
 		{Type: data.PointTypeNodeType, Text: data.NodeTypeGroup},
 	})
@@ -195,9 +195,9 @@ func TestDbSqliteKeyZero(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
-	rootID := db.rootNodeID()
+	rootID := db.RootNodeID()
 
-	err := db.nodePoints(rootID, data.Points{{Type: data.PointTypeValue, Value: 1}})
+	err := db.NodePoints(rootID, data.Points{{Type: data.PointTypeValue, Value: 1}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -209,7 +209,7 @@ func TestDbSqliteKeyZero(t *testing.T) {
 
 	n := nodes[0]
 
-	err = db.nodePoints(rootID, data.Points{{Type: data.PointTypeValue, Key: "0", Value: 2}})
+	err = db.NodePoints(rootID, data.Points{{Type: data.PointTypeValue, Key: "0", Value: 2}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -228,17 +228,17 @@ func TestDbSqliteKeyZero(t *testing.T) {
 
 func TestDbSqliteReopen(t *testing.T) {
 	db := newTestDb(t)
-	rootID := db.rootNodeID()
+	rootID := db.RootNodeID()
 	db.Close()
 
 	var err error
-	db, err = NewSqliteDb(testFile, "")
+	db, err = NewSqliteDb(testFile, "", nil)
 	if err != nil {
 		t.Fatal("Error opening db: ", err)
 	}
 	defer db.Close()
 
-	if rootID != db.rootNodeID() {
+	if rootID != db.RootNodeID() {
 		t.Fatal("Root node ID changed")
 	}
 }
@@ -247,7 +247,7 @@ func TestDbSqliteUserCheck(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
-	nodes, err := db.userCheck("admin@admin.com", "admin")
+	nodes, err := db.UserCheck("admin@admin.com", "admin")
 	if err != nil {
 		t.Fatal("userCheck returned error: ", err)
 	}
@@ -255,13 +255,38 @@ func TestDbSqliteUserCheck(t *testing.T) {
 	if len(nodes) < 1 {
 		t.Fatal("userCheck did not return nodes")
 	}
+
+	nodes, err = db.UserCheck("admin@admin.com", "wrong")
+	if err != nil {
+		t.Fatal("userCheck returned error: ", err)
+	}
+
+	if len(nodes) > 0 {
+		t.Fatal("userCheck returned nodes for wrong password")
+	}
+
+	// the password should be stored as a hash
+	users, err := db.getNodes(nil, db.RootNodeID(), "all", data.NodeTypeUser, false)
+	if err != nil {
+		t.Fatal("Error getting users: ", err)
+	}
+
+	if len(users) < 1 {
+		t.Fatal("No users found")
+	}
+
+	user := users[0].ToNode()
+	pass := user.ToUser().Pass
+	if pass == "admin" || !data.IsPasswordHash(pass) {
+		t.Fatal("Password not hashed: ", pass)
+	}
 }
 
 func TestDbSqliteUp(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
-	rootID := db.rootNodeID()
+	rootID := db.RootNodeID()
 
 	children, err := db.getNodes(nil, rootID, "all", "", false)
 
@@ -275,7 +300,7 @@ func TestDbSqliteUp(t *testing.T) {
 
 	childID := children[0].ID
 
-	ups, err := db.up(childID, false)
+	ups, err := db.Up(childID, false)
 
 	if err != nil {
 		t.Fatal(err)
@@ -290,7 +315,7 @@ func TestDbSqliteUp(t *testing.T) {
 	}
 
 	// try to get ups of root node
-	ups, err = db.up(rootID, false)
+	ups, err = db.Up(rootID, false)
 
 	if err != nil {
 		t.Fatal(err)
@@ -309,7 +334,7 @@ func TestDbSqliteBatchPoints(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
-	rootID := db.rootNodeID()
+	rootID := db.RootNodeID()
 
 	now := time.Now()
 
@@ -319,7 +344,7 @@ func TestDbSqliteBatchPoints(t *testing.T) {
 		{Time: now.Add(-time.Second * 2), Type: data.PointTypeValue},
 	}
 
-	err := db.nodePoints(rootID, pts)
+	err := db.NodePoints(rootID, pts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -340,3 +365,45 @@ func TestDbSqliteBatchPoints(t *testing.T) {
 	}
 
 }
+
+func TestDbSqliteNodePointsBatch(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	rootID := db.RootNodeID()
+
+	backendAddNode(t, db, rootID, "group", data.NodeTypeGroup)
+	backendAddNode(t, db, "group", "var1", data.NodeTypeVariable)
+	backendAddNode(t, db, "group", "var2", data.NodeTypeVariable)
+
+	now := time.Now()
+
+	errs := db.nodePointsBatch([]nodePointsWrite{
+		{id: "var1", points: data.Points{{Time: now, Type: data.PointTypeValue, Value: 1}}},
+		{id: "var2", points: data.Points{{Time: now, Type: data.PointTypeValue, Value: 2}}},
+		// later write to the same node in the batch
+		{id: "var1", points: data.Points{{Time: now.Add(time.Second),
+			Type: data.PointTypeValue, Value: 3}}},
+		// older point is ignored
+		{id: "var2", points: data.Points{{Time: now.Add(-time.Second),
+			Type: data.PointTypeValue, Value: 4}}},
+	})
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Error writing batch %v: %v", i, err)
+		}
+	}
+
+	var1 := backendNode(t, db, "group", "var1")
+	if v, _ := var1.Points.Value(data.PointTypeValue, ""); v != 3 {
+		t.Fatal("Wrong value for var1: ", v)
+	}
+
+	var2 := backendNode(t, db, "group", "var2")
+	if v, _ := var2.Points.Value(data.PointTypeValue, ""); v != 2 {
+		t.Fatal("Wrong value for var2: ", v)
+	}
+
+	backendCheckHashes(t, db, backendNode(t, db, "root", "all"))
+}
@@ -2,10 +2,13 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -18,12 +21,19 @@ import (
 
 var reportMetricsPeriod = time.Minute
 
+// historyMaintPeriod is how often old local history is removed and
+// downsampled
+var historyMaintPeriod = time.Hour
+
+// gcPeriod is how often old tombstones are purged
+var gcPeriod = time.Hour
+
 // Store implements the SIOT NATS api
 type Store struct {
 	params        Params
 	nc            *nats.Conn
 	subscriptions map[string]*nats.Subscription
-	db            *DbSqlite
+	db            Backend
 	authorizer    api.Authorizer
 
 	// cycle metrics track how long it takes to handle a point
@@ -39,6 +49,13 @@ type Store struct {
 	chStop        chan struct{}
 	chStopMetrics chan struct{}
 	chWaitStart   chan struct{}
+
+	// point messages waiting to be written, see batch.go
+	chWrite     chan *pointsWrite
+	chWriteDone chan struct{}
+	// writeIntake is write locked when the writer stops accepting messages
+	writeIntake       sync.RWMutex
+	writeIntakeClosed bool
 }
 
 // Params are used to configure a store
@@ -50,19 +67,47 @@ type Params struct {
 	// ID for the instance -- it is only used when initializing the store.
 	// ID must be unique. If ID is not set, then a UUID is generated.
 	ID string
+	// History configures local time-series history
+	History HistoryParams
+	// Backup configures periodic backups of the store
+	Backup BackupParams
+	// TombstoneRetention is how long deleted nodes and points are kept
+	// before they are permanently removed. If 0, they are kept forever.
+	TombstoneRetention time.Duration
+	// Backend is the database used by the store. If not set, a SQLite
+	// database in File is used.
+	Backend Backend
+	// WriteBatchWindow is how long the store waits for more point messages
+	// before writing a batch. If 0, only messages that queue up while the
+	// previous batch is written are batched.
+	WriteBatchWindow time.Duration
+	// SecretKey is used to encrypt secret points in the SQLite database.
+	// If not set, secret points are stored in plain text.
+	SecretKey []byte
 }
 
 // NewStore creates a new NATS client for handling SIOT requests
 func NewStore(p Params) (*Store, error) {
-	db, err := NewSqliteDb(p.File, p.ID)
-	if err != nil {
-		return nil, fmt.Errorf("Error opening db: %v", err)
+	db := p.Backend
+
+	if db == nil {
+		sdb, err := NewSqliteDb(p.File, p.ID, p.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening db: %v", err)
+		}
+
+		sdb.history = p.History
+		db = sdb
+	}
+
+	if p.Backup.Dir == "" {
+		p.Backup.Dir = filepath.Join(filepath.Dir(p.File), "backups")
 	}
 
 	// we don't have node ID yet, but need to init here so we can start
 	// collecting data
 
-	authorizer, err := api.NewKey(db.meta.JWTKey)
+	authorizer, err := api.NewKey(db.JWTKey())
 	if err != nil {
 		return nil, fmt.Errorf("Error creating authorizer: %v", err)
 	}
@@ -77,6 +122,8 @@ func NewStore(p Params) (*Store, error) {
 		chStop:        make(chan struct{}),
 		chStopMetrics: make(chan struct{}),
 		chWaitStart:   make(chan struct{}),
+		chWrite:       make(chan *pointsWrite, writeQueueSize),
+		chWriteDone:   make(chan struct{}),
 		metricCycleNodePoint: client.NewMetric(p.Nc, "",
 			data.PointTypeMetricNatsCycleNodePoint, reportMetricsPeriod),
 		metricCycleNodeEdgePoint: client.NewMetric(p.Nc, "",
@@ -97,6 +144,9 @@ func (st *Store) GetAuthorizer() api.Authorizer {
 func (st *Store) Run() error {
 	nc := st.params.Nc
 	var err error
+
+	go st.writer()
+
 	st.subscriptions["nodePoints"], err = nc.Subscribe("p.*", st.handleNodePoints)
 	if err != nil {
 		return fmt.Errorf("Subscribe node points error: %w", err)
@@ -111,16 +161,6 @@ func (st *Store) Run() error {
 		return fmt.Errorf("Subscribe node error: %w", err)
 	}
 
-	/*
-		if st.subscriptions["notifications"], err = nc.Subscribe("node.*.not", st.handleNotification); err != nil {
-			return fmt.Errorf("Subscribe notification error: %w", err)
-		}
-
-		if st.subscriptions["messages"], err = nc.Subscribe("node.*.msg", st.handleMessage); err != nil {
-			return fmt.Errorf("Subscribe message error: %w", err)
-		}
-	*/
-
 	if st.subscriptions["auth.user"], err = nc.Subscribe("auth.user", st.handleAuthUser); err != nil {
 		return fmt.Errorf("Subscribe auth error: %w", err)
 	}
@@ -129,6 +169,10 @@ func (st *Store) Run() error {
 		return fmt.Errorf("Subscribe auth error: %w", err)
 	}
 
+	if st.subscriptions["ruleHistory"], err = nc.Subscribe(client.SubjectRuleHistory("*"), st.handleRuleHistory); err != nil {
+		return fmt.Errorf("Subscribe rule history error: %w", err)
+	}
+
 	if st.subscriptions["admin.storeVerify"], err = nc.Subscribe("admin.storeVerify", st.handleStoreVerify); err != nil {
 		return fmt.Errorf("Subscribe dbVerify error: %w", err)
 	}
@@ -137,9 +181,59 @@ func (st *Store) Run() error {
 		return fmt.Errorf("Subscribe dbMaint error: %w", err)
 	}
 
+	if st.subscriptions["admin.storeBackup"], err = nc.Subscribe("admin.storeBackup", st.handleStoreBackup); err != nil {
+		return fmt.Errorf("Subscribe storeBackup error: %w", err)
+	}
+
+	// local history is queried using the instance root node ID
+	if st.subscriptions["history"], err = nc.Subscribe(client.SubjectHistory(st.db.RootNodeID()), st.handleHistory); err != nil {
+		return fmt.Errorf("Subscribe history error: %w", err)
+	}
+
+	// optional backend features
+	history, _ := st.db.(historyBackend)
+	backup, _ := st.db.(backupBackend)
+	_, gc := st.db.(gcBackend)
+
+	historyTicker := time.NewTicker(historyMaintPeriod)
+	if history == nil || !history.historyEnabled() {
+		historyTicker.Stop()
+	}
+
+	backupTicker := time.NewTicker(time.Hour)
+	if st.params.Backup.Period > 0 && backup != nil {
+		backupTicker.Reset(st.params.Backup.Period)
+	} else {
+		backupTicker.Stop()
+	}
+
+	gcTicker := time.NewTicker(gcPeriod)
+	if st.params.TombstoneRetention <= 0 || !gc {
+		gcTicker.Stop()
+	}
+
 done:
 	for {
 		select {
+		case <-historyTicker.C:
+			removed, err := history.historyMaint(time.Now())
+			if err != nil {
+				log.Println("Error maintaining history:", err)
+			} else if removed > 0 {
+				log.Printf("Removed %v old history points\n", removed)
+			}
+		case <-gcTicker.C:
+			err := st.gcTombstones(time.Now().Add(-st.params.TombstoneRetention))
+			if err != nil {
+				log.Println("Error purging tombstones:", err)
+			}
+		case <-backupTicker.C:
+			file, err := backup.backupRotate(st.params.Backup, time.Now())
+			if err != nil {
+				log.Println("Error backing up store:", err)
+			} else {
+				log.Println("Store backed up to:", file)
+			}
 		case <-st.chWaitStart:
 			// don't need to do anything as simply reading this
 			// channel will unblock the caller
@@ -157,6 +251,8 @@ done:
 		}
 	}
 
+	<-st.chWriteDone
+
 	st.db.Close()
 
 	return nil
@@ -189,7 +285,7 @@ func (st *Store) WaitStart(ctx context.Context) error {
 
 // Reset the store by permanently wiping all data
 func (st *Store) Reset() error {
-	return st.db.reset()
+	return st.db.Reset()
 }
 
 // StartMetrics for various handling operations. Metrics are sent to the node ID given
@@ -218,6 +314,9 @@ func (st *Store) StartMetrics(nodeID string) error {
 				log.Println("Error getting pendingNodePoints:", err)
 			}
 
+			// include messages waiting for the writer
+			pendingNodePoints += len(st.chWrite)
+
 			err = st.metricPendingNodePoint.AddSample(float64(pendingNodePoints))
 			if err != nil {
 				log.Println("Error handling metric:", err)
@@ -244,13 +343,6 @@ func (st *Store) StopMetrics(_ error) {
 
 func (st *Store) handleNodePoints(msg *nats.Msg) {
 	start := time.Now()
-	defer func() {
-		t := time.Since(start).Milliseconds()
-		err := st.metricCycleNodePoint.AddSample(float64(t))
-		if err != nil {
-			log.Println("Error stopping metrics:", err)
-		}
-	}()
 
 	nodeID, points, err := client.DecodeNodePointsMsg(msg)
 
@@ -260,36 +352,12 @@ func (st *Store) handleNodePoints(msg *nats.Msg) {
 		return
 	}
 
-	// write points to database
-	err = st.db.nodePoints(nodeID, points)
-
-	if err != nil {
-		// TODO track error stats
-		log.Printf("Error writing nodeID (%v) to Db: %v", nodeID, err)
-		log.Println("msg subject:", msg.Subject)
-		st.reply(msg.Reply, err)
-		return
-	}
-
-	// process point in upstream nodes
-	err = st.processPointsUpstream(nodeID, nodeID, points)
-	if err != nil {
-		// TODO track error stats
-		log.Println("Error processing point in upstream nodes:", err)
-	}
-
-	st.reply(msg.Reply, nil)
+	// points are written and acked by the writer, see batch.go
+	st.queueWrite(&pointsWrite{msg: msg, start: start, nodeID: nodeID, points: points})
 }
 
 func (st *Store) handleEdgePoints(msg *nats.Msg) {
 	start := time.Now()
-	defer func() {
-		t := time.Since(start).Milliseconds()
-		err := st.metricCycleNodeEdgePoint.AddSample(float64(t))
-		if err != nil {
-			log.Println("handle edge point error:", err)
-		}
-	}()
 
 	nodeID, parentID, points, err := client.DecodeEdgePointsMsg(msg)
 
@@ -299,26 +367,8 @@ func (st *Store) handleEdgePoints(msg *nats.Msg) {
 		return
 	}
 
-	// write points to database. Its important that we write to the DB
-	// before sending points upstream, or clients may do a rescan and not
-	// see the node is deleted.
-	err = st.db.edgePoints(nodeID, parentID, points)
-
-	if err != nil {
-		// TODO track error stats
-		log.Printf("Error writing edge points (%v:%v) to Db: %v", nodeID, parentID, err)
-		st.reply(msg.Reply, err)
-	}
-
-	// process point in upstream nodes. We need to do this before writing
-	// to DB, otherwise the point will not be sent upstream
-	err = st.processEdgePointsUpstream(nodeID, nodeID, parentID, points)
-	if err != nil {
-		// TODO track error stats
-		log.Println("Error processing point in upstream nodes:", err)
-	}
-
-	st.reply(msg.Reply, nil)
+	st.queueWrite(&pointsWrite{msg: msg, start: start, nodeID: nodeID,
+		parentID: parentID, points: points})
 }
 
 func (st *Store) handleNodesRequest(msg *nats.Msg) {
@@ -365,7 +415,7 @@ func (st *Store) handleNodesRequest(msg *nats.Msg) {
 		}
 	}
 
-	nodes, err = st.db.getNodes(nil, parent, nodeID, nodeType, includeDel)
+	nodes, err = st.db.GetNodes(parent, nodeID, nodeType, includeDel)
 
 	if err != nil {
 		if err != data.ErrDocumentNotFound {
@@ -433,7 +483,7 @@ func (st *Store) handleAuthUser(msg *nats.Msg) {
 		return
 	}
 
-	nodes, err := st.db.userCheck(emailP.Text, passP.Text)
+	nodes, err := st.db.UserCheck(emailP.Text, passP.Text)
 
 	if err != nil || len(nodes) <= 0 {
 		log.Println("Error, invalid user")
@@ -492,9 +542,70 @@ func (st *Store) handleAuthGetNatsURI(msg *nats.Msg) {
 	}
 }
 
+// handleRuleHistory returns the history entries stored in a rule node
+func (st *Store) handleRuleHistory(msg *nats.Msg) {
+	results := data.RuleHistoryResults{History: []data.RuleHistory{}}
+
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 3 {
+		results.ErrorMessage = "invalid history subject: " + msg.Subject
+	} else {
+		nodes, err := st.db.GetNodes("all", chunks[2], "", false)
+		switch {
+		case err != nil:
+			results.ErrorMessage = err.Error()
+		case len(nodes) < 1:
+			results.ErrorMessage = data.ErrDocumentNotFound.Error()
+		default:
+			results.History = data.RuleHistoryFromPoints(nodes[0].Points)
+		}
+	}
+
+	d, err := json.Marshal(results)
+	if err != nil {
+		log.Println("NATS: Error encoding history response:", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("NATS: Error publishing response to history request:", err)
+	}
+}
+
+// handleHistory runs a data.HistoryQuery against the local history
+func (st *Store) handleHistory(msg *nats.Msg) {
+	var results data.HistoryResults
+
+	var query data.HistoryQuery
+	err := json.Unmarshal(msg.Data, &query)
+
+	history, ok := st.db.(historyBackend)
+
+	switch {
+	case err != nil:
+		results.ErrorMessage = "parsing query: " + err.Error()
+	case !ok || !history.historyEnabled():
+		results.ErrorMessage = errHistoryDisabled.Error()
+	default:
+		results = history.historyQuery(query)
+	}
+
+	d, err := json.Marshal(results)
+	if err != nil {
+		log.Println("NATS: Error encoding history response:", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("NATS: Error publishing response to history request:", err)
+	}
+}
+
 func (st *Store) handleStoreVerify(msg *nats.Msg) {
 	var ret string
-	hashErr := st.db.verifyNodeHashes(false)
+	hashErr := st.db.VerifyNodeHashes(false)
 	if hashErr != nil {
 		ret = hashErr.Error()
 	}
@@ -507,7 +618,7 @@ func (st *Store) handleStoreVerify(msg *nats.Msg) {
 
 func (st *Store) handleStoreMaint(msg *nats.Msg) {
 	var ret string
-	hashErr := st.db.verifyNodeHashes(true)
+	hashErr := st.db.VerifyNodeHashes(true)
 	if hashErr != nil {
 		ret = hashErr.Error()
 	}
@@ -518,6 +629,62 @@ func (st *Store) handleStoreMaint(msg *nats.Msg) {
 	}
 }
 
+// gcTombstones purges tombstones older than cutoff. The total number of
+// edges and points purged are kept in points on the root node.
+func (st *Store) gcTombstones(cutoff time.Time) error {
+	gc, ok := st.db.(gcBackend)
+	if !ok {
+		return errNotSupported
+	}
+
+	stats, err := gc.gcTombstones(cutoff)
+	if err != nil {
+		return err
+	}
+
+	if stats.edges == 0 && stats.points == 0 {
+		return nil
+	}
+
+	log.Printf("Purged %v deleted edges and %v deleted points\n", stats.edges, stats.points)
+
+	rootID := st.db.RootNodeID()
+	nodes, err := st.db.GetNodes("all", rootID, "", false)
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) < 1 {
+		return data.ErrDocumentNotFound
+	}
+
+	edges, _ := nodes[0].Points.Value(data.PointTypeStoreGCEdges, "")
+	points, _ := nodes[0].Points.Value(data.PointTypeStoreGCPoints, "")
+
+	return client.SendNodePoints(st.nc, rootID, data.Points{
+		{Type: data.PointTypeStoreGCEdges, Value: edges + float64(stats.edges)},
+		{Type: data.PointTypeStoreGCPoints, Value: points + float64(stats.points)},
+	}, false)
+}
+
+// handleStoreBackup writes a backup of the store to the backup dir. Backups
+// to other files can only be made locally (see Backup) so that NATS clients
+// can't overwrite files.
+func (st *Store) handleStoreBackup(msg *nats.Msg) {
+	backup, ok := st.db.(backupBackend)
+	if !ok {
+		st.reply(msg.Reply, errNotSupported)
+		return
+	}
+
+	file, err := backup.backupRotate(st.params.Backup, time.Now())
+	if err == nil {
+		log.Println("Store backed up to:", file)
+	}
+
+	st.reply(msg.Reply, err)
+}
+
 // used for messages that want an ACK
 func (st *Store) reply(subject string, err error) {
 	if subject == "" {
@@ -552,7 +719,7 @@ func (st *Store) processPointsUpstream(upNodeID, nodeID string, points data.Poin
 		return nil
 	}
 
-	ups, err := st.db.up(upNodeID, false)
+	ups, err := st.db.Up(upNodeID, false)
 	if err != nil {
 		return err
 	}
@@ -625,7 +792,7 @@ func (st *Store) processEdgePointsUpstream(upNodeID, nodeID, parentID string, po
 		return nil
 	}
 
-	ups, err := st.db.up(upNodeID, true)
+	ups, err := st.db.Up(upNodeID, true)
 	if err != nil {
 		return err
 	}
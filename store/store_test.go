@@ -2,6 +2,7 @@ package store_test
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
@@ -188,3 +189,48 @@ func TestDontAllowDeleteRootNode(t *testing.T) {
 		t.Fatal("Root node was deleted")
 	}
 }
+
+func TestStoreConcurrentPoints(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	// points from many senders are written in batches, and each sender
+	// must get an ack after its point is written
+	count := 100
+	errs := make(chan error, count)
+
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			errs <- client.SendNodePoint(nc, root.ID, data.Point{
+				Type: data.PointTypeValue, Key: strconv.Itoa(i), Value: float64(i)}, true)
+		}(i)
+	}
+
+	for i := 0; i < count; i++ {
+		err := <-errs
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	nodes, err := client.GetNodes(nc, "root", root.ID, "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	values := 0
+	for _, p := range nodes[0].Points {
+		if p.Type == data.PointTypeValue {
+			values++
+		}
+	}
+
+	if values != count {
+		t.Fatalf("Expected %v points, got %v", count, values)
+	}
+}